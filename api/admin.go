@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+)
+
+// X-Admin-Key が AdminAPIKey と一致するか (AdminAPIKey が空の場合は常に false)
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.cfg.AdminAPIKey == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(s.cfg.AdminAPIKey)) == 1
+}
+
+type concurrencyKey struct{}
+
+// このリクエストでPR TIMESへ同時に送るリクエストの数をnにする
+// MaxConcurrency より大きい値も使える (その場合は全体の上限の代わりにnまでにする)
+func withConcurrencyLimit(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, concurrencyKey{}, make(chan struct{}, n))
+}
+
+// リクエストごとに同時に送る数を指定されている場合はその数
+func concurrencyLimit(ctx context.Context) (int, bool) {
+	sem, ok := ctx.Value(concurrencyKey{}).(chan struct{})
+	if !ok {
+		return 0, false
+	}
+	return cap(sem), true
+}
+
+// 指定されている場合は空くまで待ち、ok を true にする
+// 戻り値の関数で解放する
+func acquireConcurrency(ctx context.Context) (release func(), ok bool, err error) {
+	sem, ok := ctx.Value(concurrencyKey{}).(chan struct{})
+	if !ok {
+		return func() {}, false, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, true, nil
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+}
+
+// POST /admin/cache/flush の結果
+type CacheFlushResponse struct {
+	// keyword を指定した場合のみ
+	Keyword string `json:"keyword,omitempty"`
+	// 捨てたキーワードの数
+	Keywords int `json:"keywords"`
+	// いいね数を捨てたリリースの数
+	LikeCounts int `json:"likeCounts"`
+	// Cacheから捨てたいいね数の数 (LikeCountCacheTTL が有効な場合のみ)
+	CachedLikeCounts int `json:"cachedLikeCounts"`
+	// 捨てた検索結果のページの数 (ConditionalRequests が有効な場合のみ)
+	Pages int `json:"pages"`
+	// 捨てた0件のキーワードの数 (NegativeCacheTTL が有効な場合のみ)
+	NegativeKeywords int `json:"negativeKeywords"`
+	// 捨てた検索結果の数 (ResultCacheTTL が有効な場合のみ)
+	Results int `json:"results"`
+}
+
+// POST /admin/cache/flush はメモリ上に持っているいいね数と検索結果のページを捨てる
+// keyword を指定した場合は、そのキーワードで見つかったリリースの分だけを捨てる
+func (s *Server) handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isAdmin(r) {
+		http.Error(w, "A valid X-Admin-Key is required", http.StatusForbidden)
+		return
+	}
+
+	resp := CacheFlushResponse{Keyword: r.URL.Query().Get("keyword")}
+	// 前回そのキーワードで見つかったリリースは、いいね数の履歴を捨てる前に調べておく
+	if s.cfg.LikeCountCacheTTL > 0 {
+		var releaseIDs []string
+		if resp.Keyword != "" {
+			releaseIDs = s.likeHistory.keywordReleaseIDs(resp.Keyword)
+		}
+		if resp.Keyword == "" || len(releaseIDs) > 0 {
+			n, err := s.flushCachedLikeCounts(r.Context(), releaseIDs)
+			if err != nil {
+				log.Println("Error flushing cached like counts:", err)
+			}
+			resp.CachedLikeCounts = n
+		}
+	}
+	if resp.Keyword == "" {
+		resp.Keywords, resp.LikeCounts = s.likeHistory.flush()
+	} else {
+		resp.Keywords, resp.LikeCounts = s.likeHistory.flushKeyword(resp.Keyword)
+	}
+	if s.pageCache != nil {
+		pages, err := s.pageCache.flush(r.Context(), resp.Keyword)
+		if err != nil {
+			log.Println("Error flushing cached pages:", err)
+		}
+		resp.Pages = pages
+	}
+	if s.cfg.NegativeCacheTTL > 0 {
+		var n int
+		var err error
+		if resp.Keyword == "" {
+			n, err = s.cache.DeletePrefix(r.Context(), "negative:")
+		} else {
+			n, err = s.cache.Delete(r.Context(), negativeCacheKey(resp.Keyword))
+		}
+		if err != nil {
+			log.Println("Error flushing negative cache:", err)
+		}
+		resp.NegativeKeywords = n
+	}
+	if s.cfg.ResultCacheTTL > 0 {
+		var n int
+		var err error
+		if resp.Keyword == "" {
+			n, err = s.cache.DeletePrefix(r.Context(), "result:")
+		} else {
+			n, err = s.cache.Delete(r.Context(), resultCacheKey(resp.Keyword))
+		}
+		if err != nil {
+			log.Println("Error flushing cached results:", err)
+		}
+		resp.Results = n
+	}
+	log.Printf("Cache flushed (keyword %q): %d keywords, %d like counts, %d cached like counts, %d pages, %d negative keywords, %d results", resp.Keyword, resp.Keywords, resp.LikeCounts, resp.CachedLikeCounts, resp.Pages, resp.NegativeKeywords, resp.Results)
+	writeJSON(w, resp)
+}
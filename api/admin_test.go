@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// いいね数の取得を同時にいくつ受けたかを数えるPR TIMES
+func newConcurrencyUpstream(t *testing.T) (*fakeUpstream, func() int) {
+	t.Helper()
+	f := newFakeUpstream(t)
+	for n := 1; n <= 20; n++ {
+		f.addRelease("backfill", n, "2024年12月01日 09時00分", n)
+	}
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/like_count") {
+			return false
+		}
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return false
+	}
+	return f, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+}
+
+func serveAdmin(t *testing.T, s *Server, target, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if key != "" {
+		req.Header.Set("X-Admin-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+// concurrency はそのリクエストのPR TIMESへの同時リクエスト数だけを変える
+func TestConcurrencyOverride(t *testing.T) {
+	f, peak := newConcurrencyUpstream(t)
+	cfg := f.config()
+	cfg.AdminAPIKey = "admin"
+	// 20件を一度に取得する
+	cfg.LikeCountWaveSize = 20
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=backfill&nocache=1")
+	if got := peak(); got <= 2 {
+		t.Fatalf("peak without the override = %d, want more than 2", got)
+	}
+
+	f, peak = newConcurrencyUpstream(t)
+	cfg.BaseURL = f.URL
+	s = NewServer(cfg)
+	rec := serveAdmin(t, s, "/prtimes_posts?keyword=backfill&concurrency=2", "admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := peak(); got != 2 {
+		t.Errorf("peak like_count requests in flight = %d, want 2", got)
+	}
+}
+
+// MaxConcurrency より大きい値を指定した場合は全体の上限の代わりにその数まで送り、ワーカーの数もその数にする
+func TestConcurrencyOverrideAboveMaxConcurrency(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mode func(cfg *Config)
+	}{
+		{"waves", func(cfg *Config) { cfg.LikeCountWaveSize = 20 }},
+		{"pooled", func(cfg *Config) { cfg.LikeCountWorkersMin, cfg.LikeCountWorkersMax = 1, 2 }},
+	} {
+		f, peak := newConcurrencyUpstream(t)
+		cfg := f.config()
+		cfg.AdminAPIKey = "admin"
+		cfg.MaxConcurrency = 4
+		tt.mode(&cfg)
+		s := NewServer(cfg)
+
+		getResponse(t, s, "/prtimes_posts?keyword=backfill&nocache=1")
+		if got := peak(); got > 4 {
+			t.Fatalf("%s: peak without the override = %d, want at most 4", tt.name, got)
+		}
+
+		f, peak = newConcurrencyUpstream(t)
+		cfg.BaseURL = f.URL
+		s = NewServer(cfg)
+		rec := serveAdmin(t, s, "/prtimes_posts?keyword=backfill&concurrency=8", "admin")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", tt.name, rec.Code, rec.Body.String())
+		}
+		if got := peak(); got != 8 {
+			t.Errorf("%s: peak like_count requests in flight = %d, want 8", tt.name, got)
+		}
+	}
+}
+
+func TestConcurrencyOverrideLimits(t *testing.T) {
+	f := newFakeUpstream(t)
+	cfg := f.config()
+	cfg.AdminAPIKey = "admin"
+	cfg.MaxRequestConcurrency = 50
+	s := NewServer(cfg)
+
+	for _, tt := range []struct {
+		concurrency, key string
+		want             int
+	}{
+		{"50", "admin", http.StatusOK},
+		{"51", "admin", http.StatusBadRequest},
+		{"0", "admin", http.StatusBadRequest},
+		{"many", "admin", http.StatusBadRequest},
+		{"2", "", http.StatusForbidden},
+		{"2", "wrong", http.StatusForbidden},
+	} {
+		if rec := serveAdmin(t, s, "/prtimes_posts?keyword=backfill&concurrency="+tt.concurrency, tt.key); rec.Code != tt.want {
+			t.Errorf("concurrency=%s key=%q: status %d, want %d", tt.concurrency, tt.key, rec.Code, tt.want)
+		}
+	}
+
+	// AdminAPIKey が無い場合は誰も使えない
+	s = NewServer(f.config())
+	if rec := serveAdmin(t, s, "/prtimes_posts?keyword=backfill&concurrency=2", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("without AdminAPIKey: status %d, want 403", rec.Code)
+	}
+}
+
+func flushCache(t *testing.T, s *Server, query, key string) (*httptest.ResponseRecorder, CacheFlushResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/flush"+query, nil)
+	req.Header.Set("X-Admin-Key", key)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	var resp CacheFlushResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, resp
+}
+
+// 取得済みのいいね数と検索結果を捨て、捨てた数を返す
+func TestCacheFlush(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("a", 1, "2024年12月01日 09時00分", 1)
+	f.addRelease("a", 2, "2024年12月01日 09時00分", 2)
+	f.addRelease("b", 3, "2024年12月01日 09時00分", 3)
+	cfg := f.config()
+	cfg.AdminAPIKey = "admin"
+	s := NewServer(cfg)
+	captureLog(t)
+
+	getResponse(t, s, "/prtimes_posts?keyword=a")
+	getResponse(t, s, "/prtimes_posts?keyword=b")
+	getResponse(t, s, "/prtimes_posts?keyword=a")
+	if got := f.likeCalls.Load(); got != 3 {
+		t.Fatalf("like_count calls before flushing = %d, want 3", got)
+	}
+
+	rec, resp := flushCache(t, s, "?keyword=a", "admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if resp.Keyword != "a" || resp.Keywords != 1 || resp.CachedLikeCounts != 2 || resp.Results != 1 {
+		t.Errorf("flush keyword=a = %+v", resp)
+	}
+	getResponse(t, s, "/prtimes_posts?keyword=a")
+	getResponse(t, s, "/prtimes_posts?keyword=b")
+	if got := f.likeCalls.Load(); got != 5 {
+		t.Errorf("like_count calls after flushing a = %d, want 5 (only a is fetched again)", got)
+	}
+
+	_, resp = flushCache(t, s, "", "admin")
+	if resp.Keywords != 2 || resp.CachedLikeCounts != 3 || resp.Results != 2 {
+		t.Errorf("flush all = %+v", resp)
+	}
+	_, resp = flushCache(t, s, "", "admin")
+	if resp.Keywords != 0 || resp.CachedLikeCounts != 0 || resp.Results != 0 {
+		t.Errorf("flushing an empty cache = %+v, want zeros", resp)
+	}
+}
+
+func TestCacheFlushRequiresAdmin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminAPIKey = "admin"
+	s := NewServer(cfg)
+	if rec, _ := flushCache(t, s, "", "wrong"); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong key: status %d, want 403", rec.Code)
+	}
+	if rec := serveAdmin(t, s, "/admin/cache/flush", "admin"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
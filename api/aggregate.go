@@ -0,0 +1,249 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+func sumLikes(items []ResponseItem) int {
+	total := 0
+	for _, item := range items {
+		total += item.LikeCount
+	}
+	return total
+}
+
+// いいね数の中央値 (偶数件の場合は中央の2つの平均)
+func medianLikes(items []ResponseItem) float64 {
+	if len(items) == 0 {
+		return 0
+	}
+	counts := make([]int, len(items))
+	for i, item := range items {
+		counts[i] = item.LikeCount
+	}
+	sort.Ints(counts)
+
+	mid := len(counts) / 2
+	if len(counts)%2 == 1 {
+		return float64(counts[mid])
+	}
+	return float64(counts[mid-1]+counts[mid]) / 2
+}
+
+// いいね数のp分位 (0〜1)
+// 昇順に並べた (n-1)*p 番目を前後の値から線形補間する (p=0.5 の場合は medianLikes と同じ)
+func percentileLikes(items []ResponseItem, p float64) float64 {
+	if len(items) == 0 {
+		return 0
+	}
+	counts := make([]int, len(items))
+	for i, item := range items {
+		counts[i] = item.LikeCount
+	}
+	sort.Ints(counts)
+
+	pos := float64(len(counts)-1) * p
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	frac := pos - float64(lower)
+	return float64(counts[lower]) + float64(counts[upper]-counts[lower])*frac
+}
+
+// 公開日 (JST) ごとのまとまり
+type DayBucket struct {
+	Date       string         `json:"date"`
+	Count      int            `json:"count"`
+	TotalLikes int            `json:"totalLikes"`
+	Items      []ResponseItem `json:"items"`
+}
+
+// JSTの公開日ごとにまとめる
+// 日付は古い順、同じ日の中はいいね数の多い順に並べる
+// 公開日時が分からないものは含めない
+func groupByDay(items []ResponseItem) []DayBucket {
+	byDate := make(map[string]*DayBucket)
+	for _, item := range items {
+		if item.PublishedAt.IsZero() {
+			continue
+		}
+		date := item.PublishedAt.In(jst).Format("2006-01-02")
+		bucket, ok := byDate[date]
+		if !ok {
+			bucket = &DayBucket{Date: date}
+			byDate[date] = bucket
+		}
+		bucket.Count++
+		bucket.Items = append(bucket.Items, item)
+	}
+
+	days := make([]DayBucket, 0, len(byDate))
+	for _, bucket := range byDate {
+		bucket.TotalLikes = sumLikes(bucket.Items)
+		sort.SliceStable(bucket.Items, func(i, j int) bool {
+			return bucket.Items[i].LikeCount > bucket.Items[j].LikeCount
+		})
+		days = append(days, *bucket)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	return days
+}
+
+// 公開された曜日 (JST) ごとの件数といいね数
+type WeekdayStats struct {
+	Weekday      string  `json:"weekday"`
+	ReleaseCount int     `json:"releaseCount"`
+	TotalLikes   int     `json:"totalLikes"`
+	AverageLikes float64 `json:"averageLikes"`
+}
+
+// 月曜から日曜の順に、リリースの無い曜日も0として返す
+// 公開日時が分からないものは数えない
+func weekdayBreakdown(items []ResponseItem) []WeekdayStats {
+	stats := make([]WeekdayStats, 7)
+	for i := range stats {
+		// time.Weekday は日曜が0
+		stats[i].Weekday = time.Weekday((i + 1) % 7).String()
+	}
+	for _, item := range items {
+		if item.PublishedAt.IsZero() {
+			continue
+		}
+		i := (int(item.PublishedAt.In(jst).Weekday()) + 6) % 7
+		stats[i].ReleaseCount++
+		stats[i].TotalLikes += item.LikeCount
+	}
+	for i := range stats {
+		if stats[i].ReleaseCount > 0 {
+			stats[i].AverageLikes = float64(stats[i].TotalLikes) / float64(stats[i].ReleaseCount)
+		}
+	}
+	return stats
+}
+
+// 日ごとの件数といいね数
+type SeriesPoint struct {
+	Date         string `json:"date"`
+	ReleaseCount int    `json:"releaseCount"`
+	TotalLikes   int    `json:"totalLikes"`
+}
+
+// JSTの公開日ごとの件数といいね数を古い順に並べる
+// 最も古い日から最も新しい日までの間でリリースが無い日は0件として埋める
+// 公開日時が分からないものは数えない
+func dailySeries(items []ResponseItem) []SeriesPoint {
+	byDate := make(map[string]*SeriesPoint)
+	var first, last time.Time
+	for _, item := range items {
+		if item.PublishedAt.IsZero() {
+			continue
+		}
+		t := item.PublishedAt.In(jst)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, jst)
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+		if last.IsZero() || day.After(last) {
+			last = day
+		}
+		date := day.Format("2006-01-02")
+		point, ok := byDate[date]
+		if !ok {
+			point = &SeriesPoint{Date: date}
+			byDate[date] = point
+		}
+		point.ReleaseCount++
+		point.TotalLikes += item.LikeCount
+	}
+
+	series := []SeriesPoint{}
+	if first.IsZero() {
+		return series
+	}
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if point, ok := byDate[date]; ok {
+			series = append(series, *point)
+		} else {
+			series = append(series, SeriesPoint{Date: date})
+		}
+	}
+	return series
+}
+
+// archiveOlderThanDays で items から除いた古いリリースの集計
+type ArchiveSummary struct {
+	Count      int `json:"count"`
+	TotalLikes int `json:"totalLikes"`
+}
+
+// cutoff より前に公開されたものを除き、その件数といいね数を返す
+// 公開日時が分からないものは除かない
+func splitArchived(items []ResponseItem, cutoff time.Time) ([]ResponseItem, ArchiveSummary) {
+	var recent []ResponseItem
+	var archived ArchiveSummary
+	for _, item := range items {
+		if !item.PublishedAt.IsZero() && item.PublishedAt.Before(cutoff) {
+			archived.Count++
+			archived.TotalLikes += item.LikeCount
+			continue
+		}
+		recent = append(recent, item)
+	}
+	return recent, archived
+}
+
+// summary=true で返す集計 (結果が無い場合は null になる項目がある)
+type Summary struct {
+	TotalMatches int `json:"totalMatches"`
+	TotalLikes   int `json:"totalLikes"`
+	// いいね数の合計が最も多い企業
+	TopCompany   *string    `json:"topCompany"`
+	AverageLikes *float64   `json:"averageLikes"`
+	Newest       *time.Time `json:"newestPublishedAt"`
+	Oldest       *time.Time `json:"oldestPublishedAt"`
+}
+
+func summarize(items []ResponseItem) Summary {
+	summary := Summary{TotalMatches: len(items), TotalLikes: sumLikes(items)}
+	if len(items) == 0 {
+		return summary
+	}
+
+	average := float64(summary.TotalLikes) / float64(len(items))
+	summary.AverageLikes = &average
+
+	likesByCompany := make(map[string]int)
+	// 公開日時が分からないものは最新・最古に含めない
+	var newest, oldest time.Time
+	for _, item := range items {
+		likesByCompany[item.CorporationName] += item.LikeCount
+		if item.PublishedAt.IsZero() {
+			continue
+		}
+		if newest.IsZero() || item.PublishedAt.After(newest) {
+			newest = item.PublishedAt
+		}
+		if oldest.IsZero() || item.PublishedAt.Before(oldest) {
+			oldest = item.PublishedAt
+		}
+	}
+	if !newest.IsZero() {
+		summary.Newest = &newest
+		summary.Oldest = &oldest
+	}
+
+	// 同じいいね数の場合は名前順で先のものにして結果を安定させる
+	var top string
+	topLikes := -1
+	for company, likes := range likesByCompany {
+		if likes > topLikes || (likes == topLikes && company < top) {
+			top, topLikes = company, likes
+		}
+	}
+	summary.TopCompany = &top
+	return summary
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// JSTの日付の境目でまとめる (UTCでは同じ日でもJSTでは別の日になる)
+func TestGroupByDayJSTBoundary(t *testing.T) {
+	items := []ResponseItem{
+		{Title: "a", LikeCount: 1, PublishedAt: time.Date(2024, 12, 1, 23, 59, 0, 0, jst)},
+		{Title: "b", LikeCount: 5, PublishedAt: time.Date(2024, 12, 1, 15, 0, 0, 0, time.UTC)}, // 2024-12-02 00:00 JST
+		{Title: "c", LikeCount: 9, PublishedAt: time.Date(2024, 12, 2, 10, 0, 0, 0, jst)},
+		{Title: "d", LikeCount: 3, PublishedAt: time.Date(2024, 11, 30, 14, 59, 0, 0, time.UTC)}, // 2024-11-30 23:59 JST
+		{Title: "unknown", LikeCount: 100},
+	}
+	days := groupByDay(items)
+
+	want := []struct {
+		date   string
+		titles []string
+		likes  int
+	}{
+		{"2024-11-30", []string{"d"}, 3},
+		{"2024-12-01", []string{"a"}, 1},
+		{"2024-12-02", []string{"c", "b"}, 14},
+	}
+	if len(days) != len(want) {
+		t.Fatalf("got %d days, want %d: %+v", len(days), len(want), days)
+	}
+	for i, w := range want {
+		day := days[i]
+		if day.Date != w.date || day.Count != len(w.titles) || day.TotalLikes != w.likes {
+			t.Errorf("day %d = {%s %d %d}, want {%s %d %d}", i, day.Date, day.Count, day.TotalLikes, w.date, len(w.titles), w.likes)
+			continue
+		}
+		for j, title := range w.titles {
+			if day.Items[j].Title != title {
+				t.Errorf("%s item %d = %s, want %s", day.Date, j, day.Items[j].Title, title)
+			}
+		}
+	}
+}
+
+func TestGroupByDayParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("days", 1, "2024年12月01日 23時59分", 1)
+	f.addRelease("days", 2, "2024年12月02日 00時00分", 2)
+	f.addRelease("days", 3, "2024年12月02日 12時00分", 3)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=days&groupBy=day")
+	if len(resp.Items) != 0 {
+		t.Errorf("items should be empty with groupBy=day, got %d", len(resp.Items))
+	}
+	if len(resp.Days) != 2 || resp.Days[0].Date != "2024-12-01" || resp.Days[1].Count != 2 || resp.Days[1].TotalLikes != 5 {
+		t.Errorf("days = %+v", resp.Days)
+	}
+}
+
+// 古い順に並べ、リリースの無い日を0件で埋める
+func TestDailySeriesZeroFill(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("trend", 1, "2024年12月03日 10時00分", 4)
+	f.addRelease("trend", 2, "2024年12月01日 09時00分", 1)
+	f.addRelease("trend", 3, "2024年12月01日 18時00分", 2)
+	f.addRelease("trend", 4, "2024年12月04日 00時00分", 8)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=trend&series=daily")
+	want := []SeriesPoint{
+		{Date: "2024-12-01", ReleaseCount: 2, TotalLikes: 3},
+		{Date: "2024-12-02", ReleaseCount: 0, TotalLikes: 0},
+		{Date: "2024-12-03", ReleaseCount: 1, TotalLikes: 4},
+		{Date: "2024-12-04", ReleaseCount: 1, TotalLikes: 8},
+	}
+	if len(resp.Series) != len(want) {
+		t.Fatalf("series = %+v, want %+v", resp.Series, want)
+	}
+	for i := range want {
+		if resp.Series[i] != want[i] {
+			t.Errorf("series[%d] = %+v, want %+v", i, resp.Series[i], want[i])
+		}
+	}
+}
+
+func TestDailySeriesEmpty(t *testing.T) {
+	if series := dailySeries([]ResponseItem{{Title: "unknown"}}); series == nil || len(series) != 0 {
+		t.Errorf("series = %#v, want empty", series)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	items := []ResponseItem{
+		{CorporationName: "A社", LikeCount: 10, PublishedAt: time.Date(2024, 12, 1, 9, 0, 0, 0, jst)},
+		{CorporationName: "B社", LikeCount: 25, PublishedAt: time.Date(2024, 12, 3, 9, 0, 0, 0, jst)},
+		{CorporationName: "A社", LikeCount: 20, PublishedAt: time.Date(2024, 12, 2, 9, 0, 0, 0, jst)},
+		{CorporationName: "C社", LikeCount: 5},
+	}
+	summary := summarize(items)
+	if summary.TotalMatches != 4 || summary.TotalLikes != 60 {
+		t.Errorf("totalMatches = %d, totalLikes = %d, want 4, 60", summary.TotalMatches, summary.TotalLikes)
+	}
+	// 1件ごとではなく企業ごとの合計で比べる
+	if summary.TopCompany == nil || *summary.TopCompany != "A社" {
+		t.Errorf("topCompany = %v, want A社", summary.TopCompany)
+	}
+	if summary.AverageLikes == nil || *summary.AverageLikes != 15 {
+		t.Errorf("averageLikes = %v, want 15", summary.AverageLikes)
+	}
+	if summary.Newest == nil || !summary.Newest.Equal(items[1].PublishedAt) {
+		t.Errorf("newest = %v, want %v", summary.Newest, items[1].PublishedAt)
+	}
+	if summary.Oldest == nil || !summary.Oldest.Equal(items[0].PublishedAt) {
+		t.Errorf("oldest = %v, want %v", summary.Oldest, items[0].PublishedAt)
+	}
+}
+
+// 件数で切る前の全件から集計し、一致するものが無い場合は null を返す
+func TestSummaryParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("summary", 1, "2024年12月01日 09時00分", 4)
+	f.addRelease("summary", 2, "2024年12月02日 09時00分", 10)
+	f.addRelease("summary", 3, "2024年12月03日 09時00分", 1)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=summary&summary=true&limit=1")
+	if len(resp.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(resp.Items))
+	}
+	summary := resp.Summary
+	if summary == nil {
+		t.Fatal("summary is missing")
+	}
+	if summary.TotalMatches != 3 || summary.TotalLikes != 15 || summary.AverageLikes == nil || *summary.AverageLikes != 5 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.TopCompany == nil || *summary.TopCompany != "会社2" {
+		t.Errorf("topCompany = %v, want 会社2", summary.TopCompany)
+	}
+	if summary.Newest == nil || summary.Newest.Format("2006-01-02") != "2024-12-03" ||
+		summary.Oldest == nil || summary.Oldest.Format("2006-01-02") != "2024-12-01" {
+		t.Errorf("newest = %v, oldest = %v", summary.Newest, summary.Oldest)
+	}
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=nothing&summary=true")
+	var raw struct {
+		Summary map[string]any `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"topCompany", "averageLikes", "newestPublishedAt", "oldestPublishedAt"} {
+		if v, ok := raw.Summary[field]; !ok || v != nil {
+			t.Errorf("empty summary %s = %v (present %v), want null", field, v, ok)
+		}
+	}
+	if raw.Summary["totalMatches"] != float64(0) {
+		t.Errorf("empty summary totalMatches = %v, want 0", raw.Summary["totalMatches"])
+	}
+}
+
+// PR TIMESの形式の公開日時
+func releasedAt(t time.Time) string {
+	return t.In(jst).Format("2006年01月02日 15時04分")
+}
+
+// archiveOlderThanDays より新しいものは items に、古いものは archived に集計する
+func TestArchiveOlderThanDays(t *testing.T) {
+	now := time.Now()
+	f := newFakeUpstream(t)
+	f.addRelease("archive", 1, releasedAt(now.Add(-time.Hour)), 5)
+	f.addRelease("archive", 2, releasedAt(now.AddDate(0, 0, -2)), 3)
+	f.addRelease("archive", 3, releasedAt(now.AddDate(0, 0, -10)), 7)
+	f.addRelease("archive", 4, releasedAt(now.AddDate(0, 0, -30)), 11)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=archive&archiveOlderThanDays=7")
+	var titles []string
+	for _, item := range resp.Items {
+		titles = append(titles, item.Title)
+	}
+	if got := strings.Join(titles, ","); got != "リリース1,リリース2" {
+		t.Errorf("items = %s, want リリース1,リリース2", got)
+	}
+	if resp.Archived == nil || *resp.Archived != (ArchiveSummary{Count: 2, TotalLikes: 18}) {
+		t.Errorf("archived = %+v, want {Count:2 TotalLikes:18}", resp.Archived)
+	}
+
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=archive"); resp.Archived != nil || len(resp.Items) != 4 {
+		t.Errorf("without archiveOlderThanDays: %d items, archived = %+v", len(resp.Items), resp.Archived)
+	}
+}
+
+// 公開日時が分からないものは古いとはみなさない
+func TestSplitArchivedKeepsUnknownDates(t *testing.T) {
+	cutoff := time.Date(2024, 12, 1, 0, 0, 0, 0, jst)
+	items := []ResponseItem{
+		{Title: "old", LikeCount: 1, PublishedAt: cutoff.Add(-time.Minute)},
+		{Title: "unknown", LikeCount: 2},
+		{Title: "new", LikeCount: 3, PublishedAt: cutoff},
+	}
+	recent, archived := splitArchived(items, cutoff)
+	if len(recent) != 2 || recent[0].Title != "unknown" || recent[1].Title != "new" {
+		t.Errorf("recent = %+v", recent)
+	}
+	if archived != (ArchiveSummary{Count: 1, TotalLikes: 1}) {
+		t.Errorf("archived = %+v", archived)
+	}
+}
+
+// 月曜から日曜の順に、JSTの曜日ごとの件数・合計・平均を返す (リリースの無い曜日は0)
+func TestWeekdayBreakdown(t *testing.T) {
+	items := []ResponseItem{
+		// 2024-12-02 は月曜
+		{PublishedAt: time.Date(2024, 12, 2, 9, 0, 0, 0, jst), LikeCount: 10},
+		{PublishedAt: time.Date(2024, 12, 9, 18, 0, 0, 0, jst), LikeCount: 21},
+		// UTCでは日曜だがJSTでは月曜
+		{PublishedAt: time.Date(2024, 12, 1, 15, 30, 0, 0, time.UTC), LikeCount: 5},
+		{PublishedAt: time.Date(2024, 12, 3, 9, 0, 0, 0, jst), LikeCount: 4},
+		{PublishedAt: time.Date(2024, 12, 8, 23, 59, 0, 0, jst), LikeCount: 7},
+		// 公開日時が分からないものは数えない
+		{LikeCount: 100},
+	}
+	want := []WeekdayStats{
+		{Weekday: "Monday", ReleaseCount: 3, TotalLikes: 36, AverageLikes: 12},
+		{Weekday: "Tuesday", ReleaseCount: 1, TotalLikes: 4, AverageLikes: 4},
+		{Weekday: "Wednesday"},
+		{Weekday: "Thursday"},
+		{Weekday: "Friday"},
+		{Weekday: "Saturday"},
+		{Weekday: "Sunday", ReleaseCount: 1, TotalLikes: 7, AverageLikes: 7},
+	}
+	got := weekdayBreakdown(items)
+	if len(got) != len(want) {
+		t.Fatalf("got %d weekdays, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("weekday %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWeekdayBreakdownParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("weekday", 1, "2024年12月02日 09時00分", 6)
+	f.addRelease("weekday", 2, "2024年12月06日 09時00分", 3)
+	s := NewServer(f.config())
+
+	// limit で切る前の全件を集計する
+	resp := getResponse(t, s, "/prtimes_posts?keyword=weekday&weekdayBreakdown=true&limit=1")
+	if len(resp.WeekdayBreakdown) != 7 {
+		t.Fatalf("weekdayBreakdown = %+v", resp.WeekdayBreakdown)
+	}
+	if monday, friday := resp.WeekdayBreakdown[0], resp.WeekdayBreakdown[4]; monday.TotalLikes != 6 || friday.TotalLikes != 3 {
+		t.Errorf("monday = %+v, friday = %+v", monday, friday)
+	}
+
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=weekday"); resp.WeekdayBreakdown != nil {
+		t.Errorf("weekdayBreakdown without weekdayBreakdown=true: %+v", resp.WeekdayBreakdown)
+	}
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=weekday&weekdayBreakdown=true&mode=ids"); rec.Code != http.StatusBadRequest {
+		t.Errorf("mode=ids: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// bigIntAsString=true の場合に文字列にする集計値の項目
+// JavaScriptの数値 (2^53まで) で精度が落ちる可能性があるいいね数の合計や件数
+var bigIntFields = map[string]bool{
+	"totalLikes":          true,
+	"matchedBeforeFilter": true,
+	"totalMatches":        true,
+	"count":               true,
+	"releaseCount":        true,
+}
+
+// JSONの中の fields の数値を文字列にする (項目の順番は変えない)
+func stringifyNumbers(data []byte, fields map[string]bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	type container struct {
+		object bool
+		count  int
+	}
+	var stack []container
+	var out bytes.Buffer
+	// オブジェクトの中で直前に読んだキー
+	key := ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteByte(byte(delim))
+			continue
+		}
+
+		// 値 (オブジェクトの場合はキー) の前の区切り
+		isKey := false
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.object {
+				isKey = top.count%2 == 0
+				if isKey && top.count > 0 {
+					out.WriteByte(',')
+				} else if !isKey {
+					out.WriteByte(':')
+				}
+			} else if top.count > 0 {
+				out.WriteByte(',')
+			}
+			top.count++
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(v))
+			stack = append(stack, container{object: v == '{'})
+			key = ""
+			continue
+		case json.Number:
+			if fields[key] {
+				out.WriteString(strconv.Quote(v.String()))
+			} else {
+				out.WriteString(v.String())
+			}
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		}
+		if isKey {
+			key = tok.(string)
+		} else {
+			key = ""
+		}
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// 集計値を文字列にしたJSONを書き出す
+func writeJSONBigIntAsString(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		data, err = stringifyNumbers(data, bigIntFields)
+	}
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Println("Error encoding response:", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 項目の順番と、対象外の数値はそのまま
+func TestStringifyNumbers(t *testing.T) {
+	in := `{"totalLikes":9007199254740993,"items":[{"likeCount":3,"count":2}],"nested":{"releaseCount":0,"fraction":0.5},"empty":[],"flag":true,"name":"count"}`
+	want := `{"totalLikes":"9007199254740993","items":[{"likeCount":3,"count":"2"}],"nested":{"releaseCount":"0","fraction":0.5},"empty":[],"flag":true,"name":"count"}` + "\n"
+	got, err := stringifyNumbers([]byte(in), bigIntFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// bigIntAsString=true の場合は封筒の集計値を文字列で返し、各項目の likeCount は数値のまま
+func TestBigIntAsString(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("big", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("big", 2, "2024年12月02日 09時00分", 4)
+	s := NewServer(f.config())
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=big&bigIntAsString=true&summary=true&series=daily")
+	var resp struct {
+		TotalLikes          any `json:"totalLikes"`
+		MatchedBeforeFilter any `json:"matchedBeforeFilter"`
+		Completeness        any `json:"completeness"`
+		Items               []struct {
+			LikeCount any `json:"likeCount"`
+		} `json:"items"`
+		Summary struct {
+			TotalMatches any `json:"totalMatches"`
+			TotalLikes   any `json:"totalLikes"`
+		} `json:"summary"`
+		Series []struct {
+			ReleaseCount any `json:"releaseCount"`
+			TotalLikes   any `json:"totalLikes"`
+		} `json:"series"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range map[string]any{
+		"totalLikes":             resp.TotalLikes,
+		"matchedBeforeFilter":    resp.MatchedBeforeFilter,
+		"summary.totalMatches":   resp.Summary.TotalMatches,
+		"summary.totalLikes":     resp.Summary.TotalLikes,
+		"series[0].releaseCount": resp.Series[0].ReleaseCount,
+		"series[1].totalLikes":   resp.Series[1].TotalLikes,
+	} {
+		if _, ok := v.(string); !ok {
+			t.Errorf("%s = %#v, want a string", name, v)
+		}
+	}
+	if resp.TotalLikes != "7" {
+		t.Errorf("totalLikes = %#v, want \"7\"", resp.TotalLikes)
+	}
+	if _, ok := resp.Items[0].LikeCount.(float64); !ok {
+		t.Errorf("likeCount = %#v, want a number", resp.Items[0].LikeCount)
+	}
+	if _, ok := resp.Completeness.(float64); !ok {
+		t.Errorf("completeness = %#v, want a number", resp.Completeness)
+	}
+
+	// 指定しない場合は数値
+	var plain struct {
+		TotalLikes any `json:"totalLikes"`
+	}
+	json.Unmarshal(serveAPI(t, s, "/prtimes_posts?keyword=big").Body.Bytes(), &plain)
+	if _, ok := plain.TotalLikes.(float64); !ok {
+		t.Errorf("without bigIntAsString: totalLikes = %#v, want a number", plain.TotalLikes)
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache は検索結果のページやいいね数を残しておく先
+// 複数のレプリカで動かす場合は共有できるもの (Redisなど) を使うと、他のレプリカが取得した分も使える
+type Cache interface {
+	// 見つからない場合や期限が過ぎている場合は ok が false
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// ttl が0以下の場合は期限なし
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// 捨てた数を返す
+	Delete(ctx context.Context, keys ...string) (int, error)
+	// prefix で始まるキーを全て捨てて、捨てた数を返す
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// プロセスのメモリ上に持つCache
+// 最近使った max 件だけを残す
+type memoryCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// lru の要素
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache はメモリ上に最大 max 件を持つCacheを返す (超えた場合は最も前に使ったものから捨てる)
+func NewMemoryCache(max int) Cache {
+	return &memoryCache{max: max, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.max <= 0 {
+		return nil
+	}
+	entry := &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, keys ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (c *memoryCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type noCacheKey struct{}
+
+// nocache=1 のリクエストでは、残しておいた検索結果やいいね数を使わずにPR TIMESから取得し直す
+// (取得したものは次のリクエストのために残す)
+func withNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func noCache(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey{}).(bool)
+	return v
+}
+
+// キーワードごとのキーに使う形 (前後の空白と連続する空白は1つにまとめ、エスケープする)
+func keywordCacheKey(keyword string) string {
+	return url.QueryEscape(strings.Join(strings.Fields(keyword), " "))
+}
+
+func likeCountCacheKey(releaseID string) string {
+	return "like:" + releaseID
+}
+
+// LikeCountCacheTTL の間はPR TIMESへ問い合わせずにCacheに残したいいね数を使う
+func (s *Server) cachedLikeCount(ctx context.Context, releaseID string) (int, bool) {
+	if s.cfg.LikeCountCacheTTL <= 0 || noCache(ctx) {
+		return 0, false
+	}
+	value, ok, err := s.cache.Get(ctx, likeCountCacheKey(releaseID))
+	if err != nil {
+		log.Printf("Error reading cached like count for %s: %v", releaseID, err)
+		return 0, false
+	}
+	if !ok {
+		return 0, false
+	}
+	likeCount, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, false
+	}
+	if d := diagnosticsFrom(ctx); d != nil {
+		d.cacheHits.Add(1)
+	}
+	return likeCount, true
+}
+
+// releaseIDs が空の場合は全て捨てる
+func (s *Server) flushCachedLikeCounts(ctx context.Context, releaseIDs []string) (int, error) {
+	if len(releaseIDs) == 0 {
+		return s.cache.DeletePrefix(ctx, "like:")
+	}
+	keys := make([]string, len(releaseIDs))
+	for i, id := range releaseIDs {
+		keys[i] = likeCountCacheKey(id)
+	}
+	return s.cache.Delete(ctx, keys...)
+}
+
+func (s *Server) cacheLikeCount(ctx context.Context, releaseID string, likeCount int) {
+	if s.cfg.LikeCountCacheTTL <= 0 {
+		return
+	}
+	if err := s.cache.Set(ctx, likeCountCacheKey(releaseID), []byte(strconv.Itoa(likeCount)), s.cfg.LikeCountCacheTTL); err != nil {
+		log.Printf("Error caching like count for %s: %v", releaseID, err)
+	}
+}
@@ -0,0 +1,525 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxRetries     = 3
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// バックオフのジッター方式 (AWSの分類に準拠)
+//   - none:  base*2^n をそのまま待つ。予測しやすいが、同時に失敗したリクエストが同時に再試行する
+//   - full:  0〜base*2^n の一様乱数。負荷は最も分散するが、待ち時間が極端に短くなることがある
+//   - equal: base*2^n/2 + 0〜base*2^n/2 の一様乱数。最低限の待ち時間を保ちつつ分散させる
+const (
+	jitterNone  = "none"
+	jitterFull  = "full"
+	jitterEqual = "equal"
+)
+
+// attempt回目 (0始まり) の再試行前に待つ時間
+func backoffDelay(attempt int, strategy string, rnd *rand.Rand) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	switch strategy {
+	case jitterNone:
+		return delay
+	case jitterEqual:
+		half := delay / 2
+		return half + time.Duration(rnd.Int63n(int64(half)+1))
+	default:
+		return time.Duration(rnd.Int63n(int64(delay) + 1))
+	}
+}
+
+// Cookieを取得するための事前リクエスト (Jarが無い場合は何もしない)
+func (s *Server) preflight(ctx context.Context) {
+	if s.client.Jar == nil {
+		return
+	}
+	s.preflightOnce.Do(func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.PreflightURL, nil)
+		if err != nil {
+			log.Println("Error creating preflight request:", err)
+			return
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			log.Println("Error during preflight request:", err)
+			return
+		}
+		resp.Body.Close()
+	})
+}
+
+// 事前リクエストを済ませてからGETする
+// PR TIMESからの読み取りは全てここを通し、再試行もここでだけ行う
+func (s *Server) httpGet(ctx context.Context, url string) (*http.Response, error) {
+	return s.httpGetWithHeader(ctx, url, nil)
+}
+
+// header をリクエストに加えて取得する
+func (s *Server) httpGetWithHeader(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	s.preflight(ctx)
+
+	fetch := func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return s.doWithRetry(ctx, req)
+	}
+	// ヘッダーを加える条件付きリクエストと、同時に送る数を指定したリクエストはまとめない
+	if _, overridden := concurrencyLimit(ctx); s.debounce != nil && len(header) == 0 && !overridden {
+		return s.debounce.get(ctx, url, fetch)
+	}
+	return fetch(ctx)
+}
+
+// 副作用の無い (何度送っても結果が変わらない) メソッドか
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// 通信エラー (接続のリセットや HTTPTimeout 超過を含む) と5xx、429の場合はバックオフを挟んで再試行する
+// 404 などそれ以外のステータスは再試行せずにすぐ返す
+// 状態を変えるリクエストを二重に送らないよう、GET等以外は再試行せずに1回だけ送る
+func (s *Server) doWithRetry(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req.Method) {
+		return s.do(ctx, req)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = s.do(ctx, req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		if attempt >= maxRetries {
+			break
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		s.retryRandMu.Lock()
+		delay := backoffDelay(attempt, s.cfg.RetryJitter, s.retryRand)
+		s.retryRandMu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return resp, err
+}
+
+// レート制限の残り回数が無い場合はリセットまで待ってから送る
+// リクエストごとに同時に送る数が指定されている場合は、MaxConcurrency の代わりにその数の枠が空くまで待つ
+func (s *Server) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	release, overridden, err := acquireConcurrency(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// 検索やいいね数の取得のgoroutineがいくつあっても、同時に送るのは MaxConcurrency まで
+	if s.upstream != nil && !overridden {
+		waitStart := time.Now()
+		select {
+		case s.upstream <- struct{}{}:
+			defer func() { <-s.upstream }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if d := diagnosticsFrom(ctx); d != nil {
+			d.upstreamWait.Add(int64(time.Since(waitStart)))
+		}
+	}
+	if err := s.rateLimit.wait(ctx); err != nil {
+		return nil, err
+	}
+	if d := diagnosticsFrom(ctx); d != nil {
+		d.upstreamCalls.Add(1)
+	}
+	resp, err := s.client.Do(req)
+	if err == nil {
+		s.rateLimit.update(resp.Header)
+	}
+	return resp, err
+}
+
+type PRTimesResponse struct {
+	Data struct {
+		CurrentPage int       `json:"current_page"`
+		LastPage    int       `json:"last_page"`
+		ReleaseList []Release `json:"release_list"`
+	} `json:"data"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// レスポンスが途中で切れていて、読めた分のリリースだけが入っている
+	Partial bool `json:"-"`
+}
+
+type Release struct {
+	CompanyName  string `json:"company_name"`
+	Title        string `json:"title"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ReleaseURL   string `json:"release_url"`
+	ReleasedAt   string `json:"released_at"`
+	// リリースの種類 (商品サービス、イベント、調査レポートなど)。返ってこない場合もある
+	Tags []string `json:"tags"`
+}
+
+type LikeCountResponse struct {
+	Data struct {
+		LikeCount int `json:"like_count"`
+	} `json:"data"`
+}
+
+type ResponseItem struct {
+	ReleaseID       string    `json:"-"`
+	CorporationName string    `json:"corporationName"`
+	PublishedDate   string    `json:"publishdDatetime"`
+	PublishedAt     time.Time `json:"publishedAt"`
+	ThumbnailURL    string    `json:"thumbnailUrl"`
+	PostURL         string    `json:"postUrl"`
+	Title           string    `json:"title"`
+	LikeCount       int       `json:"likeCount"`
+	// PR TIMESがリリースの種類を返した場合のみ
+	Tags []string `json:"tags,omitempty"`
+	// includeHost=true の場合のみ、PostURLのホスト (URLとして読めない場合は含めない)
+	Host string `json:"host,omitempty"`
+	// debug=true の場合のみ、いいね数の取得結果を入れる
+	LikeCountStatus string `json:"likeCountStatus,omitempty"`
+	// enrichThumbnails=true の場合のみ
+	ThumbnailWidth  int `json:"thumbnailWidth,omitempty"`
+	ThumbnailHeight int `json:"thumbnailHeight,omitempty"`
+	// tiers=true の場合のみ、いいね数の段階 (viral, high, medium, low)
+	Tier string `json:"tier,omitempty"`
+	// sparkline=true の場合のみ、いいね数の推移 (古い順)
+	Sparkline []LikeSample `json:"sparkline,omitempty"`
+	// engagementRate=true で企業のフォロワー数が分かる場合のみ、いいね数 / フォロワー数
+	EngagementRate *float64 `json:"engagementRate,omitempty"`
+	// includeFreshness=true で公開日時が分かる場合のみ、公開からの経過時間に応じた新しさ (公開直後が1、FreshnessHalfLife ごとに半分)
+	Freshness *float64 `json:"freshness,omitempty"`
+	// includeTitleLength=true の場合のみ、タイトルの文字数 (バイト数ではなくrune数)
+	TitleLength int `json:"titleLength,omitempty"`
+	// compareSnapshot を指定した場合のみ、前回の結果からの順位の変化
+	RankChange *RankChange `json:"rankChange,omitempty"`
+}
+
+// いいね数の取得結果
+const (
+	likeCountStatusOK          = "ok"
+	likeCountStatusCached      = "cached"
+	likeCountStatusFailed      = "failed"
+	likeCountStatusSkipped     = "skipped"
+	likeCountStatusUnavailable = "unavailable"
+)
+
+// JSONで返すレスポンス
+type Response struct {
+	// レスポンスの形の版 (Accept-Version で v1 を指定した場合はこの形ではなく項目の配列だけを返す)
+	APIVersion string `json:"apiVersion"`
+	// 結果を取得したキーワード (fallbackKeyword を使った場合はそちら)
+	Keyword string         `json:"keyword,omitempty"`
+	Items   []ResponseItem `json:"items"`
+	// 絞り込み後、limitで切る前の全件のいいね数の合計
+	TotalLikes int `json:"totalLikes"`
+	// リクエストを受けてからレスポンスを書き出す直前までの時間 (ミリ秒)
+	ServerProcessingMs int64 `json:"serverProcessingMs"`
+	// snapshotId を指定した場合のみ
+	SnapshotID string `json:"snapshotId,omitempty"`
+	// compareSnapshot を指定した場合のみ、前回の結果にあって今回の結果に無いリリース
+	DroppedItems []DroppedItem `json:"droppedItems,omitempty"`
+	// samplePages を指定した場合のみ、取得したページと割合
+	Sample *SampleInfo `json:"sample,omitempty"`
+	// 結果が不完全な場合などの注意
+	Warnings []string `json:"warnings,omitempty"`
+	// 絞り込む前にキーワードに一致した件数 (items が空の場合に、一致しなかったのか絞り込みで無くなったのかを区別する)
+	MatchedBeforeFilter int `json:"matchedBeforeFilter"`
+	// タイムアウトして取得できた分だけを返している
+	Partial bool `json:"partial,omitempty"`
+	// 検索結果が多すぎるため、サーバーの上限までで打ち切った
+	Truncated bool `json:"truncated,omitempty"`
+	// 検索結果のページのうち取得できた割合 (0〜1)。打ち切らずに全ページを取得できた場合は1
+	Completeness float64 `json:"completeness"`
+	// 次に取得し直すまでの目安の秒数 (これより早く取得しても同じ結果になる)
+	NextRefreshAfter int `json:"nextRefreshAfter,omitempty"`
+	// minResults に満たず、語ごとに検索し直した場合のキーワード
+	BroadenedKeywords []string `json:"broadenedKeywords,omitempty"`
+	// expandScript=true で追加で検索したキーワード
+	ExpandedKeywords []string `json:"expandedKeywords,omitempty"`
+	// groupBy=day の場合のみ
+	Days []DayBucket `json:"days,omitempty"`
+	// archiveOlderThanDays を指定した場合のみ、items から除いた古いリリースの集計
+	Archived *ArchiveSummary `json:"archived,omitempty"`
+	// summary=true の場合のみ、絞り込む前の取得した全件の集計
+	Summary *Summary `json:"summary,omitempty"`
+	// series=daily の場合のみ、絞り込み後、limitで切る前の全件の日ごとの件数
+	Series []SeriesPoint `json:"series,omitempty"`
+	// weekdayBreakdown=true の場合のみ、絞り込み後、limitで切る前の全件の曜日ごとの件数といいね数
+	WeekdayBreakdown []WeekdayStats `json:"weekdayBreakdown,omitempty"`
+	// debug=true の場合のみ
+	Debug *DebugInfo `json:"debug,omitempty"`
+	// X-Debug: true の場合のみ
+	Diagnostics *DiagnosticsInfo `json:"_debug,omitempty"`
+}
+
+type DebugInfo struct {
+	Pages        []PageDebug   `json:"pages"`
+	DedupeReport *DedupeReport `json:"dedupeReport,omitempty"`
+}
+
+// 重複として取り除いたリリースとページ
+type DedupeReport struct {
+	// 複数のページに含まれていて、2回目以降を取り除いたリリースの数
+	Collapsed int `json:"collapsed"`
+	// 取り除いたリリースのURL (最初の数件)
+	Examples []string `json:"examples,omitempty"`
+	// 直前のページと同じ内容だったため、それ以降を捨てたページ
+	DuplicatePage int `json:"duplicatePage,omitempty"`
+}
+
+// PR TIMESの各ページの取得結果
+type PageDebug struct {
+	Page     int    `json:"page"`
+	Status   int    `json:"status"`
+	Message  string `json:"message"`
+	Releases int    `json:"releases"`
+	Partial  bool   `json:"partial,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// mode=ids で返す最小限の項目
+type ReleaseIDItem struct {
+	ID      string `json:"id"`
+	PostURL string `json:"postUrl"`
+}
+
+const modeIDs = "ids"
+
+const groupByDayParam = "day"
+
+const seriesDailyParam = "daily"
+
+// レスポンスの形式
+const (
+	formatJSON     = "json"
+	formatProtobuf = "protobuf"
+	formatHTML     = "html"
+)
+
+// 検索APIの1ページあたりの件数
+const searchPageSize = 40
+
+// 検索APIが404を返した (APIのパスが変わった・無くなった)
+var errSearchNotFound = errors.New("search endpoint returned 404")
+
+// キーワードに当てはまるページが多すぎるため取得しなかった (limit を指定しなかった場合)
+type tooManyPagesError struct {
+	pages int
+	max   int
+}
+
+func (e *tooManyPagesError) Error() string {
+	return fmt.Sprintf("keyword matches %d pages, more than %d", e.pages, e.max)
+}
+
+// ErrUpstreamContentType はPR TIMESがJSONの代わりにHTML (メンテナンス中のページなど) を返した場合のエラー
+var ErrUpstreamContentType = errors.New("unexpected content type from upstream")
+
+// Content-TypeがJSONでない場合は ErrUpstreamContentType を返す
+// StrictContentType が無効な場合と、Content-Typeが無い場合は確認しない
+func (s *Server) checkContentType(resp *http.Response) error {
+	if !s.cfg.StrictContentType {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUpstreamContentType, contentType)
+}
+
+func (s *Server) fetchPRTimesData(ctx context.Context, keyword string, page int) (*PRTimesResponse, error) {
+	escapedKeyword := url.QueryEscape(keyword)
+	url := fmt.Sprintf("%s/api/keyword_search.php/search?keyword=%s&page=%d&limit=%d", s.cfg.BaseURL, escapedKeyword, page, searchPageSize)
+	ctx, span := s.tracer.Start(ctx, "prtimes.search", trace.WithAttributes(attribute.Int("prtimes.page", page)))
+	defer span.End()
+	if d := diagnosticsFrom(ctx); d != nil {
+		d.searchCalls.Add(1)
+	}
+	// 前回取得したページがある場合は、変わっていなければ 304 を返してもらう
+	var cached *PRTimesResponse
+	header := make(http.Header)
+	if s.pageCache != nil {
+		var lastModified string
+		var ok bool
+		if cached, lastModified, ok = s.pageCache.get(ctx, keyword, page); ok {
+			header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	resp, err := s.httpGetWithHeader(ctx, url, header)
+	recordUpstream(span, url, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		span.SetAttributes(attribute.Bool("prtimes.not_modified", true))
+		return cached, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errSearchNotFound
+	case resp.StatusCode >= http.StatusBadRequest:
+		return nil, fmt.Errorf("search returned status %d", resp.StatusCode)
+	}
+	if err := s.checkContentType(resp); err != nil {
+		return nil, err
+	}
+
+	var prTimesResp *PRTimesResponse
+	if s.cfg.TolerantDecode {
+		prTimesResp, err = decodePRTimesResponse(resp.Body)
+	} else {
+		prTimesResp = &PRTimesResponse{}
+		err = json.NewDecoder(resp.Body).Decode(prTimesResp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 途中で切れたページは次に 304 で使わないように残さない
+	if prTimesResp.Partial {
+		log.Printf("Response for page %d was truncated, recovered %d releases", page, len(prTimesResp.Data.ReleaseList))
+	} else if s.pageCache != nil {
+		lastModified := resp.Header.Get("Last-Modified")
+		if lastModified == "" {
+			lastModified = time.Now().UTC().Format(http.TimeFormat)
+		}
+		s.pageCache.put(ctx, keyword, page, prTimesResp, lastModified)
+	}
+
+	return prTimesResp, nil
+}
+
+// 同じリリースのいいね数を同時に取得しようとした場合はPR TIMESへのリクエストを1回にまとめる
+// まとめた取得は最初に呼んだ側が切断されても続け、そのリクエストのタイムアウトや同時実行数の制限を他に持ち込まない
+// nocache の場合と、同時に送る数を指定したリクエスト (その数で全体の上限を超えることがある) はまとめずに取得する
+func (s *Server) fetchLikeCount(ctx context.Context, releaseID string) (int, error) {
+	if _, ok := concurrencyLimit(ctx); ok || noCache(ctx) {
+		return s.fetchLikeCountOnce(ctx, releaseID)
+	}
+	ch := s.likeCountGroup.DoChan(releaseID, func() (any, error) {
+		sharedCtx, cancel := s.sharedFetchContext(ctx)
+		defer cancel()
+		return s.fetchLikeCountOnce(sharedCtx, releaseID)
+	})
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return 0, res.Err
+		}
+		return res.Val.(int), nil
+	}
+}
+
+// 複数のリクエストでまとめて取得する場合のctx
+// 呼んだリクエストのキャンセルと期限、リクエストごとの値 (同時実行数の制限、nocache、診断情報) を引き継がず、RequestTimeout を期限にする
+// トレースの親子関係は残す
+func (s *Server) sharedFetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = detachedContext{context.WithoutCancel(ctx)}
+	if s.cfg.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (c detachedContext) Value(key any) any {
+	switch key.(type) {
+	case concurrencyKey, noCacheKey, diagnosticsKey:
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+func (s *Server) fetchLikeCountOnce(ctx context.Context, releaseID string) (int, error) {
+	if likeCount, ok := s.cachedLikeCount(ctx, releaseID); ok {
+		return likeCount, nil
+	}
+	url := fmt.Sprintf("%s/api/press_release.php/press_release/%s/like_count", s.cfg.BaseURL, releaseID)
+	ctx, span := s.tracer.Start(ctx, "prtimes.like_count", trace.WithAttributes(attribute.String("prtimes.release_id", releaseID)))
+	defer span.End()
+	if d := diagnosticsFrom(ctx); d != nil {
+		d.likeCountCalls.Add(1)
+	}
+	resp, err := s.httpGet(ctx, url)
+	recordUpstream(span, url, resp, err)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// 再試行しても失敗した場合や 404 などは、0件として扱ったりキャッシュしたりせずに失敗とする
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return 0, fmt.Errorf("like count returned status %d", resp.StatusCode)
+	}
+	if err := s.checkContentType(resp); err != nil {
+		return 0, err
+	}
+
+	var likeResp LikeCountResponse
+	if err := json.NewDecoder(resp.Body).Decode(&likeResp); err != nil {
+		return 0, err
+	}
+	s.cacheLikeCount(ctx, releaseID, likeResp.Data.LikeCount)
+
+	return likeResp.Data.LikeCount, nil
+}
+
+func extractReleaseID(releaseURL string) string {
+	re := regexp.MustCompile(`/main/html/rd/p/([0-9]+)\.([0-9]+)\.html`)
+	matches := re.FindStringSubmatch(releaseURL)
+	if len(matches) == 3 {
+		return fmt.Sprintf("%s.%s", matches[1], matches[2])
+	}
+	return ""
+}
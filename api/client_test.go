@@ -0,0 +1,461 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 事前リクエストで受け取ったCookieが、その後の検索といいね数の取得に付くこと
+func TestPreflightCookieIsSentOnLaterRequests(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("テスト", 1, "2024年12月01日 09時00分", 3)
+	var preflights, withoutCookie atomic.Int64
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/" {
+			preflights.Add(1)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			w.WriteHeader(http.StatusOK)
+			return true
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			withoutCookie.Add(1)
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.Preflight = true
+	s := NewServer(cfg)
+
+	for range 2 {
+		if _, err := s.fetchPRTimesData(context.Background(), "テスト", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.fetchLikeCount(context.Background(), fakeReleaseID(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := preflights.Load(); got != 1 {
+		t.Errorf("preflight requests = %d, want 1", got)
+	}
+	if got := withoutCookie.Load(); got != 0 {
+		t.Errorf("%d requests were sent without the preflight cookie", got)
+	}
+	if f.searchCalls.Load() == 0 || f.likeCalls.Load() == 0 {
+		t.Errorf("search calls = %d, like calls = %d, want both > 0", f.searchCalls.Load(), f.likeCalls.Load())
+	}
+}
+
+// PreflightURL を指定した場合はそちらへ事前リクエストを送る
+func TestPreflightURL(t *testing.T) {
+	f := newFakeUpstream(t)
+	var preflightPath atomic.Value
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			preflightPath.Store(r.URL.Path)
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.Preflight = true
+	cfg.PreflightURL = f.URL + "/topics"
+	s := NewServer(cfg)
+	if _, err := s.fetchPRTimesData(context.Background(), "テスト", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := preflightPath.Load().(string); got != "/topics" {
+		t.Errorf("preflight path = %q, want /topics", got)
+	}
+}
+
+// ジッター方式ごとに、待ち時間が base*2^n (retryMaxDelay まで) に対して決まった範囲に収まること
+func TestBackoffDelay(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, strategy := range []string{jitterNone, jitterFull, jitterEqual} {
+		for attempt := 0; attempt < 8; attempt++ {
+			ceiling := min(retryBaseDelay<<attempt, retryMaxDelay)
+			var low time.Duration
+			switch strategy {
+			case jitterNone:
+				low = ceiling
+			case jitterEqual:
+				low = ceiling / 2
+			}
+			for range 100 {
+				delay := backoffDelay(attempt, strategy, rnd)
+				if delay < low || delay > ceiling {
+					t.Fatalf("%s attempt %d: delay %v not in [%v, %v]", strategy, attempt, delay, low, ceiling)
+				}
+			}
+		}
+	}
+}
+
+// 同じシードからは同じ待ち時間になる
+func TestBackoffDelaySeeded(t *testing.T) {
+	a := rand.New(rand.NewSource(42))
+	b := rand.New(rand.NewSource(42))
+	for attempt := 0; attempt < 4; attempt++ {
+		if x, y := backoffDelay(attempt, jitterFull, a), backoffDelay(attempt, jitterFull, b); x != y {
+			t.Fatalf("attempt %d: %v != %v", attempt, x, y)
+		}
+	}
+}
+
+// 再試行するのはGET等の読み取りだけで、状態を変えるリクエストは失敗しても1回だけ送る
+func TestRetryOnlyIdempotentRequests(t *testing.T) {
+	f := newFakeUpstream(t)
+	var gets, posts atomic.Int64
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPost {
+			posts.Add(1)
+		} else {
+			gets.Add(1)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}
+	s := NewServer(f.config())
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req, err := http.NewRequest(method, f.URL+"/state", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s.doWithRetry(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: status %d, want 503", method, resp.StatusCode)
+		}
+	}
+	if got := gets.Load(); got != maxRetries+1 {
+		t.Errorf("GET was sent %d times, want %d", got, maxRetries+1)
+	}
+	if got := posts.Load(); got != 1 {
+		t.Errorf("POST was sent %d times, want 1", got)
+	}
+}
+
+type countingSink struct {
+	writes chan CrawlRecord
+}
+
+func (s *countingSink) Write(record CrawlRecord) error {
+	s.writes <- record
+	return errors.New("sink is down")
+}
+
+// 読み取りを再試行した場合も、結果の書き込みは1回だけで、書き込みに失敗しても再試行しない
+func TestSinkWriteIsNotRetried(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("sink", 1, "2024年12月01日 09時00分", 1)
+	var failed atomic.Bool
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/keyword_search.php/search" && !failed.Swap(true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return true
+		}
+		return false
+	}
+	sink := &countingSink{writes: make(chan CrawlRecord, 10)}
+	cfg := f.config()
+	cfg.ResultSink = sink
+	s := NewServer(cfg)
+	captureLog(t)
+
+	getResponse(t, s, "/prtimes_posts?keyword=sink")
+	if got := f.searchCalls.Load(); got != 1 {
+		t.Errorf("successful search calls = %d, want 1 after the retry", got)
+	}
+	select {
+	case record := <-sink.writes:
+		if record.Keyword != "sink" || len(record.Items) != 1 {
+			t.Errorf("unexpected record %+v", record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the result was not written to the sink")
+	}
+	select {
+	case <-sink.writes:
+		t.Error("the failed sink write was retried")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// 同じリリースのいいね数を同時に取得しても、PR TIMESへのリクエストは1回だけ
+func TestFetchLikeCountSharesInFlightRequest(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("shared", 1, "2024年12月01日 09時00分", 7)
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasSuffix(r.URL.Path, "/like_count") {
+			arrived <- struct{}{}
+			<-release
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.LikeCountCacheTTL = 0
+	s := NewServer(cfg)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make(chan int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			likes, err := s.fetchLikeCount(context.Background(), fakeReleaseID(1))
+			if err != nil {
+				t.Error(err)
+			}
+			results <- likes
+		}()
+	}
+	<-arrived
+	// 他の呼び出しが取得中のリクエストに合流するのを待つ
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := f.likeCalls.Load(); got != 1 {
+		t.Errorf("like_count calls = %d, want 1", got)
+	}
+	for likes := range results {
+		if likes != 7 {
+			t.Errorf("likes = %d, want 7", likes)
+		}
+	}
+}
+
+// 最初に取得を始めたリクエストが切断されても、合流した他のリクエストはいいね数を受け取る
+func TestFetchLikeCountFirstCallerCancelled(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("shared", 1, "2024年12月01日 09時00分", 7)
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasSuffix(r.URL.Path, "/like_count") {
+			arrived <- struct{}{}
+			<-release
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.LikeCountCacheTTL = 0
+	s := NewServer(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.fetchLikeCount(ctx, fakeReleaseID(1))
+		firstErr <- err
+	}()
+	<-arrived
+	type result struct {
+		likes int
+		err   error
+	}
+	second := make(chan result, 1)
+	go func() {
+		likes, err := s.fetchLikeCount(context.Background(), fakeReleaseID(1))
+		second <- result{likes, err}
+	}()
+	// 2つ目の呼び出しが取得中のリクエストに合流するのを待つ
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller: err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if got := <-second; got.err != nil || got.likes != 7 {
+		t.Errorf("second caller: likes = %d, err = %v; want 7", got.likes, got.err)
+	}
+	if got := f.likeCalls.Load(); got != 1 {
+		t.Errorf("like_count calls = %d, want 1", got)
+	}
+}
+
+// JSONの代わりにメンテナンス中のHTMLが200で返ってきた場合
+func TestUpstreamHTMLContentType(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/keyword_search.php/search" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><body>メンテナンス中です</body></html>"))
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+	captureLog(t)
+
+	_, err := s.fetchPRTimesData(context.Background(), "maintenance", 1)
+	if !errors.Is(err, ErrUpstreamContentType) {
+		t.Fatalf("err = %v, want ErrUpstreamContentType", err)
+	}
+	if !strings.Contains(err.Error(), "text/html") {
+		t.Errorf("err = %v, want the content type in the message", err)
+	}
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=maintenance"); rec.Code != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", rec.Code)
+	}
+}
+
+// StrictContentType を無効にした場合は、text/html と表示されたJSONも読む
+func TestUpstreamMislabeledJSON(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("mislabeled", 1, "2024年12月01日 09時00分", 4)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Content-Type", "text/html")
+		return false
+	}
+	cfg := f.config()
+	cfg.StrictContentType = false
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=mislabeled")
+	if len(resp.Items) != 1 || resp.Items[0].LikeCount != 4 {
+		t.Errorf("items = %+v", resp.Items)
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	for contentType, ok := range map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/problem+json":        true,
+		"":                                true,
+		"text/html":                       false,
+		"text/plain; charset=utf-8":       false,
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if contentType != "" {
+			resp.Header.Set("Content-Type", contentType)
+		}
+		if err := s.checkContentType(resp); (err == nil) != ok {
+			t.Errorf("%q: err = %v, want ok %v", contentType, err, ok)
+		}
+	}
+}
+
+// いいね数の取得で 503 が2回続いても、再試行して3回目の結果を使う
+func TestFetchLikeCountRetriesUnavailable(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("retry", 1, "2024年12月01日 09時00分", 42)
+	var attempts atomic.Int64
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/like_count") {
+			return false
+		}
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=retry&debug=true")
+	if len(resp.Items) != 1 || resp.Items[0].LikeCount != 42 || resp.Items[0].LikeCountStatus != likeCountStatusOK {
+		t.Errorf("items = %+v, want 42 likes", resp.Items)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("like count was requested %d times, want 3", got)
+	}
+}
+
+// 再試行しても成功しない場合や 404 の場合は failed とし、いいね数をキャッシュしない
+func TestFetchLikeCountPermanentFailure(t *testing.T) {
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusNotFound} {
+		f := newFakeUpstream(t)
+		f.addRelease("fail", 1, "2024年12月01日 09時00分", 42)
+		var attempts atomic.Int64
+		f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+			if !strings.HasSuffix(r.URL.Path, "/like_count") {
+				return false
+			}
+			attempts.Add(1)
+			// 本文はいいね数として読める形にしておき、ステータスで失敗とすることを確かめる
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"data":{"like_count":0}}`))
+			return true
+		}
+		cfg := f.config()
+		cfg.RetryJitter = jitterNone
+		s := NewServer(cfg)
+		logs := captureLog(t)
+
+		resp := getResponse(t, s, "/prtimes_posts?keyword=fail&debug=true")
+		if len(resp.Items) != 1 || resp.Items[0].LikeCountStatus != likeCountStatusFailed {
+			t.Errorf("status %d: items = %+v, want failed", status, resp.Items)
+		}
+		want := int64(1)
+		if status == http.StatusServiceUnavailable {
+			want = maxRetries + 1
+		}
+		if got := attempts.Load(); got != want {
+			t.Errorf("status %d: like count was requested %d times, want %d", status, got, want)
+		}
+		if _, ok := s.cachedLikeCount(context.Background(), fakeReleaseID(1)); ok {
+			t.Errorf("status %d: the failed like count was cached", status)
+		}
+		if !strings.Contains(logs.String(), fmt.Sprintf("like count returned status %d", status)) {
+			t.Errorf("status %d: the failure was not logged: %q", status, logs.String())
+		}
+	}
+}
+
+// PR TIMESが応答しない場合は HTTPTimeout で打ち切る
+// いいね数は再試行しても取れなければ0件の failed にし、1ページ目はリクエスト全体のエラーにする
+func TestHTTPTimeout(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("slow", 1, "2024年12月01日 09時00分", 42)
+	var hangSearch atomic.Bool
+	var likeAttempts atomic.Int64
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/like_count"):
+			likeAttempts.Add(1)
+		case r.URL.Path == "/api/keyword_search.php/search" && hangSearch.Load():
+		default:
+			return false
+		}
+		<-r.Context().Done()
+		return true
+	}
+	cfg := f.config()
+	cfg.HTTPTimeout = 50 * time.Millisecond
+	cfg.RetryJitter = jitterNone
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+	captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=slow&debug=true")
+	if len(resp.Items) != 1 || resp.Items[0].LikeCount != 0 || resp.Items[0].LikeCountStatus != likeCountStatusFailed {
+		t.Errorf("items = %+v, want 0 likes and failed", resp.Items)
+	}
+	if got := likeAttempts.Load(); got != maxRetries+1 {
+		t.Errorf("like count was requested %d times, want %d", got, maxRetries+1)
+	}
+
+	hangSearch.Store(true)
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=slow"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("search timed out: status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// レスポンスの圧縮方式
+const (
+	compressionNone    = "none"
+	compressionGzip    = "gzip"
+	compressionDeflate = "deflate"
+)
+
+func isValidCompression(v string) bool {
+	switch v {
+	case compressionNone, compressionGzip, compressionDeflate:
+		return true
+	}
+	return false
+}
+
+// 圧縮レベルは flate.HuffmanOnly (-2) 〜 flate.BestCompression (9)
+func isValidCompressionLevel(level int) bool {
+	return level >= flate.HuffmanOnly && level <= flate.BestCompression
+}
+
+// Accept-Encoding に encoding が含まれているか (q=0 のものは含まれていないものとする)
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// クライアントが Accept-Encoding で設定した方式に対応している場合だけ圧縮して返す
+// 対応していない場合は圧縮しない
+func (s *Server) compress(next http.Handler) http.Handler {
+	if s.cfg.Compression == "" || s.cfg.Compression == compressionNone {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), s.cfg.Compression) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: s.cfg.Compression, level: s.cfg.CompressionLevel}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// 最初に書き込む時点で Content-Encoding を付けて圧縮を始めるResponseWriter
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	level    int
+
+	wroteHeader bool
+	// nil の場合は圧縮せずにそのまま書く
+	zw io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	// 本文の無いレスポンスや、既に圧縮されているものはそのまま返す
+	h := w.Header()
+	if status != http.StatusNoContent && status != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == compressionGzip {
+			w.zw, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		} else {
+			// HTTPの deflate は zlib 形式
+			w.zw, _ = zlib.NewWriterLevel(w.ResponseWriter, w.level)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.zw.Write(b)
+}
+
+// ストリーミングで返す場合に、圧縮済みの分を途中で送れるようにする
+func (w *compressWriter) Flush() {
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	return w.zw.Close()
+}
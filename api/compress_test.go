@@ -0,0 +1,117 @@
+package api
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Accept-Encoding を付けてAPIへ target をGETする
+func serveCompressed(t *testing.T, s *Server, target, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+// 設定した方式で圧縮し、Content-Encoding を付けて返す
+func TestCompressionAlgorithm(t *testing.T) {
+	tests := []struct {
+		compression string
+		newReader   func(io.Reader) (io.Reader, error)
+	}{
+		{compressionGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{compressionDeflate, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			f := newFakeUpstream(t)
+			f.addRelease("AI", 1, "2024年12月01日 10時00分", 5)
+			cfg := f.config()
+			cfg.Compression = tt.compression
+			cfg.CompressionLevel = flate.BestCompression
+			s := NewServer(cfg)
+
+			rec := serveCompressed(t, s, "/prtimes_posts?keyword=AI", "br, "+tt.compression+";q=0.8")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.compression {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.compression)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q", got)
+			}
+			zr, err := tt.newReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp Response
+			if err := json.NewDecoder(zr).Decode(&resp); err != nil {
+				t.Fatalf("decoding the compressed body: %v", err)
+			}
+			if len(resp.Items) != 1 {
+				t.Errorf("got %d items", len(resp.Items))
+			}
+		})
+	}
+}
+
+// クライアントが対応していない方式や q=0 の場合、none の設定では圧縮しない
+func TestCompressionNotNegotiated(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("AI", 1, "2024年12月01日 10時00分", 5)
+
+	tests := []struct {
+		name           string
+		compression    string
+		acceptEncoding string
+	}{
+		{"unsupported", compressionDeflate, "gzip"},
+		{"q=0", compressionGzip, "gzip;q=0"},
+		{"none", compressionNone, "gzip, deflate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := f.config()
+			cfg.Compression = tt.compression
+			s := NewServer(cfg)
+
+			rec := serveCompressed(t, s, "/prtimes_posts?keyword=AI", tt.acceptEncoding)
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("body is not plain JSON: %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"gzip, deflate", "deflate", true},
+		{"GZIP", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.5", "gzip", true},
+		{"*", "deflate", true},
+		{"br", "gzip", false},
+		{"", "gzip", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, tt.encoding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.encoding, got, tt.want)
+		}
+	}
+}
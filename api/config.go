@@ -0,0 +1,370 @@
+package api
+
+import (
+	"compress/flate"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultBaseURL = "https://prtimes.jp"
+
+// Config はサーバーの設定
+type Config struct {
+	// PR TIMESのURL
+	BaseURL string
+	// PR TIMESのレスポンスのContent-TypeがJSONでない場合にエラーにするか
+	StrictContentType bool
+	// PR TIMESのレスポンスが release_list の途中で切れていた場合に、読めた分のリリースを使うか
+	// (false の場合はそのページをエラーにする)
+	TolerantDecode bool
+	// 前回取得した検索結果のページを残しておき、If-Modified-Since を付けて取得するか
+	// (304 が返った場合は残しておいたものを使う。PR TIMESが対応していない場合は常に取得し直すだけになる)
+	ConditionalRequests bool
+	// ConditionalRequests で検索結果のページを残しておく期間 (0以下の場合は残さないので ConditionalRequests は使われない)
+	PageCacheTTL time.Duration
+	// PR TIMESへ問い合わせずにCacheに残したいいね数を使う期間 (0以下の場合は毎回取得する)
+	LikeCountCacheTTL time.Duration
+	// ConditionalRequests のページ、LikeCountCacheTTL のいいね数、NegativeCacheTTL の0件のキーワード、ResultCacheTTL の検索結果を残しておく先
+	// (nilの場合はメモリ上に MaxCacheEntries 件まで持つ。複数のレプリカで共有する場合はRedisなどを使う)
+	Cache Cache
+	// PRTIMES_REDIS_URL のRedisへの接続と、期限の無いリクエスト (管理用のAPIなど) での1回のコマンドの時間の上限 (0以下の場合は無制限)
+	RedisTimeout time.Duration
+	// 検索結果が0件だったキーワードを覚えておき、PR TIMESへ問い合わせずに0件として返す期間 (0以下の場合は覚えない)
+	NegativeCacheTTL time.Duration
+	// いいね数まで揃えた検索結果をキーワードごとに残しておき、PR TIMESへ問い合わせずに使う期間 (0以下の場合は残さない)
+	// クライアントに次の取得までの目安 (nextRefreshAfter と Cache-Control) としても返す
+	ResultCacheTTL time.Duration
+	// Cache がnilの場合にメモリ上に残しておく数の上限 (超えた場合は最も前に使ったものから捨てる)
+	MaxCacheEntries int
+	// 最初のリクエスト前にPR TIMESへアクセスしてCookieを取得するか
+	Preflight bool
+	// 事前リクエスト先のURL (空の場合は BaseURL + "/")
+	PreflightURL string
+	// 再試行時のバックオフのジッター方式 (none, full, equal)
+	RetryJitter string
+	// PR TIMESへの1回のリクエスト (本文の読み込みを含む) の時間の上限。超えた場合は通信エラーとして再試行する (0以下の場合は無制限)
+	HTTPTimeout time.Duration
+	// 知らないクエリパラメータを含むリクエストを 400 にするか (リクエストごとに strictParams で変えられる)
+	StrictParams bool
+	// 同じURLをこの期間内に取得し終えていた場合は、PR TIMESへ送らずにその結果を使う (0以下の場合はまとめない)
+	DebounceWindow time.Duration
+	// 全てのリクエストを合わせてPR TIMESへ同時に送るリクエスト (検索のページ・いいね数) の数の上限 (0以下の場合は無制限)
+	MaxConcurrency int
+	// 同時に処理するリクエスト数の上限 (0以下の場合は無制限)
+	MaxInFlight int
+	// 起動時にPR TIMESへ張っておく接続の数 (0以下の場合は何もしない)
+	WarmConnections int
+	// 1回の検索で取得するリリースの数の上限。超えた分は取得しない (0以下の場合は無制限)
+	MaxCrawlItems int
+	// limit を指定しなかった場合に取得するページ数の上限。超える場合は取得せずに 400 を返す (0以下の場合は無制限)
+	MaxPagesWithoutLimit int
+	// 2ページ目以降を一度に取得するページの数 (0以下の場合は全ページを一度に取得する)
+	PageBatchSize int
+	// PageBatchSize ずつ取得する場合にバッチの間に待つ時間
+	PageBatchPause time.Duration
+	// 1リクエストあたりの処理時間の上限 (0以下の場合は無制限)
+	RequestTimeout time.Duration
+	// RequestTimeout のうちこの割合が過ぎたらいいね数の取得をやめ、日付順にして返す (0以下または1以上の場合は使わない)
+	SoftTimeoutFraction float64
+	// Prefer: respond-async で同時に実行するジョブの数の上限
+	MaxJobs int
+	// 終わったジョブの結果を残しておく期間
+	JobTTL time.Duration
+	// snapshotId で保存しておく結果の数の上限 (超えた場合は古いものから捨てる。0以下の場合は保存しない)
+	MaxSnapshots int
+	// snapshotId で保存した結果を使う期間
+	SnapshotTTL time.Duration
+	// 管理用の機能 (concurrency など) を使うのに必要な X-Admin-Key (空の場合は使えない)
+	AdminAPIKey string
+	// concurrency で指定できる値の上限 (MaxConcurrency より大きくてもよい)
+	MaxRequestConcurrency int
+	// X-Debug: true で _debug を返すのに必要な X-API-Key (空の場合は誰でも使える)
+	DebugAPIKey string
+	// デバッグ用のログを出すか
+	DebugLog bool
+	// いいね数をこの数ずつ並行して取得し、全て終わってから次を始める (0以下の場合はページごとに並行して取得する)
+	// LikeCountWorkersMax より優先する
+	LikeCountWaveSize int
+	// いいね数を取得するワーカーの数の上限。設定した場合はページごとではなく、取得するリリースの数に応じた数のワーカーで取得する
+	// (0以下の場合はページごとに並行して取得する)
+	LikeCountWorkersMax int
+	// LikeCountWorkersMax を設定した場合のワーカーの数の下限
+	LikeCountWorkersMin int
+	// LikeCountWorkersMax を設定した場合に、ワーカー1つあたりに割り当てるリリースの数の目安
+	LikeCountItemsPerWorker int
+	// サムネイルのサイズを同時に取得する数
+	ThumbnailConcurrency int
+	// リリース日時の形式 (time.Parseのレイアウト、先頭から順に試す)
+	DateLayouts []string
+	// リリースごとに残すいいね数の履歴の件数 (0以下の場合は残さない)
+	SparklinePoints int
+	// いいね数の履歴を覚えておくキーワードの数の上限 (超えた場合は最も前に使ったものから捨てる)
+	// /release で取得したリリースも1件ごとに1個として数える
+	MaxCachedKeywords int
+	// PostURLから取り除くクエリパラメータ (末尾が * のものは前方一致)
+	StripPostURLParams []string
+	// BaseURL のほかにリリースのURLとして扱うホスト (地域版や提携先のPR TIMESのドメイン)
+	AlternateDomains []string
+	// limit指定時に、前回のいいね数から上位が確定したら残りのいいね数の取得をやめるか
+	TopNShortCircuit bool
+	// sort を指定しなかった場合の並び順 (likes, date)
+	DefaultSort string
+	// includeFreshness=true の場合に、新しさ (freshness) が半分になるまでの公開からの経過時間
+	FreshnessHalfLife time.Duration
+	// thumbnailBoost=true の場合に、サムネイルのあるものを上にするいいね数の差
+	ThumbnailBoostBand int
+	// tiers=true の場合の段階のしきい値
+	Tiers TierThresholds
+	// 結果を返す前に適用するPostProcessor (環境変数からは設定できない)
+	PostProcessors []PostProcessor
+	// トレースを送るOTLP (HTTP) のエンドポイント (空の場合はトレースしない)
+	OTLPEndpoint string
+	// トレースするリクエストの割合 (0〜1)
+	TraceSampleRatio float64
+	// トレースに使うTracerProvider (設定した場合はOTLPEndpointより優先する。環境変数からは設定できない)
+	TracerProvider trace.TracerProvider
+	// 検索結果をレスポンスとは別に書き込む先 (nilの場合は書き込まない)
+	ResultSink ResultSink
+	// 書き込み待ちにしておく検索結果の数の上限 (超えた分は捨てる)
+	ResultSinkBuffer int
+	// レスポンスの圧縮方式 (gzip, deflate, none)。クライアントが Accept-Encoding で対応している場合だけ圧縮する
+	Compression string
+	// 圧縮レベル (-2〜9。-1 は方式ごとの標準、1 は速度優先、9 はサイズ優先)
+	CompressionLevel int
+	// engagementRate=true の場合に使う企業のフォロワー数 (nilの場合は engagementRate を返さない)
+	FollowerCounts FollowerCountSource
+}
+
+// TierThresholds はいいね数の段階 (tier) のしきい値 (いいね数がこの値以上ならその段階)
+type TierThresholds struct {
+	Viral  int
+	High   int
+	Medium int
+}
+
+// DefaultConfig はデフォルトの設定を返す
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:        defaultBaseURL,
+		RetryJitter:    jitterFull,
+		MaxInFlight:    100,
+		RequestTimeout: 60 * time.Second,
+		DefaultSort:    sortLikes,
+		MaxCrawlItems:  10000,
+		MaxJobs:        10,
+		JobTTL:         10 * time.Minute,
+		DateLayouts:    defaultDateLayouts,
+
+		ThumbnailConcurrency:  8,
+		SparklinePoints:       10,
+		MaxCachedKeywords:     1000,
+		Tiers:                 TierThresholds{Viral: 1000, High: 100, Medium: 10},
+		TraceSampleRatio:      1,
+		ResultSinkBuffer:      100,
+		MaxRequestConcurrency: 50,
+		StrictContentType:     true,
+		TolerantDecode:        true,
+		Compression:           compressionGzip,
+		CompressionLevel:      flate.DefaultCompression,
+		MaxSnapshots:          100,
+		SnapshotTTL:           10 * time.Minute,
+		MaxCacheEntries:       10000,
+
+		LikeCountWorkersMin:     1,
+		LikeCountItemsPerWorker: 10,
+		FreshnessHalfLife:       24 * time.Hour,
+		MaxConcurrency:          20,
+		HTTPTimeout:             10 * time.Second,
+		ResultCacheTTL:          5 * time.Minute,
+		RedisTimeout:            5 * time.Second,
+		LikeCountCacheTTL:       time.Minute,
+		PageCacheTTL:            24 * time.Hour,
+	}
+}
+
+// ConfigFromEnv は環境変数から設定を読み込む
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.Preflight = os.Getenv("PRTIMES_PREFLIGHT") == "true"
+	cfg.StrictContentType = os.Getenv("PRTIMES_STRICT_CONTENT_TYPE") != "false"
+	cfg.TolerantDecode = os.Getenv("PRTIMES_TOLERANT_DECODE") != "false"
+	cfg.PreflightURL = os.Getenv("PRTIMES_PREFLIGHT_URL")
+	cfg.ConditionalRequests = os.Getenv("PRTIMES_CONDITIONAL_REQUESTS") == "true"
+	cfg.PageCacheTTL = envDuration("PRTIMES_PAGE_CACHE_TTL", cfg.PageCacheTTL)
+	cfg.LikeCountCacheTTL = envDuration("PRTIMES_LIKE_COUNT_CACHE_TTL", cfg.LikeCountCacheTTL)
+	cfg.NegativeCacheTTL = envDuration("PRTIMES_NEGATIVE_CACHE_TTL", cfg.NegativeCacheTTL)
+	cfg.ResultCacheTTL = envDuration("PRTIMES_RESULT_CACHE_TTL", cfg.ResultCacheTTL)
+	cfg.MaxCacheEntries = envInt("PRTIMES_MAX_CACHE_ENTRIES", cfg.MaxCacheEntries)
+	cfg.RedisTimeout = envDuration("PRTIMES_REDIS_TIMEOUT", cfg.RedisTimeout)
+	if v := os.Getenv("PRTIMES_REDIS_URL"); v != "" {
+		cache, err := NewRedisCache(v, cfg.RedisTimeout)
+		if err != nil {
+			log.Println("Invalid PRTIMES_REDIS_URL, caching in memory:", err)
+		} else {
+			cfg.Cache = cache
+		}
+	}
+	cfg.StrictParams = os.Getenv("PRTIMES_STRICT_PARAMS") == "true"
+	cfg.MaxConcurrency = envInt("PRTIMES_MAX_CONCURRENCY", cfg.MaxConcurrency)
+	cfg.DebounceWindow = envDuration("PRTIMES_DEBOUNCE_WINDOW", cfg.DebounceWindow)
+	cfg.MaxInFlight = envInt("PRTIMES_MAX_IN_FLIGHT", cfg.MaxInFlight)
+	cfg.WarmConnections = envInt("PRTIMES_WARM_CONNECTIONS", cfg.WarmConnections)
+	cfg.RequestTimeout = envDuration("PRTIMES_REQUEST_TIMEOUT", cfg.RequestTimeout)
+	cfg.MaxCrawlItems = envInt("PRTIMES_MAX_CRAWL_ITEMS", cfg.MaxCrawlItems)
+	cfg.MaxPagesWithoutLimit = envInt("PRTIMES_MAX_PAGES_WITHOUT_LIMIT", cfg.MaxPagesWithoutLimit)
+	cfg.PageBatchSize = envInt("PRTIMES_PAGE_BATCH_SIZE", cfg.PageBatchSize)
+	cfg.PageBatchPause = envDuration("PRTIMES_PAGE_BATCH_PAUSE", cfg.PageBatchPause)
+	cfg.MaxJobs = envInt("PRTIMES_MAX_JOBS", cfg.MaxJobs)
+	cfg.JobTTL = envDuration("PRTIMES_JOB_TTL", cfg.JobTTL)
+	cfg.MaxSnapshots = envInt("PRTIMES_MAX_SNAPSHOTS", cfg.MaxSnapshots)
+	cfg.SnapshotTTL = envDuration("PRTIMES_SNAPSHOT_TTL", cfg.SnapshotTTL)
+	cfg.DebugLog = os.Getenv("PRTIMES_DEBUG_LOG") == "true"
+	cfg.DebugAPIKey = os.Getenv("PRTIMES_DEBUG_API_KEY")
+	cfg.AdminAPIKey = os.Getenv("PRTIMES_ADMIN_API_KEY")
+	cfg.MaxRequestConcurrency = envInt("PRTIMES_MAX_REQUEST_CONCURRENCY", cfg.MaxRequestConcurrency)
+	cfg.LikeCountWaveSize = envInt("PRTIMES_LIKE_COUNT_WAVE_SIZE", cfg.LikeCountWaveSize)
+	cfg.LikeCountWorkersMax = envInt("PRTIMES_LIKE_COUNT_WORKERS_MAX", cfg.LikeCountWorkersMax)
+	cfg.LikeCountWorkersMin = envInt("PRTIMES_LIKE_COUNT_WORKERS_MIN", cfg.LikeCountWorkersMin)
+	cfg.LikeCountItemsPerWorker = envInt("PRTIMES_LIKE_COUNT_ITEMS_PER_WORKER", cfg.LikeCountItemsPerWorker)
+	cfg.ThumbnailConcurrency = envInt("PRTIMES_THUMBNAIL_CONCURRENCY", cfg.ThumbnailConcurrency)
+	cfg.SparklinePoints = envInt("PRTIMES_SPARKLINE_POINTS", cfg.SparklinePoints)
+	cfg.MaxCachedKeywords = envInt("PRTIMES_MAX_CACHED_KEYWORDS", cfg.MaxCachedKeywords)
+	cfg.TopNShortCircuit = os.Getenv("PRTIMES_TOPN_SHORT_CIRCUIT") == "true"
+	cfg.FreshnessHalfLife = envDuration("PRTIMES_FRESHNESS_HALF_LIFE", cfg.FreshnessHalfLife)
+	cfg.HTTPTimeout = envDuration("PRTIMES_HTTP_TIMEOUT", cfg.HTTPTimeout)
+	cfg.ThumbnailBoostBand = envInt("PRTIMES_THUMBNAIL_BOOST_BAND", cfg.ThumbnailBoostBand)
+	if v := os.Getenv("PRTIMES_TIER_THRESHOLDS"); v != "" {
+		tiers, err := parseTierThresholds(v)
+		if err != nil {
+			log.Println("Invalid PRTIMES_TIER_THRESHOLDS, using default:", v)
+		} else {
+			cfg.Tiers = tiers
+		}
+	}
+	if v := os.Getenv("PRTIMES_STRIP_POST_URL_PARAMS"); v != "" {
+		cfg.StripPostURLParams = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PRTIMES_ALTERNATE_DOMAINS"); v != "" {
+		cfg.AlternateDomains = strings.Split(v, ",")
+	}
+	cfg.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if v := os.Getenv("PRTIMES_SOFT_TIMEOUT_FRACTION"); v != "" {
+		fraction, err := strconv.ParseFloat(v, 64)
+		if err != nil || fraction < 0 || fraction >= 1 {
+			log.Println("Invalid PRTIMES_SOFT_TIMEOUT_FRACTION, soft timeout is disabled:", v)
+		} else {
+			cfg.SoftTimeoutFraction = fraction
+		}
+	}
+	if v := os.Getenv("PRTIMES_TRACE_SAMPLE_RATIO"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			log.Println("Invalid PRTIMES_TRACE_SAMPLE_RATIO, using default:", v)
+		} else {
+			cfg.TraceSampleRatio = ratio
+		}
+	}
+	if v := os.Getenv("PRTIMES_RESULT_SINK"); v != "" {
+		sink, ok := parseResultSink(v)
+		if !ok {
+			log.Println("Unknown PRTIMES_RESULT_SINK, results will not be written:", v)
+		}
+		cfg.ResultSink = sink
+	}
+	cfg.ResultSinkBuffer = envInt("PRTIMES_RESULT_SINK_BUFFER", cfg.ResultSinkBuffer)
+	if v := os.Getenv("PRTIMES_FOLLOWER_COUNTS"); v != "" {
+		counts, err := loadFollowerCountsFile(v)
+		if err != nil {
+			log.Println("Invalid PRTIMES_FOLLOWER_COUNTS, engagementRate is disabled:", err)
+		} else {
+			cfg.FollowerCounts = counts
+		}
+	}
+	if v := os.Getenv("PRTIMES_DATE_LAYOUTS"); v != "" {
+		cfg.DateLayouts = strings.Split(v, ";")
+	}
+
+	if v := os.Getenv("PRTIMES_DEFAULT_SORT"); v != "" {
+		if v = canonicalSort(v); isValidSort(v) {
+			cfg.DefaultSort = v
+		} else {
+			log.Println("Unknown PRTIMES_DEFAULT_SORT, falling back to likes:", v)
+		}
+	}
+
+	if v := os.Getenv("PRTIMES_COMPRESSION"); v != "" {
+		if isValidCompression(v) {
+			cfg.Compression = v
+		} else {
+			log.Println("Unknown PRTIMES_COMPRESSION, falling back to gzip:", v)
+		}
+	}
+	if level := envInt("PRTIMES_COMPRESSION_LEVEL", cfg.CompressionLevel); isValidCompressionLevel(level) {
+		cfg.CompressionLevel = level
+	} else {
+		log.Println("Invalid PRTIMES_COMPRESSION_LEVEL, using default:", level)
+	}
+
+	switch v := os.Getenv("PRTIMES_RETRY_JITTER"); v {
+	case "":
+	case jitterNone, jitterFull, jitterEqual:
+		cfg.RetryJitter = v
+	default:
+		log.Println("Unknown PRTIMES_RETRY_JITTER, falling back to full:", v)
+	}
+	return cfg
+}
+
+// viral,high,medium の順のカンマ区切り (例: 1000,100,10)
+func parseTierThresholds(v string) (TierThresholds, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 3 {
+		return TierThresholds{}, fmt.Errorf("expected 3 thresholds but got %d", len(parts))
+	}
+	var values [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return TierThresholds{}, err
+		}
+		values[i] = n
+	}
+	if values[0] < values[1] || values[1] < values[2] {
+		return TierThresholds{}, fmt.Errorf("thresholds must be in descending order")
+	}
+	return TierThresholds{Viral: values[0], High: values[1], Medium: values[2]}, nil
+}
+
+// 整数の環境変数を読む (未設定や不正な値の場合はdefを返す)
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s, using default %d: %s", name, def, v)
+		return def
+	}
+	return n
+}
+
+// time.ParseDurationの形式 (例: 5m) の環境変数を読む
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s, using default %s: %s", name, def, v)
+		return def
+	}
+	return d
+}
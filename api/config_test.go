@@ -0,0 +1,78 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigFromEnvRetryJitter(t *testing.T) {
+	for _, tt := range []struct{ env, want string }{
+		{"", jitterFull},
+		{"none", jitterNone},
+		{"equal", jitterEqual},
+		{"bogus", jitterFull},
+	} {
+		t.Setenv("PRTIMES_RETRY_JITTER", tt.env)
+		if got := ConfigFromEnv().RetryJitter; got != tt.want {
+			t.Errorf("PRTIMES_RETRY_JITTER=%q: RetryJitter = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestConfigFromEnvDefaultSort(t *testing.T) {
+	logs := captureLog(t)
+	for _, tt := range []struct{ env, want string }{
+		{"", sortLikes},
+		{"date", sortDate},
+		{"publishedDate", sortDate},
+		{"likeCount", sortLikes},
+		{"random", sortLikes},
+	} {
+		t.Setenv("PRTIMES_DEFAULT_SORT", tt.env)
+		if got := ConfigFromEnv().DefaultSort; got != tt.want {
+			t.Errorf("PRTIMES_DEFAULT_SORT=%q: DefaultSort = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+	if !strings.Contains(logs.String(), "Unknown PRTIMES_DEFAULT_SORT") {
+		t.Error("the unknown sort was not logged")
+	}
+}
+
+// sort を省略した場合は DefaultSort、指定した場合はそちらで並べる
+func TestDefaultSort(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("sort", 1, "2024年12月01日 09時00分", 30)
+	f.addRelease("sort", 2, "2024年12月03日 09時00分", 10)
+	f.addRelease("sort", 3, "2024年12月02日 09時00分", 20)
+	cfg := f.config()
+	cfg.DefaultSort = sortDate
+	s := NewServer(cfg)
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"", "リリース2,リリース3,リリース1"},
+		{"&sort=likes", "リリース1,リリース3,リリース2"},
+		{"&sort=date", "リリース2,リリース3,リリース1"},
+	} {
+		resp := getResponse(t, s, "/prtimes_posts?keyword=sort"+tt.query)
+		var titles []string
+		for _, item := range resp.Items {
+			titles = append(titles, item.Title)
+		}
+		if got := strings.Join(titles, ","); got != tt.want {
+			t.Errorf("%q: order = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+// 不正な DefaultSort は起動時にいいね順に戻す
+func TestNewServerRejectsUnknownDefaultSort(t *testing.T) {
+	captureLog(t)
+	cfg := DefaultConfig()
+	cfg.DefaultSort = "random"
+	if got := NewServer(cfg).cfg.DefaultSort; got != sortLikes {
+		t.Errorf("DefaultSort = %q, want %q", got, sortLikes)
+	}
+}
@@ -0,0 +1,652 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type crawlOptions struct {
+	// いいね数を取得しない
+	skipLikes bool
+	// 各項目にデバッグ用の情報を含める
+	debug bool
+	// 出力する日時のタイムゾーン
+	loc *time.Location
+	// 0より大きい場合は、いいね数の上位topN件が確定した時点で残りの取得をやめる
+	topN int
+	// ページ順に、各ページの結果ができた時点で呼ぶ (いいね数の取得前)
+	onPage func([]ResponseItem)
+	// 0より大きい場合は、ページを順に取得し、いいね数がこれ以上の項目が earlyStopCount 件集まったらやめる
+	earlyStopLikes int
+	earlyStopCount int
+	// 0より大きい場合は、全ページからこの数のページを選んで取得する (seed で選び方が決まる)
+	samplePages int
+	seed        int64
+	// ゼロでない場合は、これより後に公開されたリリースだけを新しい順に取得する
+	newerThan time.Time
+	// ゼロでない場合は、この時刻を過ぎたらいいね数の取得をやめる
+	likeDeadline time.Time
+	// 0より大きい場合は、取得するページがこの数を超えたら取得せずに tooManyPagesError を返す
+	maxPages int
+}
+
+type crawlResult struct {
+	// ページ順に並んだ結果
+	items []ResponseItem
+	// 各ページの取得結果
+	pages []PageDebug
+	// PR TIMESから取得した時刻
+	fetchedAt time.Time
+	// MaxCrawlItems を超えたため、残りを取得せずに打ち切った
+	truncated bool
+	// 重複として取り除いたもの
+	dedupe DedupeReport
+	// samplePages を指定した場合のみ
+	sample *SampleInfo
+	// ソフトタイムアウトでいいね数の取得を打ち切った
+	likesTruncated bool
+	// 取得できたページの数と、検索結果にあるページの数 (completeness に使う)
+	pagesScanned   int
+	pagesAvailable int
+	// 前に0件だったキーワードのため、PR TIMESへ問い合わせなかった
+	negativeCached bool
+	// ResultCacheTTL の間残しておいた結果を使い、PR TIMESへ問い合わせなかった
+	resultCached bool
+}
+
+// 検索結果のうち取得できたページの割合
+// 件数の上限・samplePages・earlyStopLikes・タイムアウトなどで取得しなかったページがある場合は1未満になる
+func (r *crawlResult) completeness() float64 {
+	if r.pagesAvailable <= 0 {
+		return 1
+	}
+	return min(float64(r.pagesScanned)/float64(r.pagesAvailable), 1)
+}
+
+// キーワードで検索し、全ページのリリースをいいね数付きで取得する
+// ctxが終了した場合も取得できた分は返すので、呼び出し側で ctx.Err() を確認する
+func (s *Server) crawl(ctx context.Context, keyword string, opts crawlOptions) (*crawlResult, error) {
+	if s.isNegativeCached(ctx, keyword) {
+		return &crawlResult{fetchedAt: time.Now(), negativeCached: true}, nil
+	}
+	if s.resultCacheable(opts) && !noCache(ctx) {
+		if result, ok := s.cachedResult(ctx, keyword, opts); ok {
+			return result, nil
+		}
+	}
+
+	var result *crawlResult
+	var err error
+	switch {
+	case !opts.newerThan.IsZero():
+		result, err = s.crawlNewerThan(ctx, keyword, opts)
+	case opts.earlyStopLikes > 0:
+		result, err = s.crawlUntilEnough(ctx, keyword, opts)
+	default:
+		result, err = s.crawlAllPages(ctx, keyword, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.updateNegativeCache(ctx, keyword, result, opts)
+	s.cacheResult(ctx, keyword, result, opts)
+
+	if !opts.skipLikes {
+		releaseIDs := make([]string, 0, len(result.items))
+		for _, item := range result.items {
+			if item.ReleaseID != "" {
+				releaseIDs = append(releaseIDs, item.ReleaseID)
+			}
+		}
+		s.likeHistory.recordKeyword(keyword, releaseIDs)
+	}
+
+	// いいね数の無い結果は残しても使えないので書き込まない
+	if s.sink != nil && !opts.skipLikes {
+		s.sink.send(CrawlRecord{
+			Keyword:   keyword,
+			FetchedAt: result.fetchedAt,
+			// 呼び出し側で並び替える前の状態を渡す
+			Items: append([]ResponseItem(nil), result.items...),
+		})
+	}
+	return result, nil
+}
+
+// 全ページを並行して取得する
+func (s *Server) crawlAllPages(ctx context.Context, keyword string, opts crawlOptions) (*crawlResult, error) {
+	// Fetch the first page to determine the total number of pages
+	firstPageData, err := s.fetchPRTimesData(ctx, keyword, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := max(firstPageData.Data.LastPage, 1)
+	availablePages := totalPages
+	// 一部のページだけを取得する場合は、取得しないページは空のまま終わったことにする
+	var sample *SampleInfo
+	var sampled map[int]bool
+	if opts.samplePages > 0 && opts.samplePages < totalPages {
+		sample, sampled = samplePages(totalPages, opts.samplePages, opts.seed)
+	}
+	// 上限を超える分のページは最初から取得しない
+	truncated := false
+	if maxItems := s.cfg.MaxCrawlItems; maxItems > 0 && sample == nil {
+		maxPages := max((maxItems+searchPageSize-1)/searchPageSize, 1)
+		if totalPages > maxPages {
+			log.Printf("Crawl for keyword %q has %d pages, truncating to %d pages (MaxCrawlItems=%d)", keyword, totalPages, maxPages, maxItems)
+			totalPages = maxPages
+			truncated = true
+		}
+	}
+	if opts.maxPages > 0 && sample == nil && totalPages > opts.maxPages {
+		return nil, &tooManyPagesError{pages: totalPages, max: opts.maxPages}
+	}
+	// 全ページ数以上を指定した場合も、取得したページを sample で返す
+	if opts.samplePages > 0 && sample == nil {
+		sample = allPagesSample(totalPages, availablePages, opts.seed)
+	}
+	pageReleases := make([][]Release, totalPages)
+	pages := make([]PageDebug, totalPages)
+	if sampled == nil || sampled[1] {
+		pageReleases[0] = firstPageData.Data.ReleaseList
+		pages[0] = newPageDebug(1, firstPageData, nil)
+	}
+	// 各ページの取得が終わったら閉じる
+	done := make([]chan struct{}, totalPages)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	close(done[0])
+
+	// 重複したページが見つかったら残りのページの取得をやめる
+	pagesCtx, cancelPages := context.WithCancel(ctx)
+	defer cancelPages()
+	var wg sync.WaitGroup
+
+	var toFetch []int
+	for page := 2; page <= totalPages; page++ {
+		if sampled != nil && !sampled[page] {
+			close(done[page-1])
+			continue
+		}
+		toFetch = append(toFetch, page)
+	}
+	fetchPage := func(page int) {
+		defer close(done[page-1])
+		prTimesData, err := s.fetchPRTimesData(pagesCtx, keyword, page)
+		pages[page-1] = newPageDebug(page, prTimesData, err)
+		if err != nil {
+			s.logFetchError(pagesCtx, "Error fetching page", page, ":", err)
+			return
+		}
+		pageReleases[page-1] = prTimesData.Data.ReleaseList
+	}
+
+	// Fetch all pages concurrently
+	// PageBatchSize が設定されている場合は、その数ずつ取得してはバッチの間に PageBatchPause だけ待つ
+	batchSize := len(toFetch)
+	if s.cfg.PageBatchSize > 0 {
+		batchSize = s.cfg.PageBatchSize
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for start := 0; start < len(toFetch); start += batchSize {
+			if start > 0 && s.cfg.PageBatchPause > 0 {
+				select {
+				case <-time.After(s.cfg.PageBatchPause):
+				case <-pagesCtx.Done():
+					// 取得しないページも終わったことにする
+					for _, page := range toFetch[start:] {
+						close(done[page-1])
+					}
+					return
+				}
+			}
+			var batch sync.WaitGroup
+			for _, page := range toFetch[start:min(start+batchSize, len(toFetch))] {
+				batch.Add(1)
+				go func(page int) {
+					defer batch.Done()
+					fetchPage(page)
+				}(page)
+			}
+			batch.Wait()
+		}
+	}()
+
+	// 取得できた順ではなくページ順に処理する
+	// ページ順を保つためにページごとに結果を持つ
+	var pageResults [][]ResponseItem
+	filter := newPageFilter(keyword)
+	count := 0
+	scannedPages := 0
+	for i := range pageReleases {
+		<-done[i]
+		releases, ok := filter.add(i+1, pageReleases[i])
+		if !ok {
+			// 重複したページ以降は無いものとする
+			availablePages = i
+			cancelPages()
+			break
+		}
+		if pages[i].Page != 0 && pages[i].Error == "" {
+			scannedPages++
+		}
+		if maxItems := s.cfg.MaxCrawlItems; maxItems > 0 && count+len(releases) > maxItems {
+			log.Printf("Crawl for keyword %q exceeded %d items, truncating at page %d", keyword, maxItems, i+1)
+			releases = releases[:maxItems-count]
+			truncated = true
+		}
+		count += len(releases)
+
+		var items []ResponseItem
+		for _, release := range releases {
+			items = append(items, s.newResponseItem(release, opts.loc))
+		}
+		pageResults = append(pageResults, items)
+		if opts.onPage != nil {
+			opts.onPage(items)
+		}
+		if s.cfg.MaxCrawlItems > 0 && count >= s.cfg.MaxCrawlItems {
+			cancelPages()
+			break
+		}
+	}
+	wg.Wait()
+
+	likesTruncated := false
+	switch {
+	case opts.skipLikes:
+	case opts.topN > 0:
+		var items []ResponseItem
+		for _, page := range pageResults {
+			items = append(items, page...)
+		}
+		likesTruncated = !fetchLikeCountsWithin(ctx, opts, func(ctx context.Context) {
+			s.fetchLikeCountsTopN(ctx, items, opts.topN)
+		})
+		pageResults = [][]ResponseItem{items}
+	default:
+		likesTruncated = !fetchLikeCountsWithin(ctx, opts, func(ctx context.Context) {
+			s.fetchLikeCounts(ctx, pageResults)
+		})
+	}
+
+	result := &crawlResult{
+		fetchedAt:      time.Now(),
+		truncated:      truncated,
+		dedupe:         filter.report,
+		sample:         sample,
+		likesTruncated: likesTruncated,
+		pagesScanned:   scannedPages,
+		pagesAvailable: availablePages,
+	}
+	for _, page := range pages {
+		// 取得しなかったページ
+		if page.Page == 0 {
+			continue
+		}
+		result.pages = append(result.pages, page)
+	}
+	for _, items := range pageResults {
+		result.items = append(result.items, items...)
+	}
+	if !opts.debug {
+		clearLikeCountStatus(result.items)
+	}
+	return result, nil
+}
+
+// URLから指定したクエリパラメータを取り除く
+// 末尾が * のものは前方一致 (例: utm_*)
+func stripQueryParams(rawURL string, params []string) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	query := u.Query()
+	for name := range query {
+		for _, param := range params {
+			prefix, isPrefix := strings.CutSuffix(param, "*")
+			if name == param || (isPrefix && strings.HasPrefix(name, prefix)) {
+				query.Del(name)
+				break
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// 検索結果のリリースURLを絶対URLにする
+// 相対パスは BaseURL に繋げ、他のドメインの絶対URL (//で始まるものを含む) はそのドメインのURLのままにする
+// BaseURL と AlternateDomains 以外のドメインの場合は false (リリースIDを取らない)
+func (s *Server) resolveReleaseURL(releaseURL string) (string, bool) {
+	ref, err := url.Parse(releaseURL)
+	if err != nil || ref.Host == "" {
+		return s.cfg.BaseURL + releaseURL, true
+	}
+	base, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		return releaseURL, false
+	}
+	resolved := base.ResolveReference(ref)
+	return resolved.String(), s.isReleaseHost(resolved.Hostname())
+}
+
+func (s *Server) isReleaseHost(host string) bool {
+	if strings.EqualFold(host, urlHost(s.cfg.BaseURL)) {
+		return true
+	}
+	for _, domain := range s.cfg.AlternateDomains {
+		if strings.EqualFold(host, strings.TrimSpace(domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// いいね数は未取得 (skipped) の状態で作る
+func (s *Server) newResponseItem(release Release, loc *time.Location) ResponseItem {
+	// 公開日時が分からない場合は PublishedAt をゼロ値にし、PublishedDate はPR TIMESの文字列のままにする
+	publishedAt := parseReleaseDate(release.ReleasedAt, s.cfg.DateLayouts)
+	publishedDate := release.ReleasedAt
+	if !publishedAt.IsZero() {
+		publishedAt = publishedAt.In(loc)
+		publishedDate = formatPublishedDate(publishedAt, loc)
+	}
+	postURL, known := s.resolveReleaseURL(release.ReleaseURL)
+	releaseID := ""
+	if known {
+		releaseID = extractReleaseID(postURL)
+	}
+	return ResponseItem{
+		ReleaseID:       releaseID,
+		CorporationName: release.CompanyName,
+		PublishedDate:   publishedDate,
+		PublishedAt:     publishedAt,
+		ThumbnailURL:    release.ThumbnailURL,
+		PostURL:         stripQueryParams(postURL, s.cfg.StripPostURLParams),
+		Title:           release.Title,
+		Tags:            release.Tags,
+		LikeCountStatus: likeCountStatusSkipped,
+	}
+}
+
+// グループごとに並行していいね数を取得する (グループ内は順番に取得する)
+// LikeCountWaveSize が設定されている場合はグループに関わらずその数ずつ、
+// LikeCountWorkersMax が設定されている場合はリリースの数に応じた数のワーカーで取得する
+func (s *Server) fetchLikeCounts(ctx context.Context, groups [][]ResponseItem) {
+	switch {
+	case s.cfg.LikeCountWaveSize > 0:
+		s.fetchLikeCountsInWaves(ctx, groups)
+		return
+	case s.cfg.LikeCountWorkersMax > 0:
+		s.fetchLikeCountsPooled(ctx, groups)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, items := range groups {
+		wg.Add(1)
+		go func(items []ResponseItem) {
+			defer wg.Done()
+			for i := range items {
+				s.fillLikeCount(ctx, &items[i])
+			}
+		}(items)
+	}
+	wg.Wait()
+}
+
+// LikeCountWaveSize 件ずつ並行して取得し、全て終わってから次を始める
+func (s *Server) fetchLikeCountsInWaves(ctx context.Context, groups [][]ResponseItem) {
+	items := flattenGroups(groups)
+	for start := 0; start < len(items); start += s.cfg.LikeCountWaveSize {
+		if ctx.Err() != nil {
+			return
+		}
+		var wg sync.WaitGroup
+		for _, item := range items[start:min(start+s.cfg.LikeCountWaveSize, len(items))] {
+			wg.Add(1)
+			go func(item *ResponseItem) {
+				defer wg.Done()
+				s.fillLikeCount(ctx, item)
+			}(item)
+		}
+		wg.Wait()
+	}
+}
+
+func flattenGroups(groups [][]ResponseItem) []*ResponseItem {
+	var items []*ResponseItem
+	for _, group := range groups {
+		for i := range group {
+			items = append(items, &group[i])
+		}
+	}
+	return items
+}
+
+func (s *Server) fetchLikeCountsPooled(ctx context.Context, groups [][]ResponseItem) {
+	items := flattenGroups(groups)
+	queue := make(chan *ResponseItem, len(items))
+	for _, item := range items {
+		queue <- item
+	}
+	close(queue)
+
+	workers := s.likeCountWorkers(len(items))
+	// concurrency を指定したリクエストはその数のワーカーで取得する
+	if limit, ok := concurrencyLimit(ctx); ok {
+		workers = min(limit, len(items))
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				s.fillLikeCount(ctx, item)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// n件のいいね数を取得するワーカーの数
+// LikeCountItemsPerWorker 件ごとに1つとし、LikeCountWorkersMin〜LikeCountWorkersMax に収める
+// (リリースの数より多くはしない)
+func (s *Server) likeCountWorkers(n int) int {
+	perWorker := max(s.cfg.LikeCountItemsPerWorker, 1)
+	workers := (n + perWorker - 1) / perWorker
+	workers = min(max(workers, s.cfg.LikeCountWorkersMin, 1), s.cfg.LikeCountWorkersMax)
+	return min(workers, n)
+}
+
+func (s *Server) fillLikeCount(ctx context.Context, item *ResponseItem) {
+	if item.ReleaseID == "" {
+		item.LikeCountStatus = likeCountStatusUnavailable
+		return
+	}
+	likeCount, err := s.fetchLikeCount(ctx, item.ReleaseID)
+	if err != nil {
+		s.logFetchError(ctx, "Error fetching like count for", item.ReleaseID, ":", err)
+		item.LikeCount = 0
+		item.LikeCountStatus = likeCountStatusFailed
+		return
+	}
+	item.LikeCount = likeCount
+	item.LikeCountStatus = likeCountStatusOK
+	s.likeHistory.record(item.ReleaseID, likeCount, time.Now())
+}
+
+// likeCountStatus は debug=true の場合だけ出力する
+func clearLikeCountStatus(items []ResponseItem) {
+	for i := range items {
+		items[i].LikeCountStatus = ""
+	}
+}
+
+// itemsを1ページ分ずつのグループに分ける
+func chunkItems(items []ResponseItem, size int) [][]ResponseItem {
+	var chunks [][]ResponseItem
+	for size < len(items) {
+		chunks = append(chunks, items[:size:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		chunks = append(chunks, items)
+	}
+	return chunks
+}
+
+// 複数の語を含むキーワードで件数が minResults に満たない場合に、
+// 語ごとに検索し直して結果に追加する (足りた時点で打ち切る)
+// 1語だけのキーワードはそれ以上緩められないのでそのまま返す
+// 追加で検索したキーワードも返す
+func (s *Server) broadenSearch(ctx context.Context, keyword string, items []ResponseItem, minResults int, opts crawlOptions) ([]ResponseItem, []string) {
+	terms := strings.Fields(keyword)
+	if len(terms) < 2 {
+		return items, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range items {
+		seen[item.PostURL] = true
+	}
+
+	var searched []string
+	for _, term := range terms {
+		if len(items) >= minResults || ctx.Err() != nil {
+			break
+		}
+		searched = append(searched, term)
+		crawled, err := s.crawl(ctx, term, opts)
+		if err != nil {
+			s.logFetchError(ctx, "Error fetching data for broadened keyword", term, ":", err)
+			continue
+		}
+		for _, item := range crawled.items {
+			if seen[item.PostURL] {
+				continue
+			}
+			seen[item.PostURL] = true
+			items = append(items, item)
+		}
+	}
+	return items, searched
+}
+
+// 別のキーワードでの取得をバックグラウンドで始め、結果を待つ関数を返す
+func (s *Server) crawlAsync(ctx context.Context, keyword string, opts crawlOptions) func() (*crawlResult, error) {
+	done := make(chan struct{})
+	var result *crawlResult
+	var err error
+	go func() {
+		defer close(done)
+		result, err = s.crawl(ctx, keyword, opts)
+	}()
+	return func() (*crawlResult, error) {
+		<-done
+		return result, err
+	}
+}
+
+// items に more のうちまだ無いもの (PostURLで比べる) を加える
+func mergeItems(items, more []ResponseItem) []ResponseItem {
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		seen[item.PostURL] = true
+	}
+	for _, item := range more {
+		if seen[item.PostURL] {
+			continue
+		}
+		seen[item.PostURL] = true
+		items = append(items, item)
+	}
+	return items
+}
+
+// ページの取得結果 (PR TIMESが返したstatus/message)
+func newPageDebug(page int, data *PRTimesResponse, err error) PageDebug {
+	pd := PageDebug{Page: page}
+	if err != nil {
+		pd.Error = err.Error()
+		return pd
+	}
+	pd.Status = data.Status
+	pd.Message = data.Message
+	pd.Releases = len(data.Data.ReleaseList)
+	pd.Partial = data.Partial
+	return pd
+}
+
+// ページ内容のハッシュ (リリースURLの並び)
+func hashReleases(releases []Release) [sha256.Size]byte {
+	h := sha256.New()
+	for _, release := range releases {
+		h.Write([]byte(release.ReleaseURL))
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// dedupeReport に入れる重複したリリースのURLの数
+const dedupeReportExamples = 5
+
+// ページ順に受け取ったページから、重複したページとリリースを取り除く
+type pageFilter struct {
+	keyword string
+	prev    [sha256.Size]byte
+	hasPrev bool
+	seen    map[string]bool
+	report  DedupeReport
+}
+
+func newPageFilter(keyword string) *pageFilter {
+	return &pageFilter{keyword: keyword, seen: make(map[string]bool)}
+}
+
+// ページングが壊れてPR TIMESが別のページ番号に同じ内容を返すことがあるため、
+// 直前のページと同じ内容のページが見つかったら false を返す (それ以降のページは捨てる)
+// 複数のページに同じリリースが含まれる場合は最初に出てきたものだけを残す
+func (f *pageFilter) add(page int, releases []Release) ([]Release, bool) {
+	if len(releases) > 0 {
+		sum := hashReleases(releases)
+		if f.hasPrev && sum == f.prev {
+			log.Printf("Anomaly: page %d has the same content as the previous page for keyword %q, stopping at page %d", page, f.keyword, page-1)
+			f.report.DuplicatePage = page
+			return nil, false
+		}
+		f.prev = sum
+		f.hasPrev = true
+	}
+
+	var deduped []Release
+	for _, release := range releases {
+		if f.seen[release.ReleaseURL] {
+			f.report.Collapsed++
+			if len(f.report.Examples) < dedupeReportExamples {
+				f.report.Examples = append(f.report.Examples, release.ReleaseURL)
+			}
+			continue
+		}
+		f.seen[release.ReleaseURL] = true
+		deduped = append(deduped, release)
+	}
+	return deduped, true
+}
@@ -0,0 +1,419 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// PR TIMESが全てのページ番号に同じ内容を返す場合は、2ページ目以降を捨てる
+func TestCrawlStopsOnRepeatedPages(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= searchPageSize; n++ {
+		f.addRelease("repeat", n, "2024年12月01日 09時00分", 1)
+	}
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		var resp PRTimesResponse
+		resp.Status = http.StatusOK
+		resp.Data.CurrentPage = 1
+		resp.Data.LastPage = 5
+		f.mu.Lock()
+		resp.Data.ReleaseList = f.releases["repeat"]
+		f.mu.Unlock()
+		writeFakeJSON(w, resp)
+		return true
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=repeat&debug=true")
+	if len(resp.Items) != searchPageSize {
+		t.Errorf("got %d items, want %d", len(resp.Items), searchPageSize)
+	}
+	if resp.Debug == nil || resp.Debug.DedupeReport == nil {
+		t.Fatalf("debug.dedupeReport is missing: %+v", resp.Debug)
+	}
+	if got := resp.Debug.DedupeReport.DuplicatePage; got != 2 {
+		t.Errorf("duplicatePage = %d, want 2", got)
+	}
+}
+
+// debug=true の場合は、項目ごとのいいね数の取得結果を返す
+func TestLikeCountStatus(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("status", 1, "2024年12月01日 09時00分", 5)
+	f.addRelease("status", 2, "2024年12月02日 09時00分", 0)
+	f.addRelease("status", 3, "2024年12月03日 09時00分", 0)
+	f.mu.Lock()
+	f.releases["status"][2].ReleaseURL = "https://example.com/news/3"
+	f.mu.Unlock()
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/press_release.php/press_release/"+fakeReleaseID(2)+"/like_count" {
+			http.NotFound(w, r)
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=status&debug=true")
+	want := map[string]string{
+		"リリース1": likeCountStatusOK,
+		"リリース2": likeCountStatusFailed,
+		"リリース3": likeCountStatusUnavailable,
+	}
+	if len(resp.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(resp.Items), len(want))
+	}
+	for _, item := range resp.Items {
+		if item.LikeCountStatus != want[item.Title] {
+			t.Errorf("%s: likeCountStatus = %q, want %q", item.Title, item.LikeCountStatus, want[item.Title])
+		}
+	}
+
+	// debug を指定しない場合は含めない
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=status").Items {
+		if item.LikeCountStatus != "" {
+			t.Errorf("%s: likeCountStatus = %q without debug", item.Title, item.LikeCountStatus)
+		}
+	}
+}
+
+// いいね数を取得するまでは skipped になる
+func TestNewResponseItemIsSkipped(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	item := s.newResponseItem(Release{ReleaseURL: fakeReleaseURL(1)}, jst)
+	if item.LikeCountStatus != likeCountStatusSkipped {
+		t.Errorf("likeCountStatus = %q, want %q", item.LikeCountStatus, likeCountStatusSkipped)
+	}
+}
+
+// AlternateDomains のリリースはそのドメインの絶対URLのままIDを取り、それ以外のドメインではIDを取らない
+func TestAlternateDomainReleaseURL(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AlternateDomains = []string{" Partner.PRTimes.example "}
+	s := NewServer(cfg)
+
+	for _, tt := range []struct {
+		releaseURL, postURL, releaseID string
+	}{
+		{"/main/html/rd/p/000000001.000000002.html", cfg.BaseURL + "/main/html/rd/p/000000001.000000002.html", "000000001.000000002"},
+		{"https://partner.prtimes.example/main/html/rd/p/000000003.000000004.html", "https://partner.prtimes.example/main/html/rd/p/000000003.000000004.html", "000000003.000000004"},
+		{"//partner.prtimes.example/main/html/rd/p/000000005.000000006.html", "https://partner.prtimes.example/main/html/rd/p/000000005.000000006.html", "000000005.000000006"},
+		{"https://other.example/main/html/rd/p/000000007.000000008.html", "https://other.example/main/html/rd/p/000000007.000000008.html", ""},
+	} {
+		item := s.newResponseItem(Release{ReleaseURL: tt.releaseURL}, jst)
+		if item.PostURL != tt.postURL || item.ReleaseID != tt.releaseID {
+			t.Errorf("%s: PostURL = %s, ReleaseID = %q; want %s, %q", tt.releaseURL, item.PostURL, item.ReleaseID, tt.postURL, tt.releaseID)
+		}
+	}
+}
+
+// debug=true の場合は、PR TIMESが返した各ページの status と message を返す
+func TestDebugPageStatus(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		var resp PRTimesResponse
+		resp.Status = 503
+		resp.Message = "maintenance"
+		resp.Data.CurrentPage = 1
+		resp.Data.LastPage = 1
+		writeFakeJSON(w, resp)
+		return true
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=empty&debug=true")
+	if resp.Debug == nil || len(resp.Debug.Pages) != 1 {
+		t.Fatalf("debug.pages = %+v", resp.Debug)
+	}
+	if got := resp.Debug.Pages[0]; got.Page != 1 || got.Status != 503 || got.Message != "maintenance" {
+		t.Errorf("debug.pages[0] = %+v", got)
+	}
+}
+
+// minResults に満たない場合は語ごとに検索し直して足す (重複は除く)
+func TestMinResultsBroadensSearch(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("東京 カフェ", 1, "2024年12月01日 09時00分", 1)
+	f.addRelease("東京", 1, "2024年12月01日 09時00分", 1)
+	f.addRelease("東京", 2, "2024年12月01日 09時00分", 2)
+	f.addRelease("カフェ", 3, "2024年12月01日 09時00分", 3)
+	f.addRelease("カフェ", 4, "2024年12月01日 09時00分", 4)
+	s := NewServer(f.config())
+
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=東京+カフェ"); len(resp.Items) != 1 || len(resp.BroadenedKeywords) != 0 {
+		t.Fatalf("without minResults: %d items, broadenedKeywords %v", len(resp.Items), resp.BroadenedKeywords)
+	}
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=東京+カフェ&minResults=2")
+	if len(resp.Items) != 2 {
+		t.Errorf("minResults=2: got %d items, want 2", len(resp.Items))
+	}
+	if len(resp.BroadenedKeywords) != 1 || resp.BroadenedKeywords[0] != "東京" {
+		t.Errorf("minResults=2: broadenedKeywords = %v, want [東京]", resp.BroadenedKeywords)
+	}
+
+	resp = getResponse(t, s, "/prtimes_posts?keyword=東京+カフェ&minResults=10")
+	if len(resp.Items) != 4 {
+		t.Errorf("minResults=10: got %d items, want 4", len(resp.Items))
+	}
+	if len(resp.BroadenedKeywords) != 2 {
+		t.Errorf("minResults=10: broadenedKeywords = %v, want both terms", resp.BroadenedKeywords)
+	}
+}
+
+func TestStripQueryParams(t *testing.T) {
+	const raw = "https://prtimes.jp/main/html/rd/p/000000001.000000002.html?utm_source=x&utm_medium=y&ref=top&id=5"
+	for _, tt := range []struct {
+		params []string
+		want   string
+	}{
+		{nil, raw},
+		{[]string{"utm_*"}, "https://prtimes.jp/main/html/rd/p/000000001.000000002.html?id=5&ref=top"},
+		{[]string{"utm_source", "ref"}, "https://prtimes.jp/main/html/rd/p/000000001.000000002.html?id=5&utm_medium=y"},
+		{[]string{"utm_*", "ref", "id"}, "https://prtimes.jp/main/html/rd/p/000000001.000000002.html"},
+		{[]string{"other"}, "https://prtimes.jp/main/html/rd/p/000000001.000000002.html?id=5&ref=top&utm_medium=y&utm_source=x"},
+	} {
+		if got := stripQueryParams(raw, tt.params); got != tt.want {
+			t.Errorf("stripQueryParams(%v) = %s, want %s", tt.params, got, tt.want)
+		}
+	}
+}
+
+// StripPostURLParams を設定した場合は postUrl から取り除く (リリースIDはそのまま取れる)
+func TestStripPostURLParams(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("utm", 1, "2024年12月01日 09時00分", 4)
+	f.mu.Lock()
+	f.releases["utm"][0].ReleaseURL += "?utm_campaign=a&page=2"
+	f.mu.Unlock()
+	cfg := f.config()
+	cfg.StripPostURLParams = []string{"utm_*"}
+	s := NewServer(cfg)
+
+	item := getResponse(t, s, "/prtimes_posts?keyword=utm").Items[0]
+	if want := f.URL + fakeReleaseURL(1) + "?page=2"; item.PostURL != want {
+		t.Errorf("postUrl = %s, want %s", item.PostURL, want)
+	}
+	if item.LikeCount != 4 {
+		t.Errorf("likeCount = %d, want 4", item.LikeCount)
+	}
+}
+
+// ページ数だけを大きく見せ、各ページのリリースはその場で作るPR TIMES
+func newHugeUpstream(t *testing.T, lastPage int) *fakeUpstream {
+	t.Helper()
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		f.searchCalls.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		var resp PRTimesResponse
+		resp.Status = http.StatusOK
+		resp.Data.CurrentPage = page
+		resp.Data.LastPage = lastPage
+		for i := 0; i < searchPageSize; i++ {
+			n := (page-1)*searchPageSize + i + 1
+			resp.Data.ReleaseList = append(resp.Data.ReleaseList, Release{
+				CompanyName: "会社", Title: "リリース" + strconv.Itoa(n), ReleaseURL: fakeReleaseURL(n), ReleasedAt: "2024年12月01日 09時00分",
+			})
+		}
+		writeFakeJSON(w, resp)
+		return true
+	}
+	return f
+}
+
+// 数万件の検索結果でも MaxCrawlItems までで打ち切り、truncated を返す
+func TestMaxCrawlItemsTruncates(t *testing.T) {
+	f := newHugeUpstream(t, 1000)
+	cfg := f.config()
+	cfg.MaxCrawlItems = 90
+	s := NewServer(cfg)
+	logs := captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=huge")
+	if len(resp.Items) != 90 {
+		t.Errorf("got %d items, want 90", len(resp.Items))
+	}
+	if !resp.Truncated {
+		t.Error("truncated should be set")
+	}
+	if resp.Completeness >= 1 {
+		t.Errorf("completeness = %v, want less than 1", resp.Completeness)
+	}
+	// 90件に必要な3ページだけを取得する
+	if got := f.searchCalls.Load(); got != 3 {
+		t.Errorf("search calls = %d, want 3", got)
+	}
+	if !strings.Contains(logs.String(), "MaxCrawlItems=90") {
+		t.Errorf("the guard was not logged: %q", logs.String())
+	}
+}
+
+// 上限に収まる場合は打ち切らない
+func TestMaxCrawlItemsNotReached(t *testing.T) {
+	f := newHugeUpstream(t, 2)
+	cfg := f.config()
+	cfg.MaxCrawlItems = 2 * searchPageSize
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=huge")
+	if len(resp.Items) != 2*searchPageSize || resp.Truncated {
+		t.Errorf("got %d items (truncated %v), want %d", len(resp.Items), resp.Truncated, 2*searchPageSize)
+	}
+}
+
+// ページの境目で同じリリースが重複した場合、debug=true で取り除いた数と例を返す
+func TestDedupeReport(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= searchPageSize; n++ {
+		f.addRelease("overlap", n, "2024年12月01日 09時00分", 1)
+	}
+	// 2ページ目の先頭3件は1ページ目の最後の3件と同じ
+	for n := searchPageSize - 2; n <= searchPageSize+4; n++ {
+		f.addRelease("overlap", n, "2024年12月01日 09時00分", 1)
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=overlap&debug=true")
+	if len(resp.Items) != searchPageSize+4 {
+		t.Errorf("got %d items, want %d", len(resp.Items), searchPageSize+4)
+	}
+	if resp.Debug == nil || resp.Debug.DedupeReport == nil {
+		t.Fatal("dedupeReport is missing")
+	}
+	report := resp.Debug.DedupeReport
+	if report.Collapsed != 3 {
+		t.Errorf("collapsed = %d, want 3", report.Collapsed)
+	}
+	want := []string{fakeReleaseURL(searchPageSize - 2), fakeReleaseURL(searchPageSize - 1), fakeReleaseURL(searchPageSize)}
+	if strings.Join(report.Examples, ",") != strings.Join(want, ",") {
+		t.Errorf("examples = %v, want %v", report.Examples, want)
+	}
+
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=overlap"); resp.Debug != nil {
+		t.Error("dedupeReport should only be returned with debug=true")
+	}
+}
+
+// PageBatchSize ずつ取得し、前のバッチが終わってから PageBatchPause 以上待って次のバッチを始める
+func TestPageBatches(t *testing.T) {
+	const pause = 50 * time.Millisecond
+	f := newFakeUpstream(t)
+	for n := 1; n <= 7*searchPageSize; n++ {
+		f.addRelease("batch", n, "2024年12月01日 09時00分", 1)
+	}
+	var mu sync.Mutex
+	started := make(map[int]time.Time)
+	finished := make(map[int]time.Time)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		started[page] = time.Now()
+		mu.Unlock()
+		f.serveSearch(w, r)
+		mu.Lock()
+		finished[page] = time.Now()
+		mu.Unlock()
+		return true
+	}
+	cfg := f.config()
+	cfg.PageBatchSize = 2
+	cfg.PageBatchPause = pause
+	s := NewServer(cfg)
+
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=batch&sort=date").Items); got != 7*searchPageSize {
+		t.Fatalf("got %d items", got)
+	}
+	// 1ページ目の後、2〜3, 4〜5, 6〜7 ページの順に取得する
+	batches := [][]int{{2, 3}, {4, 5}, {6, 7}}
+	for i := 1; i < len(batches); i++ {
+		prevEnd := finished[batches[i-1][0]]
+		if end := finished[batches[i-1][1]]; end.After(prevEnd) {
+			prevEnd = end
+		}
+		for _, page := range batches[i] {
+			if gap := started[page].Sub(prevEnd); gap < pause {
+				t.Errorf("page %d started %v after the previous batch, want at least %v", page, gap, pause)
+			}
+		}
+	}
+}
+
+// limit を指定せずに MaxPagesWithoutLimit を超えるキーワードを検索した場合は、取得せずに 400 で limit を求める
+func TestMaxPagesWithoutLimit(t *testing.T) {
+	f := newHugeUpstream(t, 6)
+	cfg := f.config()
+	cfg.MaxPagesWithoutLimit = 5
+	s := NewServer(cfg)
+	captureLog(t)
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=broad&sort=date")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "matches 6 pages") || !strings.Contains(body, "specify the limit query parameter") {
+		t.Errorf("body = %q", body)
+	}
+	if got := f.searchCalls.Load(); got != 1 {
+		t.Errorf("search calls = %d, want only the first page", got)
+	}
+
+	// limit や samplePages を指定した場合は取得する
+	for _, target := range []string{"/prtimes_posts?keyword=broad&sort=date&limit=10", "/prtimes_posts?keyword=broad&sort=date&samplePages=2"} {
+		if rec := serveAPI(t, s, target); rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d", target, rec.Code)
+		}
+	}
+
+	// 上限以内なら limit が無くても取得する
+	cfg.MaxPagesWithoutLimit = 6
+	if got := len(getResponse(t, NewServer(cfg), "/prtimes_posts?keyword=broad&sort=date").Items); got != 6*searchPageSize {
+		t.Errorf("got %d items, want %d", got, 6*searchPageSize)
+	}
+}
+
+// completeness は取得したページ数 / 検索結果のページ数 (全て取得した場合は1)
+func TestCompleteness(t *testing.T) {
+	tests := []struct {
+		name     string
+		lastPage int
+		maxItems int
+		query    string
+		want     float64
+	}{
+		{"all pages", 3, 0, "", 1},
+		{"MaxCrawlItems", 10, 2 * searchPageSize, "", 0.2},
+		{"samplePages", 8, 0, "&samplePages=2", 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHugeUpstream(t, tt.lastPage)
+			cfg := f.config()
+			cfg.MaxCrawlItems = tt.maxItems
+			s := NewServer(cfg)
+			captureLog(t)
+
+			resp := getResponse(t, s, "/prtimes_posts?keyword=huge&sort=date"+tt.query)
+			if resp.Completeness != tt.want {
+				t.Errorf("completeness = %v, want %v", resp.Completeness, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// コンテナ等にタイムゾーンデータが無くても Asia/Tokyo を読めるようにする
+	_ "time/tzdata"
+)
+
+const publishedDateFormat = "2006年01月02日 15:04"
+
+// from, to クエリパラメータの日付の形式
+const dateParamLayout = "2006-01-02"
+
+// PR TIMESの日時はJST
+var jst = mustLoadLocation("Asia/Tokyo")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// 絶対時間の形式 (先頭から順に試す)
+var defaultDateLayouts = []string{
+	"2006年1月2日 15時04分", // 月や日が1桁の場合も対応
+	"2006年1月2日 15時04分05秒",
+	"2006年1月2日 15:04",
+	"2006年1月2日 15:04:05",
+	"2006/1/2 15:04",
+	"2006/1/2 15:04:05",
+	"2006/1/2 3:04 PM",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+}
+
+// 処理できない場合はゼロ値を返す (公開日時が分からないものとして扱う)
+func parseReleaseDate(dateStr string, layouts []string) time.Time {
+	t, ok := tryParseReleaseDate(dateStr, layouts)
+	if !ok {
+		log.Println("Unable to parse date:", dateStr)
+		return time.Time{}
+	}
+	return t
+}
+
+// 相対時間の形式 (リリースごとに作り直さない)
+var (
+	minutesAgoPattern = regexp.MustCompile(`(\d+)分前`)
+	hoursAgoPattern   = regexp.MustCompile(`(\d+)時間前`)
+	daysAgoPattern    = regexp.MustCompile(`(\d+)日前`)
+)
+
+// 「昨日」「一昨日」の後の時刻の形式
+var relativeDayTimeLayouts = []string{"15:04", "15時04分"}
+
+// 処理できない形式の場合は false を返す
+func tryParseReleaseDate(dateStr string, layouts []string) (time.Time, bool) {
+	// 「〇時間前」の形式を処理
+	if matches := hoursAgoPattern.FindStringSubmatch(dateStr); len(matches) == 2 {
+		hoursAgo, err := strconv.Atoi(matches[1])
+		if err == nil {
+			return time.Now().In(jst).Add(-time.Duration(hoursAgo) * time.Hour), true
+		}
+	}
+
+	// 「〇分前」の形式を処理
+	if matches := minutesAgoPattern.FindStringSubmatch(dateStr); len(matches) == 2 {
+		minutesAgo, err := strconv.Atoi(matches[1])
+		if err == nil {
+			return time.Now().In(jst).Add(-time.Duration(minutesAgo) * time.Minute), true
+		}
+	}
+
+	// 「〇日前」の形式を処理
+	if matches := daysAgoPattern.FindStringSubmatch(dateStr); len(matches) == 2 {
+		daysAgo, err := strconv.Atoi(matches[1])
+		if err == nil {
+			return time.Now().In(jst).AddDate(0, 0, -daysAgo), true
+		}
+	}
+
+	// 「昨日」「一昨日」の形式を処理 (時刻が続く場合はその時刻にする。例: 昨日 15:04)
+	for prefix, daysAgo := range map[string]int{"一昨日": 2, "昨日": 1} {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(dateStr), prefix)
+		if !ok {
+			continue
+		}
+		day := time.Now().In(jst).AddDate(0, 0, -daysAgo)
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return day, true
+		}
+		for _, layout := range relativeDayTimeLayouts {
+			if t, err := time.Parse(layout, rest); err == nil {
+				return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, jst), true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	// 絶対時間の形式を処理 (例: 2024年12月3日 09時00分)
+	for _, layout := range layouts {
+		parsedTime, err := time.ParseInLocation(layout, dateStr, jst)
+		if err == nil {
+			return parsedTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// tzクエリパラメータの値からタイムゾーンを決める
+// jst (空の場合も), utc またはIANA名 (サーバーの設定に依存する Local は受け付けない)
+func parseTimeZone(tz string) (*time.Location, bool) {
+	switch strings.ToLower(tz) {
+	case "", "jst":
+		return jst, true
+	case "utc":
+		return time.UTC, true
+	}
+	if tz == "Local" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// 表示用の日時文字列 (例: 2024年12月03日 09:00)
+// 公開日時が分からない (ゼロ値の) 場合は呼び出し側で元の文字列を使う
+func formatPublishedDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(publishedDateFormat)
+}
+
+// 公開からの経過時間に応じた新しさ (0〜1)
+// 公開した時点が1で、halfLife が過ぎるごとに半分になる。公開日時が分からない場合は nil
+func freshness(publishedAt, now time.Time, halfLife time.Duration) *float64 {
+	if publishedAt.IsZero() || halfLife <= 0 {
+		return nil
+	}
+	age := max(now.Sub(publishedAt), 0)
+	v := math.Pow(0.5, float64(age)/float64(halfLife))
+	return &v
+}
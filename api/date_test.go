@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tz を指定した場合は publishedAt と publishdDatetime をそのタイムゾーンで返す
+func TestTimeZoneParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("tz", 1, "2024年12月01日 09時00分", 1)
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		tz, publishedAt, publishedDate string
+	}{
+		{"", "2024-12-01T09:00:00+09:00", "2024年12月01日 09:00"},
+		{"UTC", "2024-12-01T00:00:00Z", "2024年12月01日 00:00"},
+		{"America/New_York", "2024-11-30T19:00:00-05:00", "2024年11月30日 19:00"},
+	} {
+		rec := serveAPI(t, s, "/prtimes_posts?keyword=tz&tz="+tt.tz)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("tz=%s: status %d", tt.tz, rec.Code)
+		}
+		var resp struct {
+			Items []struct {
+				PublishedAt   string `json:"publishedAt"`
+				PublishedDate string `json:"publishdDatetime"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Items) != 1 {
+			t.Fatalf("tz=%s: got %d items", tt.tz, len(resp.Items))
+		}
+		if got := resp.Items[0].PublishedAt; got != tt.publishedAt {
+			t.Errorf("tz=%s: publishedAt = %s, want %s", tt.tz, got, tt.publishedAt)
+		}
+		if got := resp.Items[0].PublishedDate; got != tt.publishedDate {
+			t.Errorf("tz=%s: publishdDatetime = %s, want %s", tt.tz, got, tt.publishedDate)
+		}
+	}
+}
+
+func TestTimeZoneParamRejectsUnknownZone(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	for _, tz := range []string{"Mars/Olympus", "Local"} {
+		if rec := serveAPI(t, s, "/prtimes_posts?keyword=tz&tz="+tz); rec.Code != http.StatusBadRequest {
+			t.Errorf("tz=%s: status %d, want 400", tz, rec.Code)
+		}
+	}
+}
+
+// jst と utc は大文字小文字を問わない別名
+func TestParseTimeZoneAliases(t *testing.T) {
+	for _, tt := range []struct {
+		tz   string
+		want string
+	}{
+		{"", "Asia/Tokyo"},
+		{"jst", "Asia/Tokyo"},
+		{"JST", "Asia/Tokyo"},
+		{"utc", "UTC"},
+		{"Asia/Tokyo", "Asia/Tokyo"},
+		{"Europe/London", "Europe/London"},
+	} {
+		loc, ok := parseTimeZone(tt.tz)
+		if !ok {
+			t.Errorf("parseTimeZone(%q) failed", tt.tz)
+			continue
+		}
+		if loc.String() != tt.want {
+			t.Errorf("parseTimeZone(%q) = %s, want %s", tt.tz, loc, tt.want)
+		}
+	}
+}
+
+// tz=utc では同じ時刻のままUTCの表記になる
+func TestTimeZoneParamUTCAlias(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("tz", 1, "2024年12月01日 08時30分", 1)
+	s := NewServer(f.config())
+
+	jstResp := getResponse(t, s, "/prtimes_posts?keyword=tz")
+	utcResp := getResponse(t, s, "/prtimes_posts?keyword=tz&tz=utc")
+	if len(jstResp.Items) != 1 || len(utcResp.Items) != 1 {
+		t.Fatalf("got %d and %d items", len(jstResp.Items), len(utcResp.Items))
+	}
+	if !utcResp.Items[0].PublishedAt.Equal(jstResp.Items[0].PublishedAt) {
+		t.Errorf("instant changed: %v vs %v", utcResp.Items[0].PublishedAt, jstResp.Items[0].PublishedAt)
+	}
+	if got := utcResp.Items[0].PublishedAt.Format(time.RFC3339); got != "2024-11-30T23:30:00Z" {
+		t.Errorf("publishedAt = %s, want 2024-11-30T23:30:00Z", got)
+	}
+}
+
+func TestParseReleaseDateLayouts(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024年12月03日 09時00分", time.Date(2024, 12, 3, 9, 0, 0, 0, jst)},
+		{"2024年1月2日 15時04分", time.Date(2024, 1, 2, 15, 4, 0, 0, jst)},
+		{"2024年12月03日 09時00分05秒", time.Date(2024, 12, 3, 9, 0, 5, 0, jst)},
+		{"2024年12月3日 09:00", time.Date(2024, 12, 3, 9, 0, 0, 0, jst)},
+		{"2024年12月3日 09:00:30", time.Date(2024, 12, 3, 9, 0, 30, 0, jst)},
+		{"2024/12/03 09:00", time.Date(2024, 12, 3, 9, 0, 0, 0, jst)},
+		{"2024/12/3 09:00:05", time.Date(2024, 12, 3, 9, 0, 5, 0, jst)},
+		{"2024/12/3 9:15 PM", time.Date(2024, 12, 3, 21, 15, 0, 0, jst)},
+		{"2024/12/3 9:15 AM", time.Date(2024, 12, 3, 9, 15, 0, 0, jst)},
+		{"2024-12-03 09:00", time.Date(2024, 12, 3, 9, 0, 0, 0, jst)},
+		{"2024-12-03 09:00:59", time.Date(2024, 12, 3, 9, 0, 59, 0, jst)},
+	} {
+		got, ok := tryParseReleaseDate(tt.in, defaultDateLayouts)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("tryParseReleaseDate(%q) = %v, %v; want %v", tt.in, got, ok, tt.want)
+		}
+	}
+	if _, ok := tryParseReleaseDate("12/03/2024", defaultDateLayouts); ok {
+		t.Error("parsed an unknown layout")
+	}
+}
+
+// DateLayouts を指定した場合はその形式だけを先頭から試す
+func TestParseReleaseDateCustomLayouts(t *testing.T) {
+	layouts := []string{"02.01.2006 15:04"}
+	got, ok := tryParseReleaseDate("03.12.2024 09:30", layouts)
+	if !ok || !got.Equal(time.Date(2024, 12, 3, 9, 30, 0, 0, jst)) {
+		t.Errorf("got %v, %v", got, ok)
+	}
+	if _, ok := tryParseReleaseDate("2024年12月03日 09時00分", layouts); ok {
+		t.Error("used a default layout that is not in DateLayouts")
+	}
+}
+
+// 相対的な表記はJSTの現在時刻を基準にする
+func TestParseRelativeReleaseDates(t *testing.T) {
+	now := time.Now().In(jst)
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"3日前", now.AddDate(0, 0, -3)},
+		{"2時間前", now.Add(-2 * time.Hour)},
+		{"15分前", now.Add(-15 * time.Minute)},
+		{"一昨日", now.AddDate(0, 0, -2)},
+	} {
+		got, ok := tryParseReleaseDate(tt.in, defaultDateLayouts)
+		if !ok || got.Location() != jst {
+			t.Errorf("tryParseReleaseDate(%q) = %v, %v", tt.in, got, ok)
+			continue
+		}
+		if d := got.Sub(tt.want); d < 0 || d > time.Minute {
+			t.Errorf("tryParseReleaseDate(%q) = %v; want about %v", tt.in, got, tt.want)
+		}
+	}
+
+	yesterday := now.AddDate(0, 0, -1)
+	for _, in := range []string{"昨日 15:04", "昨日 15時04分"} {
+		got, ok := tryParseReleaseDate(in, defaultDateLayouts)
+		want := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 15, 4, 0, 0, jst)
+		if !ok || !got.Equal(want) || got.Location() != jst {
+			t.Errorf("tryParseReleaseDate(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	if _, ok := tryParseReleaseDate("昨日 夕方", defaultDateLayouts); ok {
+		t.Error("parsed an unknown time after 昨日")
+	}
+}
+
+// 解析できない日付は現在時刻ではなくゼロ値にしてログに残す
+func TestParseReleaseDateUnparseable(t *testing.T) {
+	logs := captureLog(t)
+	if got := parseReleaseDate("不明", defaultDateLayouts); !got.IsZero() {
+		t.Errorf("parseReleaseDate = %v; want zero", got)
+	}
+	if !strings.Contains(logs.String(), "Unable to parse date") {
+		t.Errorf("log = %q", logs.String())
+	}
+}
+
+func TestConfigFromEnvDateLayouts(t *testing.T) {
+	t.Setenv("PRTIMES_DATE_LAYOUTS", "2006.01.02 15:04;02.01.2006")
+	if got := ConfigFromEnv().DateLayouts; len(got) != 2 || got[1] != "02.01.2006" {
+		t.Errorf("DateLayouts = %q", got)
+	}
+}
+
+// 公開直後が1で halfLife ごとに半分になり、古いほど小さくなる
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 12, 10, 9, 0, 0, 0, jst)
+	halfLife := 24 * time.Hour
+	want := map[time.Duration]float64{0: 1, 24 * time.Hour: 0.5, 48 * time.Hour: 0.25}
+	for age, w := range want {
+		if got := freshness(now.Add(-age), now, halfLife); got == nil || math.Abs(*got-w) > 1e-9 {
+			t.Errorf("freshness at %v = %v, want %v", age, got, w)
+		}
+	}
+
+	prev := 2.0
+	for age := time.Duration(0); age <= 30*24*time.Hour; age += 6 * time.Hour {
+		got := freshness(now.Add(-age), now, halfLife)
+		if got == nil || *got <= 0 || *got > 1 || *got >= prev {
+			t.Fatalf("freshness at %v = %v, want in (0, 1] and less than %v", age, got, prev)
+		}
+		prev = *got
+	}
+
+	// 未来の日時は1、公開日時が分からない場合は nil
+	if got := freshness(now.Add(time.Hour), now, halfLife); got == nil || *got != 1 {
+		t.Errorf("freshness in the future = %v, want 1", got)
+	}
+	if got := freshness(time.Time{}, now, halfLife); got != nil {
+		t.Errorf("freshness without a date = %v, want nil", *got)
+	}
+}
+
+func TestIncludeFreshnessParam(t *testing.T) {
+	now := time.Now()
+	f := newFakeUpstream(t)
+	f.addRelease("fresh", 1, releasedAt(now.Add(-time.Hour)), 1)
+	f.addRelease("fresh", 2, releasedAt(now.Add(-72*time.Hour)), 2)
+	f.addRelease("fresh", 3, "不明", 3)
+	cfg := f.config()
+	cfg.FreshnessHalfLife = 24 * time.Hour
+	s := NewServer(cfg)
+
+	got := make(map[string]*float64)
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=fresh&includeFreshness=true").Items {
+		got[item.Title] = item.Freshness
+	}
+	if got["リリース1"] == nil || got["リリース2"] == nil || *got["リリース1"] <= *got["リリース2"] {
+		t.Errorf("freshness = %v, %v, want the newer release to be fresher", got["リリース1"], got["リリース2"])
+	}
+	if v := got["リリース2"]; v != nil && math.Abs(*v-0.125) > 0.01 {
+		t.Errorf("freshness after 3 half-lives = %v, want about 0.125", *v)
+	}
+	if got["リリース3"] != nil {
+		t.Errorf("freshness without a date = %v", *got["リリース3"])
+	}
+
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=fresh").Items {
+		if item.Freshness != nil {
+			t.Errorf("%s: freshness without includeFreshness", item.Title)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// 同じURLへの取得を DebounceWindow の間まとめる
+// 並行して取得中のものはその結果を待ち、取得し終えてから window 以内のものは取得し直さずに同じ本文を返す
+// (Cache と違い、同時に来た同じリクエストでPR TIMESを何度も叩かないためのもの。残すのは200の場合だけ)
+type debouncer struct {
+	window time.Duration
+	group  singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*debouncedResponse
+}
+
+type debouncedResponse struct {
+	status    int
+	header    http.Header
+	body      []byte
+	fetchedAt time.Time
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{window: window, entries: make(map[string]*debouncedResponse)}
+}
+
+func (d *debouncer) recent(url string) (*debouncedResponse, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[url]
+	if !ok || time.Since(entry.fetchedAt) > d.window {
+		return nil, false
+	}
+	return entry, true
+}
+
+// window を過ぎたものは追加するついでに捨てる
+func (d *debouncer) put(url string, entry *debouncedResponse) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for u, e := range d.entries {
+		if time.Since(e.fetchedAt) > d.window {
+			delete(d.entries, u)
+		}
+	}
+	d.entries[url] = entry
+}
+
+// window 以内に取得したものがあればそれを、無ければ fetch で取得して返す
+// 呼び出し側が本文を読めるように、毎回新しい http.Response を作る
+// nocache の場合はまとめずに取得し直す (取得した結果は次のために残す)
+func (d *debouncer) get(ctx context.Context, url string, fetch func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	if noCache(ctx) {
+		entry, err := d.fetch(ctx, url, fetch)
+		if err != nil {
+			return nil, err
+		}
+		return entry.response(), nil
+	}
+	if entry, ok := d.recent(url); ok {
+		if diag := diagnosticsFrom(ctx); diag != nil {
+			diag.debounced.Add(1)
+		}
+		return entry.response(), nil
+	}
+	// まとめた取得は最初に来たリクエストが切断されても続け、待っている他のリクエストを失敗させない
+	ch := d.group.DoChan(url, func() (any, error) {
+		return d.fetch(context.WithoutCancel(ctx), url, fetch)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*debouncedResponse).response(), nil
+	}
+}
+
+// 本文まで読み、200の場合は window の間残す
+func (d *debouncer) fetch(ctx context.Context, url string, fetch func(context.Context) (*http.Response, error)) (*debouncedResponse, error) {
+	resp, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entry := &debouncedResponse{status: resp.StatusCode, header: resp.Header, body: body, fetchedAt: time.Now()}
+	if resp.StatusCode == http.StatusOK {
+		d.put(url, entry)
+	}
+	return entry, nil
+}
+
+func (e *debouncedResponse) response() *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.status),
+		StatusCode:    e.status,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+	}
+}
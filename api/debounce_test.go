@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 呼ばれた回数を数え、release が閉じるまで応答を止めておくサーバー
+func newDebounceUpstream(t *testing.T, status int) (*httptest.Server, *atomic.Int64, chan struct{}) {
+	t.Helper()
+	var calls atomic.Int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.WriteHeader(status)
+		io.WriteString(w, "body")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls, release
+}
+
+func newDebounceServer(window time.Duration) *Server {
+	cfg := DefaultConfig()
+	cfg.DebounceWindow = window
+	cfg.RetryJitter = jitterNone
+	return NewServer(cfg)
+}
+
+// goroutine からも呼ぶので t.Fatal は使わない
+func readDebounced(t *testing.T, resp *http.Response, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	return string(body)
+}
+
+// 同時に来た同じURLは1回だけ取得し、window 以内に続けて来たものも取得し直さない
+func TestDebounceSuppressesDuplicates(t *testing.T) {
+	srv, calls, release := newDebounceUpstream(t, http.StatusOK)
+	s := newDebounceServer(time.Minute)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.httpGet(context.Background(), srv.URL)
+			bodies[i] = readDebounced(t, resp, err)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := 0; i < 5; i++ {
+		resp, err := s.httpGet(context.Background(), srv.URL)
+		if got := readDebounced(t, resp, err); got != "body" {
+			t.Errorf("body = %q", got)
+		}
+	}
+	for i, body := range bodies {
+		if body != "body" {
+			t.Errorf("request %d: body = %q", i, body)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream called %d times, want 1", got)
+	}
+}
+
+// window を過ぎたものと200以外の結果は使い回さない
+func TestDebounceWindowAndStatus(t *testing.T) {
+	srv, calls, release := newDebounceUpstream(t, http.StatusNotFound)
+	close(release)
+	s := newDebounceServer(time.Minute)
+	for i := 0; i < 3; i++ {
+		resp, err := s.httpGet(context.Background(), srv.URL)
+		readDebounced(t, resp, err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("404: upstream called %d times, want 3", got)
+	}
+
+	srv, calls, release = newDebounceUpstream(t, http.StatusOK)
+	close(release)
+	s = newDebounceServer(20 * time.Millisecond)
+	resp, err := s.httpGet(context.Background(), srv.URL)
+	readDebounced(t, resp, err)
+	time.Sleep(50 * time.Millisecond)
+	resp, err = s.httpGet(context.Background(), srv.URL)
+	readDebounced(t, resp, err)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("after the window: upstream called %d times, want 2", got)
+	}
+}
+
+// nocache の場合は window 以内でも取得し直す
+func TestDebounceNoCache(t *testing.T) {
+	srv, calls, release := newDebounceUpstream(t, http.StatusOK)
+	close(release)
+	s := newDebounceServer(time.Minute)
+
+	resp, err := s.httpGet(context.Background(), srv.URL)
+	readDebounced(t, resp, err)
+	resp, err = s.httpGet(withNoCache(context.Background()), srv.URL)
+	if got := readDebounced(t, resp, err); got != "body" {
+		t.Errorf("body = %q", got)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream called %d times, want 2", got)
+	}
+}
+
+// 最初に取得を始めたリクエストが切断されても、同じURLを待っている他のリクエストは結果を受け取る
+func TestDebounceFirstCallerCancelled(t *testing.T) {
+	srv, calls, release := newDebounceUpstream(t, http.StatusOK)
+	s := newDebounceServer(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.httpGet(ctx, srv.URL)
+		firstErr <- err
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan string, 1)
+	go func() {
+		resp, err := s.httpGet(context.Background(), srv.URL)
+		second <- readDebounced(t, resp, err)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first request: err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if got := <-second; got != "body" {
+		t.Errorf("second request: body = %q", got)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream called %d times, want 1", got)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PR TIMESの検索結果を1件ずつデコードする
+// release_list の途中で接続が切れた場合は、それまでに読めたリリースを残して Partial を立てる
+func decodePRTimesResponse(r io.Reader) (*PRTimesResponse, error) {
+	dec := json.NewDecoder(r)
+	var resp PRTimesResponse
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return salvage(&resp, err)
+		}
+		switch key {
+		case "data":
+			err = decodeSearchData(dec, &resp)
+		case "status":
+			err = dec.Decode(&resp.Status)
+		case "message":
+			err = dec.Decode(&resp.Message)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return salvage(&resp, err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return salvage(&resp, err)
+	}
+	return &resp, nil
+}
+
+// リリースを読めた後で切れていた場合は、読めた分を返す
+func salvage(resp *PRTimesResponse, err error) (*PRTimesResponse, error) {
+	if !resp.Partial && isEOF(err) && len(resp.Data.ReleaseList) > 0 {
+		resp.Partial = true
+	}
+	if resp.Partial {
+		return resp, nil
+	}
+	return nil, err
+}
+
+func decodeSearchData(dec *json.Decoder, resp *PRTimesResponse) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("unexpected token %v for data", tok)
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "current_page":
+			err = dec.Decode(&resp.Data.CurrentPage)
+		case "last_page":
+			err = dec.Decode(&resp.Data.LastPage)
+		case "release_list":
+			err = decodeReleaseList(dec, resp)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func decodeReleaseList(dec *json.Decoder, resp *PRTimesResponse) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("unexpected token %v for release_list", tok)
+	}
+
+	for dec.More() {
+		var release Release
+		if err := dec.Decode(&release); err != nil {
+			return truncated(resp, err)
+		}
+		resp.Data.ReleaseList = append(resp.Data.ReleaseList, release)
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return truncated(resp, err)
+	}
+	return nil
+}
+
+// 配列の途中でEOFになった場合は読めた分を部分的な結果とする
+func truncated(resp *PRTimesResponse, err error) error {
+	if isEOF(err) {
+		resp.Partial = true
+	}
+	return err
+}
+
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v but got %v", delim, tok)
+	}
+	return nil
+}
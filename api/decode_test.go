@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const truncatedSearchJSON = `{"data":{"current_page":1,"last_page":1,"release_list":[` +
+	`{"company_name":"会社1","title":"リリース1","release_url":"/main/html/rd/p/000000001.000000001.html","released_at":"2024年12月01日 09時00分"},` +
+	`{"company_name":"会社2","title":"リリース2","release_url":"/main/html/rd/p/000000001.000000002.html","released_at":"2024年12月01日 09時00分"},` +
+	`{"company_name":"会社3","title":"リリ`
+
+// release_list の途中で切れた場合は、それまでに読めたリリースを残して Partial を立てる
+func TestDecodePRTimesResponseTruncated(t *testing.T) {
+	resp, err := decodePRTimesResponse(strings.NewReader(truncatedSearchJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Partial {
+		t.Error("Partial is not set")
+	}
+	if len(resp.Data.ReleaseList) != 2 || resp.Data.ReleaseList[1].Title != "リリース2" {
+		t.Errorf("release_list = %+v", resp.Data.ReleaseList)
+	}
+}
+
+// リリースを1件も読めないうちに切れた場合はエラーにする
+func TestDecodePRTimesResponseTruncatedBeforeReleases(t *testing.T) {
+	if _, err := decodePRTimesResponse(strings.NewReader(`{"data":{"current_page":1,`)); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDecodePRTimesResponseComplete(t *testing.T) {
+	resp, err := decodePRTimesResponse(strings.NewReader(`{"data":{"current_page":1,"last_page":3,"release_list":[{"title":"a"}],"extra":1},"status":200,"message":"ok","other":[1,2]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Partial || resp.Data.LastPage != 3 || len(resp.Data.ReleaseList) != 1 || resp.Status != 200 || resp.Message != "ok" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+// 検索結果を途中で切って返すPR TIMES
+func newTruncatingUpstream(t *testing.T) *fakeUpstream {
+	t.Helper()
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(truncatedSearchJSON))
+		return true
+	}
+	return f
+}
+
+// 途中で切れたページも、読めた分は結果に含めて debug で partial とする
+func TestTruncatedPageIsPartial(t *testing.T) {
+	f := newTruncatingUpstream(t)
+	s := NewServer(f.config())
+	logs := captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=cut&debug=true")
+	if len(resp.Items) != 2 {
+		t.Errorf("got %d items, want 2", len(resp.Items))
+	}
+	if resp.Debug == nil || len(resp.Debug.Pages) != 1 || !resp.Debug.Pages[0].Partial {
+		t.Errorf("debug.pages = %+v", resp.Debug)
+	}
+	if !strings.Contains(logs.String(), "was truncated, recovered 2 releases") {
+		t.Errorf("the truncation was not logged: %q", logs.String())
+	}
+}
+
+// TolerantDecode を無効にした場合は、途中で切れたページはエラーにする
+func TestTruncatedPageWithoutTolerantDecode(t *testing.T) {
+	f := newTruncatingUpstream(t)
+	cfg := f.config()
+	cfg.TolerantDecode = false
+	s := NewServer(cfg)
+	captureLog(t)
+
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=cut"); rec.Code < http.StatusInternalServerError {
+		t.Errorf("status %d, want 5xx", rec.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// X-Debug: true の場合に1リクエスト分だけ集める情報
+// ctxに入れて取得処理に渡し、入っていない場合は何もしない
+type diagnostics struct {
+	start time.Time
+
+	upstreamCalls  atomic.Int64
+	searchCalls    atomic.Int64
+	likeCountCalls atomic.Int64
+	cacheHits      atomic.Int64
+	// MaxConcurrency の空きを待った時間の合計 (ナノ秒)
+	upstreamWait atomic.Int64
+	debounced    atomic.Int64
+
+	mu       sync.Mutex
+	warnings []string
+}
+
+// X-Debug: true の場合にレスポンスの _debug に入れる
+type DiagnosticsInfo struct {
+	TotalMs int64 `json:"totalMs"`
+	CrawlMs int64 `json:"crawlMs"`
+	// 再試行を含むPR TIMESへのリクエストの数
+	UpstreamCalls  int64 `json:"upstreamCalls"`
+	SearchCalls    int64 `json:"searchCalls"`
+	LikeCountCalls int64 `json:"likeCountCalls"`
+	// 取得せずに前回の値を使ったいいね数の数
+	CacheHits int64 `json:"cacheHits"`
+	// PRTIMES_MAX_CONCURRENCY の空きを待った時間の合計 (並行して待った分も足す)
+	UpstreamWaitMs int64 `json:"upstreamWaitMs"`
+	// DebounceWindow 以内に取得した同じURLの結果を使い、PR TIMESへ送らなかったリクエストの数
+	Debounced    int64    `json:"debounced"`
+	PagesFetched int      `json:"pagesFetched"`
+	Warnings     []string `json:"warnings"`
+}
+
+type diagnosticsKey struct{}
+
+func withDiagnostics(ctx context.Context) (context.Context, *diagnostics) {
+	d := &diagnostics{start: time.Now()}
+	return context.WithValue(ctx, diagnosticsKey{}, d), d
+}
+
+// 入っていない場合は nil
+func diagnosticsFrom(ctx context.Context) *diagnostics {
+	d, _ := ctx.Value(diagnosticsKey{}).(*diagnostics)
+	return d
+}
+
+// nil の場合は何もしない
+func (d *diagnostics) warn(msg string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.warnings = append(d.warnings, msg)
+}
+
+func (d *diagnostics) info(crawlTime time.Duration, pages []PageDebug) *DiagnosticsInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fetched := 0
+	for _, page := range pages {
+		if page.Page > 0 && page.Error == "" {
+			fetched++
+		}
+	}
+	return &DiagnosticsInfo{
+		TotalMs:        time.Since(d.start).Milliseconds(),
+		CrawlMs:        crawlTime.Milliseconds(),
+		UpstreamCalls:  d.upstreamCalls.Load(),
+		SearchCalls:    d.searchCalls.Load(),
+		LikeCountCalls: d.likeCountCalls.Load(),
+		CacheHits:      d.cacheHits.Load(),
+		UpstreamWaitMs: time.Duration(d.upstreamWait.Load()).Milliseconds(),
+		Debounced:      d.debounced.Load(),
+		PagesFetched:   fetched,
+		Warnings:       append([]string{}, d.warnings...),
+	}
+}
+
+// X-Debug: true が指定されているか
+// DebugAPIKey が設定されている場合は X-API-Key が一致する場合だけ受け付ける
+func (s *Server) debugRequested(r *http.Request) bool {
+	if r.Header.Get("X-Debug") != "true" {
+		return false
+	}
+	if s.cfg.DebugAPIKey == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(s.cfg.DebugAPIKey)) == 1
+}
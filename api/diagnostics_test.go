@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveWithHeaders(t *testing.T, s *Server, target string, header map[string]string) Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", target, rec.Code, rec.Body.String())
+	}
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// X-Debug: true の場合だけ _debug を返す
+func TestDiagnosticsHeader(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("diag", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	if resp := serveWithHeaders(t, s, "/prtimes_posts?keyword=diag&nocache=1", nil); resp.Diagnostics != nil {
+		t.Error("_debug should not be returned without X-Debug")
+	}
+
+	resp := serveWithHeaders(t, s, "/prtimes_posts?keyword=diag&nocache=1", map[string]string{"X-Debug": "true"})
+	d := resp.Diagnostics
+	if d == nil {
+		t.Fatal("_debug is missing")
+	}
+	if d.SearchCalls != 1 || d.LikeCountCalls != 3 || d.PagesFetched != 1 {
+		t.Errorf("searchCalls = %d, likeCountCalls = %d, pagesFetched = %d, want 1, 3, 1", d.SearchCalls, d.LikeCountCalls, d.PagesFetched)
+	}
+	// 事前リクエストを含む
+	if d.UpstreamCalls < d.SearchCalls+d.LikeCountCalls {
+		t.Errorf("upstreamCalls = %d, want at least %d", d.UpstreamCalls, d.SearchCalls+d.LikeCountCalls)
+	}
+	if d.Warnings == nil {
+		t.Error("warnings should be an empty list, not null")
+	}
+	if resp.Debug != nil {
+		t.Error("X-Debug should not enable debug=true")
+	}
+}
+
+// DebugAPIKey を設定した場合は X-API-Key が一致する場合だけ返す
+func TestDiagnosticsRequiresAPIKey(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("diag", 1, "2024年12月01日 09時00分", 1)
+	cfg := f.config()
+	cfg.DebugAPIKey = "secret"
+	s := NewServer(cfg)
+
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"", false},
+		{"wrong", false},
+		{"secret", true},
+	} {
+		resp := serveWithHeaders(t, s, "/prtimes_posts?keyword=diag", map[string]string{"X-Debug": "true", "X-API-Key": tt.key})
+		if got := resp.Diagnostics != nil; got != tt.want {
+			t.Errorf("X-API-Key %q: _debug present = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
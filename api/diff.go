@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// keyword の検索結果のうち、excludeKeyword の検索結果に含まれないリリースを返す
+// 両方の検索を並行して行い、差分のリリースについてだけいいね数を取得する
+func (s *Server) handlePRTimesPostsDiff(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	keyword := r.URL.Query().Get("keyword")
+	excludeKeyword := r.URL.Query().Get("excludeKeyword")
+	if keyword == "" || excludeKeyword == "" {
+		http.Error(w, "keyword and excludeKeyword query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	limit := 0
+	if limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	debug := r.URL.Query().Get("debug") == "true"
+	apiVersion, ok := parseAPIVersion(r)
+	if !ok {
+		http.Error(w, "Accept-Version header must be v1 or v2", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("API-Version", apiVersion)
+
+	ctx := r.Context()
+	if s.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	opts := crawlOptions{skipLikes: true, debug: true, loc: jst}
+	var included, excluded *crawlResult
+	var includedErr, excludedErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		included, includedErr = s.crawl(ctx, keyword, opts)
+	}()
+	go func() {
+		defer wg.Done()
+		excluded, excludedErr = s.crawl(ctx, excludeKeyword, opts)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{includedErr, excludedErr} {
+		if err != nil {
+			s.writeFetchError(w, r, err)
+			return
+		}
+	}
+
+	results := diffItems(included.items, excluded.items)
+	s.fetchLikeCounts(ctx, chunkItems(results, searchPageSize))
+	// タイムアウトした場合は取得できた分のいいね数で返す
+	partial := false
+	switch ctx.Err() {
+	case context.Canceled:
+		s.logDebug("Request cancelled by client:", r.URL)
+		return
+	case context.DeadlineExceeded:
+		log.Println("Request timed out, returning partial results:", r.URL)
+		partial = true
+	}
+	if !debug {
+		clearLikeCountStatus(results)
+	}
+
+	totalLikes := sumLikes(results)
+	results = sortByLikes(results)
+	if limit > 0 {
+		results = limitItems(limit)(results)
+	}
+
+	if results == nil {
+		results = []ResponseItem{}
+	}
+	if apiVersion == apiVersionV1 {
+		writeJSON(w, results)
+		return
+	}
+
+	// excludeKeyword で除く前に keyword に一致した件数
+	resp := Response{APIVersion: apiVersion, Items: results, TotalLikes: totalLikes, MatchedBeforeFilter: len(included.items), Partial: partial}
+	resp.ServerProcessingMs = time.Since(start).Milliseconds()
+	if r.URL.Query().Get("bigIntAsString") == "true" {
+		writeJSONBigIntAsString(w, resp)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// aにあってbに無いものを返す (IDが取れない場合はURLで比べる)
+func diffItems(a, b []ResponseItem) []ResponseItem {
+	exclude := make(map[string]bool, len(b))
+	for _, item := range b {
+		exclude[itemKey(item)] = true
+	}
+
+	var diff []ResponseItem
+	for _, item := range a {
+		if !exclude[itemKey(item)] {
+			diff = append(diff, item)
+		}
+	}
+	return diff
+}
+
+func itemKey(item ResponseItem) string {
+	if item.ReleaseID != "" {
+		return item.ReleaseID
+	}
+	return item.PostURL
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// keyword にあって excludeKeyword に無いリリースだけを返し、それらのいいね数だけを取得する
+func TestPostsDiff(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 4; n++ {
+		f.addRelease("A", n, "2024年12月01日 09時00分", n*10)
+	}
+	for n := 3; n <= 6; n++ {
+		f.addRelease("B", n, "2024年12月01日 09時00分", n*10)
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts/diff?keyword=A&excludeKeyword=B")
+	if len(resp.Items) != 2 {
+		t.Fatalf("got %d items, want 2: %+v", len(resp.Items), resp.Items)
+	}
+	// いいね数の多い順
+	if resp.Items[0].Title != "リリース2" || resp.Items[1].Title != "リリース1" {
+		t.Errorf("items = %s, %s; want リリース2, リリース1", resp.Items[0].Title, resp.Items[1].Title)
+	}
+	if resp.Items[0].LikeCount != 20 || resp.TotalLikes != 30 {
+		t.Errorf("likeCount = %d, totalLikes = %d; want 20, 30", resp.Items[0].LikeCount, resp.TotalLikes)
+	}
+	if got := f.likeCalls.Load(); got != 2 {
+		t.Errorf("like count calls = %d, want 2", got)
+	}
+}
+
+func TestPostsDiffRequiresBothKeywords(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	if rec := serveAPI(t, s, "/prtimes_posts/diff?keyword=A"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+// PR TIMESが応答しない場合も RequestTimeout で打ち切る
+func TestPostsDiffRequestTimeout(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		<-r.Context().Done()
+		return true
+	}
+	cfg := f.config()
+	cfg.RequestTimeout = 50 * time.Millisecond
+	cfg.RetryJitter = jitterNone
+	s := NewServer(cfg)
+	captureLog(t)
+
+	start := time.Now()
+	rec := serveAPI(t, s, "/prtimes_posts/diff?keyword=A&excludeKeyword=B")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v, want about RequestTimeout", elapsed)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// 1ページ分のいいね数を並行して取得する単位
+const earlyStopGroupSize = 10
+
+// ページを1つずつ取得してはいいね数を取得し、いいね数が earlyStopLikes 以上の項目が
+// earlyStopCount 件集まった時点で残りのページの取得をやめる
+// 取得しなかったページにいいね数の多いリリースがあっても結果に含まれないので、厳密な上位ではない
+func (s *Server) crawlUntilEnough(ctx context.Context, keyword string, opts crawlOptions) (*crawlResult, error) {
+	result := &crawlResult{}
+	filter := newPageFilter(keyword)
+	enough := 0
+	for page := 1; ; page++ {
+		prTimesData, err := s.fetchPRTimesData(ctx, keyword, page)
+		if err != nil {
+			// 最初のページが取れない場合だけエラーにする
+			if page == 1 {
+				return nil, err
+			}
+			result.pages = append(result.pages, newPageDebug(page, nil, err))
+			s.logFetchError(ctx, "Error fetching page", page, ":", err)
+			break
+		}
+		result.pages = append(result.pages, newPageDebug(page, prTimesData, nil))
+		result.pagesAvailable = max(prTimesData.Data.LastPage, 1)
+
+		releases, ok := filter.add(page, prTimesData.Data.ReleaseList)
+		if !ok {
+			// 重複したページ以降は無いものとする
+			result.pagesAvailable = page - 1
+			break
+		}
+		result.pagesScanned++
+		var items []ResponseItem
+		for _, release := range releases {
+			items = append(items, s.newResponseItem(release, opts.loc))
+		}
+		if !fetchLikeCountsWithin(ctx, opts, func(ctx context.Context) {
+			s.fetchLikeCounts(ctx, chunkItems(items, earlyStopGroupSize))
+		}) {
+			// いいね数が取れないとこれ以上集まらない
+			result.likesTruncated = true
+			result.items = append(result.items, items...)
+			break
+		}
+		for _, item := range items {
+			if item.LikeCount >= opts.earlyStopLikes {
+				enough++
+			}
+		}
+		result.items = append(result.items, items...)
+		if maxItems := s.cfg.MaxCrawlItems; maxItems > 0 && len(result.items) >= maxItems {
+			if len(result.items) > maxItems || page < prTimesData.Data.LastPage {
+				log.Printf("Crawl for keyword %q exceeded %d items, truncating at page %d", keyword, maxItems, page)
+				result.items = result.items[:maxItems]
+				result.truncated = true
+			}
+			break
+		}
+
+		if enough >= opts.earlyStopCount || page >= prTimesData.Data.LastPage || ctx.Err() != nil {
+			break
+		}
+	}
+
+	result.fetchedAt = time.Now()
+	result.dedupe = filter.report
+	if !opts.debug {
+		clearLikeCountStatus(result.items)
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// 3ページのうち2ページ目に閾値以上のリリースを3件置く
+func newEarlyStopUpstream(t *testing.T) *fakeUpstream {
+	t.Helper()
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3*searchPageSize; n++ {
+		likes := 1
+		if n > searchPageSize && n <= searchPageSize+3 {
+			likes = 100
+		}
+		f.addRelease("buzz", n, "2024年12月01日 09時00分", likes)
+	}
+	return f
+}
+
+// 閾値以上の項目が limit 件集まったら残りのページを取得しない
+func TestEarlyStopLikes(t *testing.T) {
+	f := newEarlyStopUpstream(t)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=buzz&limit=3&earlyStopLikes=50")
+	if got := f.searchCalls.Load(); got != 2 {
+		t.Errorf("search calls = %d, want 2", got)
+	}
+	if got, want := f.likeCalls.Load(), int64(2*searchPageSize); got != want {
+		t.Errorf("like_count calls = %d, want %d", got, want)
+	}
+	if got := likeCounts(resp.Items); fmt.Sprint(got) != "[100 100 100]" {
+		t.Errorf("likes = %v, want [100 100 100]", got)
+	}
+}
+
+// 閾値以上の項目が足りない場合は最後のページまで取得する
+func TestEarlyStopLikesNotReached(t *testing.T) {
+	f := newEarlyStopUpstream(t)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=buzz&limit=4&earlyStopLikes=50")
+	if got := f.searchCalls.Load(); got != 3 {
+		t.Errorf("search calls = %d, want 3", got)
+	}
+	if got := likeCounts(resp.Items); fmt.Sprint(got) != "[100 100 100 1]" {
+		t.Errorf("likes = %v, want [100 100 100 1]", got)
+	}
+}
+
+func TestEarlyStopLikesRequiresLimit(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=buzz&earlyStopLikes=50"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
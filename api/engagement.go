@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FollowerCountSource は企業のフォロワー数を返す
+// PR TIMESの検索結果には含まれないため、組み込む側で取得方法を用意する
+// 分からない場合は ok=false を返す
+type FollowerCountSource interface {
+	FollowerCount(ctx context.Context, companyID string) (count int, ok bool, err error)
+}
+
+// 企業IDごとのフォロワー数を固定で返す
+type staticFollowerCounts map[string]int
+
+// NewStaticFollowerCounts は counts (企業ID → フォロワー数) を返すFollowerCountSourceを返す
+func NewStaticFollowerCounts(counts map[string]int) FollowerCountSource {
+	return staticFollowerCounts(counts)
+}
+
+func (c staticFollowerCounts) FollowerCount(_ context.Context, companyID string) (int, bool, error) {
+	count, ok := c[companyID]
+	return count, ok, nil
+}
+
+// PRTIMES_FOLLOWER_COUNTS のJSONファイル ({"000012345": 1200, ...}) を読む
+func loadFollowerCountsFile(path string) (FollowerCountSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var counts map[string]int
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return NewStaticFollowerCounts(counts), nil
+}
+
+// フォロワー数を同時に取得する数
+const followerCountConcurrency = 8
+
+// リリースIDの後半 (000000001.000012345 の 000012345) が企業ID (前半はその企業のリリースの通し番号)
+func companyID(releaseID string) string {
+	_, id, ok := strings.Cut(releaseID, ".")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// 企業ごとにフォロワー数を取得し、いいね数をフォロワー数で割った値を入れる
+// フォロワー数が分からない (0を含む) 項目には入れない
+func (s *Server) fillEngagementRates(ctx context.Context, items []ResponseItem) {
+	if s.cfg.FollowerCounts == nil {
+		return
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		id := companyID(item.ReleaseID)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	var mu sync.Mutex
+	followers := make(map[string]int)
+	sem := make(chan struct{}, followerCountConcurrency)
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			count, ok, err := s.cfg.FollowerCounts.FollowerCount(ctx, id)
+			if err != nil {
+				s.logFetchError(ctx, "Error fetching follower count for company", id, ":", err)
+				return
+			}
+			if !ok || count <= 0 {
+				return
+			}
+			mu.Lock()
+			followers[id] = count
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	for i := range items {
+		count, ok := followers[companyID(items[i].ReleaseID)]
+		if !ok {
+			continue
+		}
+		rate := float64(items[i].LikeCount) / float64(count)
+		items[i].EngagementRate = &rate
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// フォロワー数の取得に失敗する企業を含むFollowerCountSource
+type failingFollowerCounts map[string]int
+
+func (c failingFollowerCounts) FollowerCount(_ context.Context, companyID string) (int, bool, error) {
+	if companyID == companyID3 {
+		return 0, false, errors.New("detail page is down")
+	}
+	count, ok := c[companyID]
+	return count, ok, nil
+}
+
+var companyID3 = companyID(fakeReleaseID(3))
+
+// フォロワー数が分かる項目だけに engagementRate を入れる
+func TestEngagementRate(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("rate", 1, "2024年12月01日 09時00分", 50)
+	f.addRelease("rate", 2, "2024年12月02日 09時00分", 30)
+	f.addRelease("rate", 3, "2024年12月03日 09時00分", 20)
+	f.addRelease("rate", 4, "2024年12月04日 09時00分", 10)
+	cfg := f.config()
+	cfg.FollowerCounts = failingFollowerCounts{
+		companyID(fakeReleaseID(1)): 200,
+		companyID(fakeReleaseID(2)): 0, // 0は分からないものとする
+	}
+	s := NewServer(cfg)
+	captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=rate&engagementRate=true")
+	if len(resp.Items) != 4 {
+		t.Fatalf("got %d items, want 4", len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		if item.Title == "リリース1" {
+			if item.EngagementRate == nil || *item.EngagementRate != 0.25 {
+				t.Errorf("%s: engagementRate = %v, want 0.25", item.Title, item.EngagementRate)
+			}
+		} else if item.EngagementRate != nil {
+			t.Errorf("%s: engagementRate = %v, want omitted", item.Title, *item.EngagementRate)
+		}
+	}
+}
+
+// engagementRate=true を指定しない場合はフォロワー数を取得しない
+func TestEngagementRateRequiresParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("rate", 1, "2024年12月01日 09時00分", 50)
+	cfg := f.config()
+	cfg.FollowerCounts = NewStaticFollowerCounts(map[string]int{companyID(fakeReleaseID(1)): 100})
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=rate")
+	if len(resp.Items) != 1 || resp.Items[0].EngagementRate != nil {
+		t.Errorf("items = %+v, want no engagementRate", resp.Items)
+	}
+}
+
+func TestCompanyID(t *testing.T) {
+	for id, want := range map[string]string{"000000001.000012345": "000012345", "invalid": ""} {
+		if got := companyID(id); got != want {
+			t.Errorf("companyID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestConfigFromEnvFollowerCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "followers.json")
+	if err := os.WriteFile(path, []byte(`{"000012345": 1200}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PRTIMES_FOLLOWER_COUNTS", path)
+	cfg := ConfigFromEnv()
+	if cfg.FollowerCounts == nil {
+		t.Fatal("FollowerCounts was not loaded")
+	}
+	if count, ok, err := cfg.FollowerCounts.FollowerCount(context.Background(), "000012345"); err != nil || !ok || count != 1200 {
+		t.Errorf("FollowerCount = %d, %v, %v, want 1200", count, ok, err)
+	}
+	if _, ok, _ := cfg.FollowerCounts.FollowerCount(context.Background(), "000000001"); ok {
+		t.Error("unknown company should not have a follower count")
+	}
+
+	captureLog(t)
+	t.Setenv("PRTIMES_FOLLOWER_COUNTS", filepath.Join(t.TempDir(), "missing.json"))
+	if cfg := ConfigFromEnv(); cfg.FollowerCounts != nil {
+		t.Error("FollowerCounts should be nil when the file is missing")
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// テスト用のPR TIMES (検索といいね数のAPIだけ)
+// キーワードごとのリリースを searchPageSize 件ずつのページに分けて返す
+type fakeUpstream struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// キーワードごとのリリース (返す順)
+	releases map[string][]Release
+	// リリースIDごとのいいね数
+	likes map[string]int
+
+	searchCalls atomic.Int64
+	likeCalls   atomic.Int64
+
+	// 設定した場合は最初に呼び、trueを返した場合はそのレスポンスで終える
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newFakeUpstream(t *testing.T) *fakeUpstream {
+	t.Helper()
+	f := &fakeUpstream{releases: make(map[string][]Release), likes: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// テスト用のリリースIDとURL
+func fakeReleaseID(n int) string {
+	return fmt.Sprintf("000000001.%09d", n)
+}
+
+func fakeReleaseURL(n int) string {
+	return "/main/html/rd/p/" + fakeReleaseID(n) + ".html"
+}
+
+// keyword の n 番目のリリースとして、releasedAt (PR TIMESの形式) に公開され likes 件のいいねがあるリリースを加える
+func (f *fakeUpstream) addRelease(keyword string, n int, releasedAt string, likes int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releases[keyword] = append(f.releases[keyword], Release{
+		CompanyName: "会社" + strconv.Itoa(n),
+		Title:       "リリース" + strconv.Itoa(n),
+		ReleaseURL:  fakeReleaseURL(n),
+		ReleasedAt:  releasedAt,
+		Tags:        []string{},
+	})
+	f.likes[fakeReleaseID(n)] = likes
+}
+
+// keyword の n 番目のリリースのサムネイルURLを変える
+func (f *fakeUpstream) setThumbnail(keyword string, n int, thumbnailURL string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.releases[keyword] {
+		if f.releases[keyword][i].ReleaseURL == fakeReleaseURL(n) {
+			f.releases[keyword][i].ThumbnailURL = thumbnailURL
+		}
+	}
+}
+
+// keyword の n 番目のリリースの種類を変える (nil の場合は返さない)
+func (f *fakeUpstream) setTags(keyword string, n int, tags []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.releases[keyword] {
+		if f.releases[keyword][i].ReleaseURL == fakeReleaseURL(n) {
+			f.releases[keyword][i].Tags = tags
+		}
+	}
+}
+
+// このPR TIMESへ問い合わせる既定の設定
+func (f *fakeUpstream) config() Config {
+	cfg := DefaultConfig()
+	cfg.BaseURL = f.URL
+	return cfg
+}
+
+func (f *fakeUpstream) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.intercept != nil && f.intercept(w, r) {
+		return
+	}
+	switch {
+	case r.URL.Path == "/api/keyword_search.php/search":
+		f.searchCalls.Add(1)
+		f.serveSearch(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/press_release.php/press_release/") && strings.HasSuffix(r.URL.Path, "/like_count"):
+		f.likeCalls.Add(1)
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/press_release.php/press_release/"), "/like_count")
+		f.mu.Lock()
+		likes := f.likes[id]
+		f.mu.Unlock()
+		var resp LikeCountResponse
+		resp.Data.LikeCount = likes
+		writeFakeJSON(w, resp)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (f *fakeUpstream) serveSearch(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	f.mu.Lock()
+	all := f.releases[r.URL.Query().Get("keyword")]
+	f.mu.Unlock()
+
+	var resp PRTimesResponse
+	resp.Status = http.StatusOK
+	resp.Message = "ok"
+	resp.Data.CurrentPage = page
+	resp.Data.LastPage = max((len(all)+searchPageSize-1)/searchPageSize, 1)
+	resp.Data.ReleaseList = []Release{}
+	if start := (page - 1) * searchPageSize; start < len(all) {
+		resp.Data.ReleaseList = all[start:min(start+searchPageSize, len(all))]
+	}
+	writeFakeJSON(w, resp)
+}
+
+// intercept で Content-Type を設定した場合はそちらを使う
+func writeFakeJSON(w http.ResponseWriter, v any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// APIへ target (パスとクエリ) をGETし、レスポンスを返す
+func serveAPI(t *testing.T, s *Server, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+// APIへ target をGETし、200のJSONを Response として読む
+func getResponse(t *testing.T, s *Server, target string) Response {
+	t.Helper()
+	rec := serveAPI(t, s, target)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", target, rec.Code, rec.Body.String())
+	}
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("GET %s: decoding response: %v", target, err)
+	}
+	return resp
+}
+
+// テストの間だけ log の出力を取っておく
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+// 複数のgoroutineから書き込まれるログ用のバッファ
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
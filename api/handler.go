@@ -0,0 +1,854 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func (s *Server) handlePRTimesPosts(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	keyword := r.URL.Query().Get("keyword")
+	if keyword == "" {
+		http.Error(w, "keyword query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	limit := 0
+	if limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		var err error
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, "offset query parameter must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	samplePageCount := 0
+	if v := r.URL.Query().Get("samplePages"); v != "" {
+		var err error
+		samplePageCount, err = strconv.Atoi(v)
+		if err != nil || samplePageCount <= 0 {
+			http.Error(w, "samplePages query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	// 指定が無い場合は毎回違うページを選ぶ (レスポンスの sample.seed で再現できる)
+	seed := time.Now().UnixNano()
+	if v := r.URL.Query().Get("seed"); v != "" {
+		var err error
+		seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "seed query parameter must be an integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fallbackKeyword := r.URL.Query().Get("fallbackKeyword")
+
+	minResults := 0
+	if v := r.URL.Query().Get("minResults"); v != "" {
+		var err error
+		minResults, err = strconv.Atoi(v)
+		if err != nil || minResults <= 0 {
+			http.Error(w, "minResults query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	thumbnailHost := r.URL.Query().Get("thumbnailHost")
+	tag := r.URL.Query().Get("tag")
+	normalizeCompany := r.URL.Query().Get("normalizeCompany") == "true"
+	includeHost := r.URL.Query().Get("includeHost") == "true"
+	includeFreshness := r.URL.Query().Get("includeFreshness") == "true"
+	includeTitleLength := r.URL.Query().Get("includeTitleLength") == "true"
+	expandScript := r.URL.Query().Get("expandScript") == "true"
+	var companyIDs map[uint64]bool
+	if v := r.URL.Query().Get("companyIds"); v != "" {
+		var ok bool
+		companyIDs, ok = parseCompanyIDs(v)
+		if !ok {
+			http.Error(w, "companyIds query parameter must be comma-separated numeric IDs", http.StatusBadRequest)
+			return
+		}
+	}
+	minTitleLength, maxTitleLength := 0, 0
+	if v := r.URL.Query().Get("minTitleLength"); v != "" {
+		var err error
+		minTitleLength, err = strconv.Atoi(v)
+		if err != nil || minTitleLength <= 0 {
+			http.Error(w, "minTitleLength query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("maxTitleLength"); v != "" {
+		var err error
+		maxTitleLength, err = strconv.Atoi(v)
+		if err != nil || maxTitleLength <= 0 {
+			http.Error(w, "maxTitleLength query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if maxTitleLength < minTitleLength {
+			http.Error(w, "maxTitleLength must not be less than minTitleLength", http.StatusBadRequest)
+			return
+		}
+	}
+	// from と to はJSTの日付で、どちらもその日を含む
+	var from, to time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		var err error
+		from, err = time.ParseInLocation(dateParamLayout, v, jst)
+		if err != nil {
+			http.Error(w, "from query parameter must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		day, err := time.ParseInLocation(dateParamLayout, v, jst)
+		if err != nil {
+			http.Error(w, "to query parameter must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		if !from.IsZero() && day.Before(from) {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	enrichThumbnails := r.URL.Query().Get("enrichThumbnails") == "true"
+	sparkline := r.URL.Query().Get("sparkline") == "true"
+	aboveMedian := r.URL.Query().Get("aboveMedian") == "true"
+
+	archiveOlderThanDays := 0
+	if v := r.URL.Query().Get("archiveOlderThanDays"); v != "" {
+		var err error
+		archiveOlderThanDays, err = strconv.Atoi(v)
+		if err != nil || archiveOlderThanDays <= 0 {
+			http.Error(w, "archiveOlderThanDays query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	minPercentile := 0.0
+	if v := r.URL.Query().Get("minPercentile"); v != "" {
+		var err error
+		minPercentile, err = strconv.ParseFloat(v, 64)
+		if err != nil || minPercentile < 0 || minPercentile > 1 {
+			http.Error(w, "minPercentile query parameter must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+	}
+	tiers := r.URL.Query().Get("tiers") == "true"
+	topPerTier := 0
+	if v := r.URL.Query().Get("topPerTier"); v != "" {
+		var err error
+		topPerTier, err = strconv.Atoi(v)
+		if err != nil || topPerTier <= 0 {
+			http.Error(w, "topPerTier query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if !tiers {
+			http.Error(w, "topPerTier requires tiers=true", http.StatusBadRequest)
+			return
+		}
+	}
+	thumbnailBoost := r.URL.Query().Get("thumbnailBoost") == "true"
+	summary := r.URL.Query().Get("summary") == "true"
+	engagementRate := r.URL.Query().Get("engagementRate") == "true"
+
+	var newerThan time.Time
+	if v := r.URL.Query().Get("newerThan"); v != "" {
+		var err error
+		newerThan, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "newerThan query parameter must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		if samplePageCount > 0 {
+			http.Error(w, "newerThan cannot be used with samplePages", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sortBy := canonicalSort(r.URL.Query().Get("sort"))
+	if sortBy == "" {
+		sortBy = s.cfg.DefaultSort
+		// 差分の取得では新しい順にする
+		if !newerThan.IsZero() {
+			sortBy = sortDate
+		}
+	}
+	if !isValidSort(sortBy) {
+		http.Error(w, "sort query parameter must be likes (likeCount) or date (publishedDate)", http.StatusBadRequest)
+		return
+	}
+	order := r.URL.Query().Get("order")
+	if order == "" {
+		order = orderDesc
+	}
+	if order != orderDesc && order != orderAsc {
+		http.Error(w, "order query parameter must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	if order == orderAsc && thumbnailBoost {
+		http.Error(w, "thumbnailBoost cannot be used with order=asc", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != modeIDs {
+		http.Error(w, "mode query parameter must be ids", http.StatusBadRequest)
+		return
+	}
+	includeLikes := r.URL.Query().Get("includeLikes") == "true"
+
+	stream := r.URL.Query().Get("stream") == "true"
+	if stream && mode != modeIDs {
+		http.Error(w, "stream=true is only supported with mode=ids", http.StatusBadRequest)
+		return
+	}
+
+	earlyStopLikes := 0
+	if v := r.URL.Query().Get("earlyStopLikes"); v != "" {
+		var err error
+		earlyStopLikes, err = strconv.Atoi(v)
+		if err != nil || earlyStopLikes <= 0 {
+			http.Error(w, "earlyStopLikes query parameter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if limit == 0 || mode == modeIDs {
+			http.Error(w, "earlyStopLikes requires limit and cannot be used with mode=ids", http.StatusBadRequest)
+			return
+		}
+		if samplePageCount > 0 || !newerThan.IsZero() {
+			http.Error(w, "earlyStopLikes cannot be used with samplePages or newerThan", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 管理者だけがこのリクエストの同時リクエスト数を指定できる
+	concurrency := 0
+	if v := r.URL.Query().Get("concurrency"); v != "" {
+		if !s.isAdmin(r) {
+			http.Error(w, "concurrency query parameter requires a valid X-Admin-Key", http.StatusForbidden)
+			return
+		}
+		var err error
+		concurrency, err = strconv.Atoi(v)
+		if err != nil || concurrency <= 0 || concurrency > s.cfg.MaxRequestConcurrency {
+			http.Error(w, fmt.Sprintf("concurrency query parameter must be between 1 and %d", s.cfg.MaxRequestConcurrency), http.StatusBadRequest)
+			return
+		}
+	}
+
+	debug := r.URL.Query().Get("debug") == "true"
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy != "" && groupBy != groupByDayParam {
+		http.Error(w, "groupBy query parameter must be day", http.StatusBadRequest)
+		return
+	}
+
+	if topPerTier > 0 && mode == modeIDs {
+		http.Error(w, "topPerTier cannot be used with mode=ids", http.StatusBadRequest)
+		return
+	}
+
+	weekdays := r.URL.Query().Get("weekdayBreakdown") == "true"
+	if weekdays && mode == modeIDs {
+		http.Error(w, "weekdayBreakdown cannot be used with mode=ids", http.StatusBadRequest)
+		return
+	}
+
+	series := r.URL.Query().Get("series")
+	if series != "" && (series != seriesDailyParam || mode == modeIDs) {
+		http.Error(w, "series query parameter must be daily and cannot be used with mode=ids", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), protobufContentType) {
+		format = formatProtobuf
+	}
+	if format != "" && format != formatJSON && format != formatProtobuf && format != formatHTML {
+		http.Error(w, "format query parameter must be json, protobuf or html", http.StatusBadRequest)
+		return
+	}
+	// protobufの場合に、項目を連結したものではなくJSONと同じくまとめた1つのメッセージで返す
+	envelope := r.URL.Query().Get("envelope") == "true"
+	apiVersion, ok := parseAPIVersion(r)
+	if !ok {
+		http.Error(w, "Accept-Version header must be v1 or v2", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("API-Version", apiVersion)
+
+	// 同じ snapshotId の2回目以降は取得し直さずに、最初に並べた順番のままページを返す
+	snapshotID := r.URL.Query().Get("snapshotId")
+	if snapshotID != "" {
+		if len(snapshotID) > maxSnapshotIDLength {
+			http.Error(w, fmt.Sprintf("snapshotId query parameter must be at most %d characters", maxSnapshotIDLength), http.StatusBadRequest)
+			return
+		}
+		if mode == modeIDs || (format != "" && format != formatJSON) {
+			http.Error(w, "snapshotId is only supported with JSON responses", http.StatusBadRequest)
+			return
+		}
+		if snap, ok := s.snapshots.get(snapshotID); ok {
+			if snap.keyword != keyword {
+				http.Error(w, "snapshotId was created for a different keyword", http.StatusConflict)
+				return
+			}
+			writeSnapshotPage(w, r, snapshotID, snap, offset, limit, apiVersion, start)
+			return
+		}
+	}
+
+	// 保存しておいた前回の結果と順位を比べる
+	var compareTo *snapshot
+	if id := r.URL.Query().Get("compareSnapshot"); id != "" {
+		if mode == modeIDs || (format != "" && format != formatJSON) {
+			http.Error(w, "compareSnapshot is only supported with JSON responses", http.StatusBadRequest)
+			return
+		}
+		snap, ok := s.snapshots.get(id)
+		if !ok {
+			http.Error(w, "compareSnapshot was not found or has expired", http.StatusNotFound)
+			return
+		}
+		if snap.keyword != keyword {
+			http.Error(w, "compareSnapshot was created for a different keyword", http.StatusConflict)
+			return
+		}
+		compareTo = snap
+	}
+
+	// 出力する日時のタイムゾーン
+	loc, ok := parseTimeZone(r.URL.Query().Get("tz"))
+	if !ok {
+		http.Error(w, "tz query parameter must be jst, utc or a valid IANA time zone name", http.StatusBadRequest)
+		return
+	}
+
+	// 日付順で、いいね数を使う絞り込み・集計・表示が無い場合はいいね数を取得しない (includeLikes=true の場合は取得する)
+	// PostProcessor はいいね数を使うかどうか分からないので取得する
+	needsLikes := sortBy == sortLikes || includeLikes || aboveMedian || minPercentile > 0 || tiers || summary ||
+		groupBy != "" || series != "" || weekdays || archiveOlderThanDays > 0 || sparkline || engagementRate ||
+		earlyStopLikes > 0 || format == formatHTML || len(s.postProcessors) > 0
+	opts := crawlOptions{
+		skipLikes:      mode == modeIDs || !needsLikes,
+		debug:          debug,
+		loc:            loc,
+		earlyStopLikes: earlyStopLikes,
+		earlyStopCount: limit,
+		samplePages:    samplePageCount,
+		seed:           seed,
+		newerThan:      newerThan,
+		likeDeadline:   s.likeDeadline(start),
+	}
+	// limit を指定しなかった場合は、広すぎるキーワードで全ページを取得しないようにする
+	if limit == 0 {
+		opts.maxPages = s.cfg.MaxPagesWithoutLimit
+	}
+	// 絞り込みや全件のいいね数が必要な場合は上位N件での打ち切りをしない
+	if s.cfg.TopNShortCircuit && sortBy == sortLikes && order == orderDesc && limit > 0 && offset == 0 && format != formatHTML &&
+		!aboveMedian && minPercentile == 0 && groupBy == "" && archiveOlderThanDays == 0 &&
+		thumbnailHost == "" && tag == "" && companyIDs == nil && minTitleLength == 0 && maxTitleLength == 0 && from.IsZero() && to.IsZero() && len(s.postProcessors) == 0 && earlyStopLikes == 0 && !thumbnailBoost &&
+		newerThan.IsZero() {
+		opts.topN = limit
+	}
+	// 全件が揃ってから処理するものがある場合はまとめて返す
+	// offset を指定した場合も、飛ばす件数と Link ヘッダーのためにまとめて返す
+	var streamer *idStreamer
+	if stream && len(s.postProcessors) == 0 && minResults == 0 && fallbackKeyword == "" && tag == "" && companyIDs == nil && !expandScript &&
+		minTitleLength == 0 && maxTitleLength == 0 && from.IsZero() && to.IsZero() &&
+		newerThan.IsZero() && offset == 0 {
+		streamer = newIDStreamer(w, thumbnailHost, limit)
+		opts.onPage = streamer.writePage
+	}
+
+	ctx := r.Context()
+	if s.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.RequestTimeout)
+		defer cancel()
+	}
+	if concurrency > 0 {
+		ctx = withConcurrencyLimit(ctx, concurrency)
+	}
+	if v := r.URL.Query().Get("nocache"); v == "1" || v == "true" {
+		ctx = withNoCache(ctx)
+	}
+	var diag *diagnostics
+	if s.debugRequested(r) {
+		ctx, diag = withDiagnostics(ctx)
+	}
+
+	crawlStart := time.Now()
+	var warnings []string
+	// 検索APIが404の場合はサーバーのエラーではなく結果が無いものとして返す
+	notFound := func(err error) (*crawlResult, error) {
+		if !errors.Is(err, errSearchNotFound) {
+			return nil, err
+		}
+		log.Println("Search endpoint returned 404:", r.URL)
+		warnings = append(warnings, "PR TIMES search returned 404, no results are available")
+		diag.warn("upstream search returned 404")
+		return &crawlResult{fetchedAt: time.Now()}, nil
+	}
+	// ローマ字とカタカナを入れ替えたキーワードでも並行して検索する
+	var waitVariant func() (*crawlResult, error)
+	variant := ""
+	if expandScript {
+		variant = scriptVariant(keyword)
+	}
+	if variant != "" {
+		variantCtx, cancelVariant := context.WithCancel(ctx)
+		defer cancelVariant()
+		waitVariant = s.crawlAsync(variantCtx, variant, opts)
+	}
+	crawled, err := s.crawl(ctx, keyword, opts)
+	if err != nil {
+		crawled, err = notFound(err)
+	}
+	if err != nil {
+		s.writeFetchError(w, r, err)
+		return
+	}
+	switch {
+	case crawled.negativeCached:
+		w.Header().Set("X-Cache", "NEGATIVE")
+	case crawled.resultCached:
+		w.Header().Set("X-Cache", "HIT")
+	case s.resultCacheable(opts):
+		w.Header().Set("X-Cache", "MISS")
+	}
+	var expandedKeywords []string
+	if waitVariant != nil {
+		variantCrawled, err := waitVariant()
+		if err != nil {
+			s.logFetchError(ctx, "Error fetching data for script variant", variant, ":", err)
+			diag.warn("search for the script variant failed, results only include the original keyword")
+		} else {
+			crawled.items = mergeItems(crawled.items, variantCrawled.items)
+			crawled.likesTruncated = crawled.likesTruncated || variantCrawled.likesTruncated
+			expandedKeywords = []string{variant}
+		}
+	}
+
+	if streamer != nil {
+		if ctx.Err() != context.Canceled {
+			streamer.close()
+		}
+		return
+	}
+
+	// 1件も無かった場合は代わりのキーワードで検索する
+	if len(crawled.items) == 0 && fallbackKeyword != "" && ctx.Err() == nil {
+		crawled, err = s.crawl(ctx, fallbackKeyword, opts)
+		if err != nil {
+			crawled, err = notFound(err)
+		}
+		if err != nil {
+			s.writeFetchError(w, r, err)
+			return
+		}
+		keyword = fallbackKeyword
+		diag.warn("no results for keyword, used fallbackKeyword")
+	}
+	results := crawled.items
+
+	// 件数が足りない場合は検索条件を緩めて追加で取得する
+	var broadenedKeywords []string
+	if minResults > 0 && len(results) < minResults {
+		results, broadenedKeywords = s.broadenSearch(ctx, keyword, results, minResults, opts)
+		if len(broadenedKeywords) > 0 {
+			diag.warn(fmt.Sprintf("fewer than minResults, broadened search to %d keywords", len(broadenedKeywords)))
+		}
+	}
+	crawlTime := time.Since(crawlStart)
+
+	// クライアントが切断した場合は返す必要がない
+	// タイムアウトした場合は取得できた分だけを返す
+	partial := false
+	switch ctx.Err() {
+	case context.Canceled:
+		s.logDebug("Request cancelled by client:", r.URL)
+		return
+	case context.DeadlineExceeded:
+		log.Println("Request timed out, returning partial results:", r.URL)
+		partial = true
+		diag.warn("request timed out, results are partial")
+	}
+	if crawled.truncated {
+		diag.warn("crawl exceeded the server item limit, results are truncated")
+	}
+	// いいね数が揃っていないので、いいね数ではなく日付で並べる
+	if crawled.likesTruncated && mode != modeIDs {
+		log.Println("Soft timeout reached, like counts are incomplete and results are sorted by date:", r.URL)
+		sortBy = sortDate
+		warnings = append(warnings, "like count enrichment was truncated by the soft timeout, results are sorted by date")
+		diag.warn("soft timeout reached, sorted by date instead of likes")
+	}
+	// いいね数が全て0の場合はいいね数で並べても意味が無いので日付で並べる (sort=likes を指定した場合を除く)
+	if sortBy == sortLikes && r.URL.Query().Get("sort") == "" && mode != modeIDs && allZeroLikes(results) {
+		sortBy = sortDate
+		warnings = append(warnings, "all like counts are 0, results are sorted by date")
+		diag.warn("all like counts are 0, sorted by date instead of likes")
+	}
+	if crawled.dedupe.DuplicatePage > 0 {
+		diag.warn(fmt.Sprintf("page %d repeated the previous page, later pages were dropped", crawled.dedupe.DuplicatePage))
+	}
+
+	matchedBeforeFilter := len(results)
+	var fetchedSummary *Summary
+	if summary {
+		sum := summarize(results)
+		fetchedSummary = &sum
+	}
+
+	// 絞り込み → 登録されたPostProcessor → 並び替え → 件数で切る の順に適用する
+	var pipeline []PostProcessor
+	if thumbnailHost != "" {
+		pipeline = append(pipeline, thumbnailHostFilter(thumbnailHost))
+	}
+	if tag != "" {
+		pipeline = append(pipeline, tagFilter(tag))
+	}
+	if companyIDs != nil {
+		pipeline = append(pipeline, companyIDFilter(companyIDs))
+	}
+	if minTitleLength > 0 || maxTitleLength > 0 {
+		pipeline = append(pipeline, titleLengthFilter(minTitleLength, maxTitleLength))
+	}
+	if !from.IsZero() || !to.IsZero() {
+		pipeline = append(pipeline, dateRangeFilter(from, to))
+	}
+	pipeline = append(pipeline, s.postProcessors...)
+	if aboveMedian {
+		pipeline = append(pipeline, filterAboveMedian)
+	}
+	if minPercentile > 0 {
+		pipeline = append(pipeline, filterMinPercentile(minPercentile))
+	}
+	// IDのみ返すモードはいいね数を取得していないのでPR TIMESの並び順のまま返す
+	totalLikes := 0
+	var dayPoints []SeriesPoint
+	var weekdayStats []WeekdayStats
+	sortItems := sortByLikes
+	switch {
+	case sortBy == sortDate && order == orderAsc:
+		sortItems = sortByDateAscending
+	case sortBy == sortDate:
+		sortItems = sortByDate
+	case order == orderAsc:
+		sortItems = sortByLikesAscending
+	case thumbnailBoost:
+		sortItems = sortByLikesThumbnailBoost(s.cfg.ThumbnailBoostBand)
+	}
+	if mode != modeIDs {
+		pipeline = append(pipeline, func(items []ResponseItem) []ResponseItem {
+			// 絞り込み後、件数で切る前の合計いいね数
+			totalLikes = sumLikes(items)
+			if series == seriesDailyParam {
+				dayPoints = dailySeries(items)
+			}
+			if weekdays {
+				weekdayStats = weekdayBreakdown(items)
+			}
+			return items
+		}, sortItems)
+	}
+	// 古いものは件数で切る前に集計だけにする
+	var archived *ArchiveSummary
+	if archiveOlderThanDays > 0 && mode != modeIDs {
+		cutoff := time.Now().AddDate(0, 0, -archiveOlderThanDays)
+		pipeline = append(pipeline, func(items []ResponseItem) []ResponseItem {
+			recent, summary := splitArchived(items, cutoff)
+			archived = &summary
+			return recent
+		})
+	}
+	if tiers {
+		pipeline = append(pipeline, assignTiers(s.cfg.Tiers))
+	}
+	if topPerTier > 0 {
+		pipeline = append(pipeline, capPerTier(topPerTier))
+	}
+	// 件数で切る前の全件を保存しておく (タイムアウトして一部だけの場合は保存しない)
+	if snapshotID != "" && !partial && mode != modeIDs {
+		pipeline = append(pipeline, func(items []ResponseItem) []ResponseItem {
+			s.snapshots.put(snapshotID, &snapshot{
+				keyword:             keyword,
+				items:               append([]ResponseItem{}, items...),
+				totalLikes:          totalLikes,
+				matchedBeforeFilter: matchedBeforeFilter,
+				completeness:        crawled.completeness(),
+				createdAt:           time.Now(),
+			})
+			return items
+		})
+	}
+	// 件数で切る前の順位で比べる
+	var droppedItems []DroppedItem
+	if compareTo != nil {
+		pipeline = append(pipeline, func(items []ResponseItem) []ResponseItem {
+			droppedItems = compareRanks(items, compareTo.items)
+			return items
+		})
+	}
+	// Link ヘッダーで次のページがあるかを決めるための、offset と limit で切る前の件数
+	pagedTotal := 0
+	pipeline = append(pipeline, func(items []ResponseItem) []ResponseItem {
+		pagedTotal = len(items)
+		return items
+	})
+	// HTMLではページ送りのために全件を渡して、表示する範囲だけを切り出す
+	if format != formatHTML {
+		if offset > 0 {
+			pipeline = append(pipeline, offsetItems(offset))
+		}
+		if limit > 0 {
+			pipeline = append(pipeline, limitItems(limit))
+		}
+	}
+	results = runPipeline(results, pipeline)
+	if format != formatHTML {
+		setPaginationLinks(w, r, offset, limit, pagedTotal)
+	}
+
+	if mode == modeIDs {
+		writeJSON(w, toReleaseIDItems(results))
+		return
+	}
+
+	if format == formatHTML {
+		if normalizeCompany {
+			for i := range results {
+				results[i].CorporationName = normalizeCompanyName(results[i].CorporationName)
+			}
+		}
+		pageSize := limit
+		if pageSize == 0 {
+			pageSize = htmlDefaultPageSize
+		}
+		setPaginationLinks(w, r, offset, pageSize, pagedTotal)
+		writeHTML(w, r, keyword, results, offset, pageSize)
+		return
+	}
+
+	// 返す項目についてだけサムネイルのサイズを取得する
+	if enrichThumbnails {
+		s.fillThumbnailSizes(ctx, results)
+	}
+
+	if engagementRate {
+		s.fillEngagementRates(ctx, results)
+	}
+
+	if sparkline {
+		for i := range results {
+			results[i].Sparkline = s.likeHistory.get(results[i].ReleaseID)
+		}
+	}
+
+	// 絞り込みには元の企業名を使い、出力する企業名だけを正規化する
+	if normalizeCompany {
+		for i := range results {
+			results[i].CorporationName = normalizeCompanyName(results[i].CorporationName)
+		}
+	}
+
+	if includeHost {
+		for i := range results {
+			results[i].Host = urlHost(results[i].PostURL)
+		}
+	}
+
+	if includeFreshness {
+		now := time.Now()
+		for i := range results {
+			results[i].Freshness = freshness(results[i].PublishedAt, now, s.cfg.FreshnessHalfLife)
+		}
+	}
+
+	if includeTitleLength {
+		for i := range results {
+			results[i].TitleLength = utf8.RuneCountInString(results[i].Title)
+		}
+	}
+
+	if format == formatProtobuf && !envelope {
+		writeProtobuf(w, marshalProtobufItems(results))
+		return
+	}
+
+	resp := Response{
+		APIVersion:          apiVersion,
+		Keyword:             keyword,
+		Items:               results,
+		TotalLikes:          totalLikes,
+		MatchedBeforeFilter: matchedBeforeFilter,
+		Partial:             partial,
+		Truncated:           crawled.truncated,
+		Completeness:        crawled.completeness(),
+		Warnings:            warnings,
+		Sample:              crawled.sample,
+		SnapshotID:          snapshotID,
+		DroppedItems:        droppedItems,
+		BroadenedKeywords:   broadenedKeywords,
+		ExpandedKeywords:    expandedKeywords,
+		Archived:            archived,
+		Summary:             fetchedSummary,
+		Series:              dayPoints,
+		WeekdayBreakdown:    weekdayStats,
+	}
+	if s.cfg.ResultCacheTTL > 0 {
+		resp.NextRefreshAfter = s.nextRefreshAfter(crawled.fetchedAt)
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", resp.NextRefreshAfter))
+	}
+	if apiVersion == apiVersionV1 && format != formatProtobuf {
+		if results == nil {
+			results = []ResponseItem{}
+		}
+		writeJSON(w, results)
+		return
+	}
+	// 日ごとにまとめる場合は items は空にして days に入れる
+	if groupBy == groupByDayParam {
+		resp.Items = nil
+		resp.Days = groupByDay(results)
+	}
+	if resp.Items == nil {
+		resp.Items = []ResponseItem{}
+	}
+	if debug {
+		resp.Debug = &DebugInfo{Pages: crawled.pages, DedupeReport: &crawled.dedupe}
+	}
+	if diag != nil {
+		resp.Diagnostics = diag.info(crawlTime, crawled.pages)
+	}
+	resp.ServerProcessingMs = time.Since(start).Milliseconds()
+	if format == formatProtobuf {
+		writeProtobuf(w, resp.MarshalProtobuf())
+		return
+	}
+	if r.URL.Query().Get("bigIntAsString") == "true" {
+		writeJSONBigIntAsString(w, resp)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// PR TIMESからの取得に失敗した場合のレスポンス
+// クライアントの切断はエラーとして扱わず、タイムアウトは503を返す
+func (s *Server) writeFetchError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooManyPages *tooManyPagesError
+	switch {
+	case errors.As(err, &tooManyPages):
+		http.Error(w, fmt.Sprintf("Keyword matches %d pages of results (more than %d), specify the limit query parameter or a narrower keyword", tooManyPages.pages, tooManyPages.max), http.StatusBadRequest)
+	case errors.Is(err, context.Canceled):
+		s.logDebug("Request cancelled by client:", r.URL)
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Println("Request timed out:", r.URL)
+		http.Error(w, "Timed out fetching data from PR TIMES API", http.StatusServiceUnavailable)
+	case errors.Is(err, ErrUpstreamContentType):
+		log.Println("Error fetching data:", err)
+		http.Error(w, "PR TIMES API returned a non-JSON response (it may be under maintenance)", http.StatusBadGateway)
+	default:
+		http.Error(w, "Failed to fetch data from PR TIMES API", http.StatusInternalServerError)
+		log.Println("Error fetching data:", err)
+	}
+}
+
+// 結果が古くなるまでの秒数 (取得時刻 + ResultCacheTTL まで)
+func (s *Server) nextRefreshAfter(fetchedAt time.Time) int {
+	remaining := s.cfg.ResultCacheTTL - time.Since(fetchedAt)
+	if remaining <= 0 {
+		return 0
+	}
+	return int(remaining.Round(time.Second) / time.Second)
+}
+
+// Write the JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Println("Error encoding response:", err)
+		return
+	}
+}
+
+func writeProtobuf(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", protobufContentType)
+	if _, err := w.Write(b); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+func toReleaseIDItems(items []ResponseItem) []ReleaseIDItem {
+	ids := make([]ReleaseIDItem, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, ReleaseIDItem{ID: item.ReleaseID, PostURL: item.PostURL})
+	}
+	return ids
+}
+
+// NFKCで全角英数字や半角カナを揃え、前後の空白を除いて連続する空白を1つにまとめる
+func normalizeCompanyName(name string) string {
+	return strings.Join(strings.Fields(norm.NFKC.String(name)), " ")
+}
+
+// URLのホスト (小文字、ポートは除く)。URLとして読めない場合やホストが無い場合は空
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	// url.Parse は数字でないポート (例: "example.com:80x") をホストの一部として読むので除く
+	host := u.Hostname()
+	if strings.Contains(host, ":") && !strings.HasPrefix(u.Host, "[") {
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+// サムネイルURLのホストが一致するものだけを残す (サムネイル無しは除外)
+func filterByThumbnailHost(items []ResponseItem, host string) []ResponseItem {
+	var filtered []ResponseItem
+	for _, item := range items {
+		if item.ThumbnailURL == "" {
+			continue
+		}
+		u, err := url.Parse(item.ThumbnailURL)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Hostname(), host) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,493 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// thumbnailHost を指定した場合は、サムネイルURLのホストが一致するものだけを返す
+func TestThumbnailHostFilter(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 4; n++ {
+		f.addRelease("cdn", n, "2024年12月01日 09時00分", n)
+	}
+	f.setThumbnail("cdn", 1, "https://prtimes.jp/i/1/1/thumb/a.jpg")
+	f.setThumbnail("cdn", 2, "https://cdn.example.com/b.jpg")
+	f.setThumbnail("cdn", 3, "https://PRTIMES.JP:443/i/1/3/thumb/c.jpg")
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=cdn&thumbnailHost=prtimes.jp&sort=date")
+	if len(resp.Items) != 2 {
+		t.Fatalf("got %d items, want 2: %+v", len(resp.Items), resp.Items)
+	}
+	for _, item := range resp.Items {
+		if item.Title != "リリース1" && item.Title != "リリース3" {
+			t.Errorf("unexpected item %q with thumbnail %q", item.Title, item.ThumbnailURL)
+		}
+	}
+}
+
+// mode=ids はいいね数を取得せずに、取得したリリースのIDとURLだけを返す
+func TestModeIDsSkipsLikeCounts(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= searchPageSize+5; n++ {
+		f.addRelease("ids", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=ids&mode=ids")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var ids []ReleaseIDItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != searchPageSize+5 {
+		t.Fatalf("got %d ids, want %d", len(ids), searchPageSize+5)
+	}
+	seen := make(map[string]bool)
+	for _, item := range ids {
+		seen[item.ID] = true
+		if !strings.HasSuffix(item.PostURL, "/main/html/rd/p/"+item.ID+".html") {
+			t.Errorf("postUrl %q does not match id %q", item.PostURL, item.ID)
+		}
+	}
+	for n := 1; n <= searchPageSize+5; n++ {
+		if !seen[fakeReleaseID(n)] {
+			t.Errorf("missing id %s", fakeReleaseID(n))
+		}
+	}
+	if got := f.likeCalls.Load(); got != 0 {
+		t.Errorf("like count calls = %d, want 0", got)
+	}
+}
+
+func TestNormalizeCompanyName(t *testing.T) {
+	for in, want := range map[string]string{
+		"  株式会社　ＰＲ　ＴＩＭＥＳ ": "株式会社 PR TIMES",
+		"ｶﾌﾞｼｷｶﾞｲｼｬ\tテスト":  "カブシキガイシャ テスト",
+		"テスト  株式会社":        "テスト 株式会社",
+		"":                 "",
+	} {
+		if got := normalizeCompanyName(in); got != want {
+			t.Errorf("normalizeCompanyName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// normalizeCompany=true の場合だけ企業名を揃える
+func TestNormalizeCompanyParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("company", 1, "2024年12月01日 09時00分", 1)
+	f.mu.Lock()
+	f.releases["company"][0].CompanyName = " 株式会社　ＡＢＣ  "
+	f.mu.Unlock()
+	s := NewServer(f.config())
+
+	if got := getResponse(t, s, "/prtimes_posts?keyword=company&normalizeCompany=true").Items[0].CorporationName; got != "株式会社 ABC" {
+		t.Errorf("normalized corporationName = %q", got)
+	}
+	if got := getResponse(t, s, "/prtimes_posts?keyword=company").Items[0].CorporationName; got != " 株式会社　ＡＢＣ  " {
+		t.Errorf("corporationName without normalizeCompany = %q", got)
+	}
+}
+
+// totalLikes は絞り込み後、limit で切る前の全件のいいね数の合計
+func TestTotalLikes(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 5; n++ {
+		f.addRelease("total", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=total"); resp.TotalLikes != 15 {
+		t.Errorf("totalLikes = %d, want 15", resp.TotalLikes)
+	}
+	filtered := getResponse(t, s, "/prtimes_posts?keyword=total&aboveMedian=true")
+	if want := sumLikes(filtered.Items); filtered.TotalLikes != want || want == 0 || want == 15 {
+		t.Errorf("aboveMedian: totalLikes = %d, sum of items = %d", filtered.TotalLikes, want)
+	}
+	limited := getResponse(t, s, "/prtimes_posts?keyword=total&aboveMedian=true&limit=1")
+	if len(limited.Items) != 1 {
+		t.Errorf("got %d items, want 1", len(limited.Items))
+	}
+	if limited.TotalLikes != filtered.TotalLikes {
+		t.Errorf("limit changed totalLikes from %d to %d", filtered.TotalLikes, limited.TotalLikes)
+	}
+}
+
+// nextRefreshAfter と Cache-Control: max-age は取得した時刻から結果が古くなるまでの秒数
+func TestNextRefreshAfter(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("refresh", 1, "2024年12月01日 09時00分", 1)
+	cfg := f.config()
+	cfg.ResultCacheTTL = 90 * time.Second
+	s := NewServer(cfg)
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=refresh")
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.NextRefreshAfter < 85 || resp.NextRefreshAfter > 90 {
+		t.Errorf("nextRefreshAfter = %d, want about 90", resp.NextRefreshAfter)
+	}
+	if got, want := rec.Header().Get("Cache-Control"), fmt.Sprintf("max-age=%d", resp.NextRefreshAfter); got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+
+	// 残しておいた結果を使う場合も、残っている期間を超える値は返さない
+	rec = serveAPI(t, s, "/prtimes_posts?keyword=refresh")
+	if got := rec.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("X-Cache = %q, want HIT", got)
+	}
+	var cached Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &cached); err != nil {
+		t.Fatal(err)
+	}
+	if cached.NextRefreshAfter > resp.NextRefreshAfter {
+		t.Errorf("nextRefreshAfter grew from %d to %d on a cache hit", resp.NextRefreshAfter, cached.NextRefreshAfter)
+	}
+}
+
+func TestNextRefreshAfterDisabled(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("refresh", 1, "2024年12月01日 09時00分", 1)
+	cfg := f.config()
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=refresh")
+	if got := rec.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Cache-Control = %q, want none", got)
+	}
+	if strings.Contains(rec.Body.String(), "nextRefreshAfter") {
+		t.Errorf("nextRefreshAfter should be omitted: %s", rec.Body.String())
+	}
+}
+
+// 日付順でいいね数を使うものが無い場合は、いいね数を取得しない
+func TestDateSortSkipsLikeCounts(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("date", 1, "2024年12月01日 09時00分", 5)
+	f.addRelease("date", 2, "2024年12月03日 09時00分", 3)
+	f.addRelease("date", 3, "2024年12月02日 09時00分", 9)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=date&sort=date&debug=true")
+	if got := f.likeCalls.Load(); got != 0 {
+		t.Errorf("like count calls = %d, want 0", got)
+	}
+	if len(resp.Items) != 3 || resp.Items[0].Title != "リリース2" || resp.Items[2].Title != "リリース1" {
+		t.Fatalf("items are not sorted by date: %+v", resp.Items)
+	}
+	for _, item := range resp.Items {
+		if item.LikeCount != 0 || item.LikeCountStatus != likeCountStatusSkipped {
+			t.Errorf("%s: likeCount = %d, likeCountStatus = %q", item.Title, item.LikeCount, item.LikeCountStatus)
+		}
+	}
+
+	// includeLikes=true やいいね数を使うパラメータがある場合は取得する
+	for _, query := range []string{"includeLikes=true", "summary=true", "aboveMedian=true"} {
+		f.likeCalls.Store(0)
+		resp := getResponse(t, s, "/prtimes_posts?keyword=date&sort=date&nocache=1&"+query)
+		if got := f.likeCalls.Load(); got != 3 {
+			t.Errorf("%s: like count calls = %d, want 3", query, got)
+		}
+		if resp.Items[0].LikeCount == 0 {
+			t.Errorf("%s: like counts are missing", query)
+		}
+	}
+}
+
+// クライアントが切断した場合はエラーとしてログに残さず、レスポンスも書かない
+func TestClientCancelIsNotLoggedAsError(t *testing.T) {
+	f := newFakeUpstream(t)
+	entered := make(chan struct{}, 1)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		entered <- struct{}{}
+		<-r.Context().Done()
+		return true
+	}
+	s := NewServer(f.config())
+	logs := captureLog(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=cancel", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	go func() {
+		<-entered
+		cancel()
+	}()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("wrote a response to a cancelled request: %d %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(logs.String(), "Error") || strings.Contains(logs.String(), "timed out") {
+		t.Errorf("cancellation was logged as an error:\n%s", logs.String())
+	}
+}
+
+// 検索の途中でタイムアウトした場合は503を返す
+func TestRequestTimeoutReturns503(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		<-r.Context().Done()
+		return true
+	}
+	cfg := f.config()
+	cfg.RequestTimeout = 100 * time.Millisecond
+	s := NewServer(cfg)
+	logs := captureLog(t)
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=timeout")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	if !strings.Contains(logs.String(), "Request timed out") {
+		t.Errorf("timeout was not logged:\n%s", logs.String())
+	}
+}
+
+// いいね数の取得中にタイムアウトした場合は、取得できた分を partial として返す
+func TestRequestTimeoutReturnsPartial(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("slow", 1, "2024年12月01日 09時00分", 1)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasSuffix(r.URL.Path, "/like_count") {
+			<-r.Context().Done()
+			return true
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.RequestTimeout = 100 * time.Millisecond
+	s := NewServer(cfg)
+	captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=slow")
+	if !resp.Partial {
+		t.Error("partial is not set")
+	}
+	if len(resp.Items) != 1 {
+		t.Errorf("got %d items, want 1", len(resp.Items))
+	}
+}
+
+// keyword が0件の場合は fallbackKeyword で検索し、keyword にそちらを入れる
+func TestFallbackKeyword(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("代わり", 1, "2024年12月01日 09時00分", 2)
+	f.addRelease("代わり", 2, "2024年12月01日 09時00分", 1)
+	f.addRelease("ある", 3, "2024年12月01日 09時00分", 1)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=無い&fallbackKeyword=代わり")
+	if resp.Keyword != "代わり" {
+		t.Errorf("keyword = %q, want 代わり", resp.Keyword)
+	}
+	if len(resp.Items) != 2 || resp.Items[0].Title != "リリース1" {
+		t.Errorf("items = %+v", resp.Items)
+	}
+
+	// 結果がある場合は使わない
+	resp = getResponse(t, s, "/prtimes_posts?keyword=ある&fallbackKeyword=代わり")
+	if resp.Keyword != "ある" || len(resp.Items) != 1 {
+		t.Errorf("keyword = %q, %d items; want ある, 1", resp.Keyword, len(resp.Items))
+	}
+}
+
+// stream=true の場合も、まとめて返す場合と同じバイト列になる
+func TestStreamMatchesBuffered(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= searchPageSize*2+5; n++ {
+		f.addRelease("stream", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	for _, query := range []string{"", "&limit=50", "&limit=3"} {
+		buffered := serveAPI(t, s, "/prtimes_posts?keyword=stream&mode=ids"+query)
+		streamed := serveAPI(t, s, "/prtimes_posts?keyword=stream&mode=ids&stream=true"+query)
+		if buffered.Code != http.StatusOK || streamed.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, %d", query, buffered.Code, streamed.Code)
+		}
+		if buffered.Body.String() != streamed.Body.String() {
+			t.Errorf("%s: streamed body differs\nbuffered: %s\nstreamed: %s", query, buffered.Body.String(), streamed.Body.String())
+		}
+		if !streamed.Flushed {
+			t.Errorf("%s: streamed response was not flushed", query)
+		}
+		var ids []ReleaseIDItem
+		if err := json.Unmarshal(streamed.Body.Bytes(), &ids); err != nil {
+			t.Errorf("%s: streamed body is not a JSON array: %v", query, err)
+		}
+	}
+}
+
+// 0件の場合も空の配列を返す
+func TestStreamEmpty(t *testing.T) {
+	f := newFakeUpstream(t)
+	s := NewServer(f.config())
+	if got := serveAPI(t, s, "/prtimes_posts?keyword=none&mode=ids&stream=true").Body.String(); got != "[]\n" {
+		t.Errorf("body = %q, want []", got)
+	}
+}
+
+// 絞り込みで全て除かれた場合も、絞り込み前の件数でキーワードに一致したことが分かる
+func TestMatchedBeforeFilter(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("filtered", 1, "2024年12月01日 09時00分", 1)
+	f.addRelease("filtered", 2, "2024年12月02日 09時00分", 2)
+	f.addRelease("filtered", 3, "2024年12月03日 09時00分", 3)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=filtered&from=2025-01-01")
+	if len(resp.Items) != 0 {
+		t.Errorf("got %d items, want none after filtering", len(resp.Items))
+	}
+	if resp.MatchedBeforeFilter != 3 {
+		t.Errorf("matchedBeforeFilter = %d, want 3", resp.MatchedBeforeFilter)
+	}
+
+	resp = getResponse(t, s, "/prtimes_posts?keyword=nothing")
+	if len(resp.Items) != 0 || resp.MatchedBeforeFilter != 0 {
+		t.Errorf("unmatched keyword: %d items, matchedBeforeFilter = %d, want 0", len(resp.Items), resp.MatchedBeforeFilter)
+	}
+}
+
+// offset を指定した場合はまとめて返し、飛ばした後の結果と Link ヘッダーを返す
+func TestStreamWithOffset(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 10; n++ {
+		f.addRelease("stream", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	for _, query := range []string{"&offset=4", "&offset=4&limit=3"} {
+		buffered := serveAPI(t, s, "/prtimes_posts?keyword=stream&mode=ids"+query)
+		streamed := serveAPI(t, s, "/prtimes_posts?keyword=stream&mode=ids&stream=true"+query)
+		if streamed.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", query, streamed.Code)
+		}
+		if buffered.Body.String() != streamed.Body.String() {
+			t.Errorf("%s: body differs\nbuffered: %s\nstreamed: %s", query, buffered.Body.String(), streamed.Body.String())
+		}
+		// stream=true を残す以外は同じURL
+		if got, want := strings.ReplaceAll(streamed.Header().Get("Link"), "&stream=true", ""), buffered.Header().Get("Link"); got == "" || got != want {
+			t.Errorf("%s: Link = %q, want %q", query, got, want)
+		}
+	}
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=stream&mode=ids&stream=true&offset=4")
+	var ids []ReleaseIDItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 6 || ids[0].ID != fakeReleaseID(5) {
+		t.Errorf("ids = %+v, want 6 items from %s", ids, fakeReleaseID(5))
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, `rel="prev"`) {
+		t.Errorf("Link = %q, want a prev link", link)
+	}
+}
+
+// 検索APIの404は結果が無いものとして警告付きの空の結果を返し、5xxはエラーのまま返す
+func TestSearchNotFound(t *testing.T) {
+	f := newFakeUpstream(t)
+	var status atomic.Int64
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/keyword_search.php/search" {
+			w.WriteHeader(int(status.Load()))
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+	captureLog(t)
+
+	status.Store(http.StatusNotFound)
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=removed")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("404 upstream: status %d, want 200", rec.Code)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw["items"]) != "[]" {
+		t.Errorf("items = %s, want []", raw["items"])
+	}
+	var resp Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "404") {
+		t.Errorf("warnings = %v, want a note about the 404", resp.Warnings)
+	}
+
+	status.Store(http.StatusInternalServerError)
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=broken"); rec.Code < http.StatusInternalServerError {
+		t.Errorf("500 upstream: status %d, want 5xx", rec.Code)
+	}
+}
+
+// includeHost=true の場合は PostURL のホストを返し、URLとして読めない場合は含めない
+func TestIncludeHost(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("host", n, "2024年12月01日 09時00分", n)
+	}
+	f.mu.Lock()
+	f.releases["host"][1].ReleaseURL = "https://News.Example.COM:8443/release/2"
+	f.releases["host"][2].ReleaseURL = "http://[::1"
+	f.mu.Unlock()
+	s := NewServer(f.config())
+	captureLog(t)
+
+	// 相対URLは BaseURL のホストになる
+	want := map[string]string{
+		"リリース1": "127.0.0.1",
+		"リリース2": "news.example.com",
+		"リリース3": "",
+	}
+	resp := getResponse(t, s, "/prtimes_posts?keyword=host&includeHost=true")
+	if len(resp.Items) != 3 {
+		t.Fatalf("got %d items", len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		if item.Host != want[item.Title] {
+			t.Errorf("%s (%s): host = %q, want %q", item.Title, item.PostURL, item.Host, want[item.Title])
+		}
+	}
+
+	// 指定しない場合は含めない
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=host").Items {
+		if item.Host != "" {
+			t.Errorf("%s: host = %q without includeHost", item.Title, item.Host)
+		}
+	}
+}
+
+func TestURLHost(t *testing.T) {
+	tests := map[string]string{
+		"https://prtimes.jp/main/html/rd/p/000000001.000000001.html": "prtimes.jp",
+		"https://PRTimes.JP:443/a":                                   "prtimes.jp",
+		"http://[::1]:8080/a":                                        "::1",
+		"/main/html/rd/p/000000001.000000001.html":                   "",
+		"http://[::1":              "",
+		"http://example.com:80x/a": "",
+		"":                         "",
+	}
+	for rawURL, want := range tests {
+		if got := urlHost(rawURL); got != want {
+			t.Errorf("urlHost(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
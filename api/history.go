@@ -0,0 +1,178 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// いいね数を取得した時点の値
+type LikeSample struct {
+	At        time.Time `json:"at"`
+	LikeCount int       `json:"likeCount"`
+}
+
+// リリースごとのいいね数の履歴 (メモリ上にのみ持つ)
+// リリースごとに新しいものから max 件だけ残す
+// キーワードは最近使った maxKeywords 個だけを覚えておき、捨てたキーワードでしか見つかっていないリリースの履歴も捨てる
+// /release で1件だけ取得したリリースも同じ上限の中で1個として数える
+type likeHistory struct {
+	mu      sync.Mutex
+	max     int
+	samples map[string][]LikeSample
+	// キーワードごとに前回の取得で見つかったリリース (最近使ったものが先頭)
+	maxKeywords int
+	keywords    map[string]*list.Element
+	// キーワードを通さずに取得したリリース (lru にはキーワードと合わせて入れる)
+	singles map[string]*list.Element
+	lru     *list.List
+	// リリースがいくつのキーワードで見つかっているか
+	refs map[string]int
+}
+
+// lru の要素
+type keywordEntry struct {
+	// single の場合はリリースID
+	keyword    string
+	single     bool
+	releaseIDs []string
+}
+
+func newLikeHistory(max, maxKeywords int) *likeHistory {
+	return &likeHistory{
+		max:         max,
+		samples:     make(map[string][]LikeSample),
+		maxKeywords: maxKeywords,
+		keywords:    make(map[string]*list.Element),
+		singles:     make(map[string]*list.Element),
+		lru:         list.New(),
+		refs:        make(map[string]int),
+	}
+}
+
+func (h *likeHistory) record(releaseID string, likeCount int, at time.Time) {
+	if h.max <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := append(h.samples[releaseID], LikeSample{At: at, LikeCount: likeCount})
+	if len(samples) > h.max {
+		samples = samples[len(samples)-h.max:]
+	}
+	h.samples[releaseID] = samples
+}
+
+// 古い順に返す
+func (h *likeHistory) get(releaseID string) []LikeSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]LikeSample(nil), h.samples[releaseID]...)
+}
+
+// keyword で見つかったリリースを覚えておく (前回の分は置き換える)
+// maxKeywords を超えた場合は最も前に使ったキーワードを捨てる
+func (h *likeHistory) recordKeyword(keyword string, releaseIDs []string) {
+	h.touch(h.keywords, &keywordEntry{keyword: keyword, releaseIDs: releaseIDs})
+}
+
+// キーワードを通さずに取得したリリースを、キーワードと同じ上限の中で覚えておく
+func (h *likeHistory) recordRelease(releaseID string) {
+	h.touch(h.singles, &keywordEntry{keyword: releaseID, single: true, releaseIDs: []string{releaseID}})
+}
+
+// entries (keywords か singles) の entry.keyword を entry で置き換えて最近使ったものにする
+func (h *likeHistory) touch(entries map[string]*list.Element, entry *keywordEntry) {
+	if h.max <= 0 || h.maxKeywords <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.retain(entry.releaseIDs)
+	if elem, ok := entries[entry.keyword]; ok {
+		h.release(elem.Value.(*keywordEntry).releaseIDs, false)
+		elem.Value = entry
+		h.lru.MoveToFront(elem)
+		return
+	}
+	entries[entry.keyword] = h.lru.PushFront(entry)
+	for h.lru.Len() > h.maxKeywords {
+		oldest := h.lru.Back()
+		entry := oldest.Value.(*keywordEntry)
+		h.lru.Remove(oldest)
+		if entry.single {
+			delete(h.singles, entry.keyword)
+		} else {
+			delete(h.keywords, entry.keyword)
+		}
+		h.release(entry.releaseIDs, false)
+	}
+}
+
+// mu を持った状態で呼ぶ
+func (h *likeHistory) retain(releaseIDs []string) {
+	for _, id := range releaseIDs {
+		h.refs[id]++
+	}
+}
+
+// mu を持った状態で呼ぶ
+// どのキーワードでも見つかっていないリリースになった場合、または force の場合は履歴を捨てる
+// 履歴を捨てたリリースの数を返す
+func (h *likeHistory) release(releaseIDs []string, force bool) int {
+	dropped := 0
+	for _, id := range releaseIDs {
+		h.refs[id]--
+		if h.refs[id] <= 0 {
+			delete(h.refs, id)
+		} else if !force {
+			continue
+		}
+		if _, ok := h.samples[id]; ok {
+			delete(h.samples, id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// keyword で前回見つかったリリース
+func (h *likeHistory) keywordReleaseIDs(keyword string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	elem, ok := h.keywords[keyword]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), elem.Value.(*keywordEntry).releaseIDs...)
+}
+
+// 全て捨てて、捨てたキーワードとリリースの数を返す
+func (h *likeHistory) flush() (keywords, releases int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keywords, releases = len(h.keywords), len(h.samples)
+	h.keywords = make(map[string]*list.Element)
+	h.singles = make(map[string]*list.Element)
+	h.lru.Init()
+	h.refs = make(map[string]int)
+	h.samples = make(map[string][]LikeSample)
+	return keywords, releases
+}
+
+// keyword で見つかったリリースのいいね数だけを捨てる
+// 他のキーワードでも見つかったリリースも捨てる
+func (h *likeHistory) flushKeyword(keyword string) (keywords, releases int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	elem, ok := h.keywords[keyword]
+	if !ok {
+		return 0, 0
+	}
+	entry := elem.Value.(*keywordEntry)
+	h.lru.Remove(elem)
+	delete(h.keywords, keyword)
+	return 1, h.release(entry.releaseIDs, true)
+}
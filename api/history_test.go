@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// リリースごとに新しいものから max 件だけ残す
+func TestLikeHistoryBounded(t *testing.T) {
+	h := newLikeHistory(3, 10)
+	start := time.Date(2024, 12, 1, 9, 0, 0, 0, jst)
+	for i := 0; i < 5; i++ {
+		h.record("a", i*10, start.Add(time.Duration(i)*time.Hour))
+	}
+	samples := h.get("a")
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(samples))
+	}
+	for i, sample := range samples {
+		if sample.LikeCount != (i+2)*10 || !sample.At.Equal(start.Add(time.Duration(i+2)*time.Hour)) {
+			t.Errorf("sample %d = %+v", i, sample)
+		}
+	}
+	if got := h.get("unknown"); len(got) != 0 {
+		t.Errorf("unknown release has samples %v", got)
+	}
+}
+
+// sparkline=true の場合は取得するたびのいいね数を古い順に返す (初めての場合は1点)
+func TestSparkline(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("spark", 1, "2024年12月01日 09時00分", 1)
+	s := NewServer(f.config())
+
+	for i, likes := range []int{1, 4, 9} {
+		f.mu.Lock()
+		f.likes[fakeReleaseID(1)] = likes
+		f.mu.Unlock()
+		resp := getResponse(t, s, "/prtimes_posts?keyword=spark&sparkline=true&nocache=1")
+		sparkline := resp.Items[0].Sparkline
+		if len(sparkline) != i+1 {
+			t.Fatalf("request %d: got %d points, want %d", i, len(sparkline), i+1)
+		}
+		if last := sparkline[len(sparkline)-1]; last.LikeCount != likes || last.At.IsZero() {
+			t.Errorf("request %d: last point = %+v, want %d likes", i, last, likes)
+		}
+		if i > 0 && sparkline[0].LikeCount != 1 {
+			t.Errorf("request %d: first point = %+v, want 1 like", i, sparkline[0])
+		}
+	}
+
+	// sparkline を指定しない場合は含めない
+	if got := getResponse(t, s, "/prtimes_posts?keyword=spark").Items[0].Sparkline; got != nil {
+		t.Errorf("sparkline without sparkline=true: %v", got)
+	}
+}
+
+// maxKeywords を超えた場合は最も前に使ったキーワードと、そのキーワードでしか見つかっていないリリースの履歴を捨てる
+func TestLikeHistoryEvictsOldestKeyword(t *testing.T) {
+	h := newLikeHistory(3, 2)
+	now := time.Now()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		h.record(id, 1, now)
+	}
+	h.recordKeyword("k1", []string{"a", "b"})
+	h.recordKeyword("k2", []string{"b", "c"})
+	// k1 を使ったので、次に捨てるのは k2
+	h.recordKeyword("k1", []string{"a", "b"})
+	h.recordKeyword("k3", []string{"d"})
+
+	if got := h.keywordReleaseIDs("k2"); got != nil {
+		t.Errorf("k2 was not evicted: %v", got)
+	}
+	if got := h.get("c"); len(got) != 0 {
+		t.Errorf("history of a release only found by k2 was kept: %v", got)
+	}
+	for _, id := range []string{"a", "b", "d"} {
+		if got := h.get(id); len(got) != 1 {
+			t.Errorf("history of %s = %v", id, got)
+		}
+	}
+}
+
+// キーワードを通さずに取得したリリースも、キーワードと同じ上限の中で捨てる
+func TestLikeHistoryBoundsSingleReleases(t *testing.T) {
+	h := newLikeHistory(3, 2)
+	now := time.Now()
+	for _, id := range []string{"a", "b", "c"} {
+		h.record(id, 1, now)
+	}
+	h.recordKeyword("k1", []string{"a"})
+	h.recordRelease("b")
+	h.recordRelease("c")
+
+	if got := h.keywordReleaseIDs("k1"); got != nil {
+		t.Errorf("k1 was not evicted: %v", got)
+	}
+	if got := h.get("a"); len(got) != 0 {
+		t.Errorf("history of a = %v", got)
+	}
+	// キーワードでも見つかっているリリースは、キーワードを捨てるまで残す
+	h.recordKeyword("k2", []string{"b"})
+	h.recordRelease("a")
+	if got := h.get("b"); len(got) != 1 {
+		t.Errorf("history of b = %v", got)
+	}
+	if got := h.get("c"); len(got) != 0 {
+		t.Errorf("history of c = %v", got)
+	}
+
+	if keywords, releases := h.flush(); keywords != 1 || releases != 1 {
+		t.Errorf("flush() = %d keywords, %d releases, want 1, 1", keywords, releases)
+	}
+}
+
+// /release で取得したリリースの履歴も MaxCachedKeywords で捨てる
+func TestReleaseHistoryBounded(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("release", n, "", n)
+	}
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		return r.URL.Path != "/api/keyword_search.php/search" && !strings.HasSuffix(r.URL.Path, "/like_count")
+	}
+	cfg := f.config()
+	cfg.MaxCachedKeywords = 2
+	s := NewServer(cfg)
+	captureLog(t)
+
+	for n := 1; n <= 3; n++ {
+		if rec := serveAPI(t, s, "/release?url="+url.QueryEscape(f.URL+fakeReleaseURL(n))); rec.Code != http.StatusOK {
+			t.Fatalf("release %d: status %d", n, rec.Code)
+		}
+	}
+	if got := s.likeHistory.get(fakeReleaseID(1)); len(got) != 0 {
+		t.Errorf("history of the oldest release was kept: %v", got)
+	}
+	for n := 2; n <= 3; n++ {
+		if got := s.likeHistory.get(fakeReleaseID(n)); len(got) != 1 || got[0].LikeCount != n {
+			t.Errorf("history of release %d = %v", n, got)
+		}
+	}
+}
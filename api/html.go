@@ -0,0 +1,88 @@
+package api
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// format=html で limit を指定しなかった場合の1ページの件数
+const htmlDefaultPageSize = 20
+
+// format=html で返すページ
+type htmlPage struct {
+	Keyword string
+	Items   []ResponseItem
+	// 絞り込み後の全件数と、このページの範囲 (1始まり)
+	Total int
+	From  int
+	To    int
+	// 前後のページのURL (無い場合は空)
+	PrevURL string
+	NextURL string
+}
+
+var htmlTemplate = template.Must(template.New("feed").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>{{.Keyword}} - PR TIMES</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border-bottom: 1px solid #ddd; padding: 0.5em; text-align: left; vertical-align: top; }
+img { max-width: 120px; }
+nav a { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Keyword}}</h1>
+<p>{{if .Items}}{{.From}}〜{{.To}}件目 / {{.Total}}件{{else}}0件{{end}}</p>
+<table>
+<tr><th></th><th>タイトル</th><th>企業名</th><th>公開日時</th><th>いいね数</th></tr>
+{{range .Items}}<tr>
+<td>{{if .ThumbnailURL}}<img src="{{.ThumbnailURL}}" alt="">{{end}}</td>
+<td><a href="{{.PostURL}}">{{.Title}}</a></td>
+<td>{{.CorporationName}}</td>
+<td>{{.PublishedDate}}</td>
+<td>{{.LikeCount}}</td>
+</tr>
+{{end}}</table>
+<nav>
+{{if .PrevURL}}<a href="{{.PrevURL}}" rel="prev">前のページ</a>{{end}}
+{{if .NextURL}}<a href="{{.NextURL}}" rel="next">次のページ</a>{{end}}
+</nav>
+</body>
+</html>
+`))
+
+// 今のクエリパラメータを残して offset だけを変えたURL
+func pageURL(r *http.Request, offset int) string {
+	query := r.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	u := url.URL{Path: mountPrefix(r) + r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// items は絞り込みと並び替えの後、offset と limit で切る前の全件
+func writeHTML(w http.ResponseWriter, r *http.Request, keyword string, items []ResponseItem, offset, limit int) {
+	page := htmlPage{Keyword: keyword, Total: len(items)}
+	if offset < len(items) {
+		page.Items = items[offset:min(offset+limit, len(items))]
+		page.From = offset + 1
+		page.To = offset + len(page.Items)
+	}
+	if offset > 0 {
+		page.PrevURL = pageURL(r, max(offset-limit, 0))
+	}
+	if offset+limit < len(items) {
+		page.NextURL = pageURL(r, offset+limit)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := htmlTemplate.Execute(w, page); err != nil {
+		log.Println("Error rendering HTML:", err)
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+// 途中のページでは、今のクエリパラメータを残して offset だけを変えた前後のページへのリンクを出す
+func TestHTMLPaginationLinks(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 10; n++ {
+		f.addRelease("feed", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=feed&format=html&limit=3&offset=3&normalizeCompany=true")
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body := html.UnescapeString(rec.Body.String())
+	prev := `href="/prtimes_posts?format=html&keyword=feed&limit=3&normalizeCompany=true&offset=0" rel="prev"`
+	next := `href="/prtimes_posts?format=html&keyword=feed&limit=3&normalizeCompany=true&offset=6" rel="next"`
+	for _, want := range []string{prev, next, "4〜6件目 / 10件"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %s\n%s", want, body)
+		}
+	}
+	// 4〜6番目 (いいね数7, 6, 5) だけを表示する
+	for _, title := range []string{"リリース7", "リリース6", "リリース5"} {
+		if !strings.Contains(body, ">"+title+"<") {
+			t.Errorf("body does not contain %s", title)
+		}
+	}
+	for _, title := range []string{"リリース8", "リリース4"} {
+		if strings.Contains(body, ">"+title+"<") {
+			t.Errorf("body contains %s from another page", title)
+		}
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, `offset=6>; rel="next"`) || !strings.Contains(link, `offset=0>; rel="prev"`) {
+		t.Errorf("Link = %s", link)
+	}
+}
+
+// 最初のページには前へ、最後のページには次へのリンクを出さない
+func TestHTMLPaginationEdges(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 5; n++ {
+		f.addRelease("feed", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	first := serveAPI(t, s, "/prtimes_posts?keyword=feed&format=html&limit=3").Body.String()
+	if strings.Contains(first, `rel="prev"`) || !strings.Contains(first, `rel="next"`) {
+		t.Errorf("first page links are wrong:\n%s", first)
+	}
+	last := serveAPI(t, s, "/prtimes_posts?keyword=feed&format=html&limit=3&offset=3").Body.String()
+	if !strings.Contains(last, `rel="prev"`) || strings.Contains(last, `rel="next"`) {
+		t.Errorf("last page links are wrong:\n%s", last)
+	}
+}
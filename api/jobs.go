@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ジョブの状態
+const (
+	jobStatusRunning   = "running"
+	jobStatusDone      = "done"
+	jobStatusCancelled = "cancelled"
+)
+
+// Prefer: respond-async で受け付けたリクエスト
+type job struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	cancel context.CancelFunc
+	// 終わった後のレスポンス
+	result *jobRecorder
+}
+
+// 実行中のジョブの数を制限し、終わってから JobTTL が過ぎたジョブを捨てる
+type jobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	running int
+	max     int
+	ttl     time.Duration
+}
+
+func newJobStore(max int, ttl time.Duration) *jobStore {
+	return &jobStore{jobs: make(map[string]*job), max: max, ttl: ttl}
+}
+
+// 実行中のジョブが上限に達している場合は nil を返す
+func (st *jobStore) start(cancel context.CancelFunc) *job {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire()
+	if st.running >= st.max {
+		return nil
+	}
+	j := &job{ID: newJobID(), Status: jobStatusRunning, CreatedAt: time.Now(), cancel: cancel}
+	st.jobs[j.ID] = j
+	st.running++
+	return j
+}
+
+func (st *jobStore) finish(j *job, result *jobRecorder) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	j.CompletedAt = &now
+	if j.Status == jobStatusRunning {
+		j.Status = jobStatusDone
+		j.result = result
+	}
+	st.running--
+}
+
+// 呼び出し側で書き換えないようにコピーを返す
+func (st *jobStore) get(id string) (job, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire()
+	j, ok := st.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// 実行中のジョブを止める (終わったジョブは何もしない)
+func (st *jobStore) cancel(id string) (job, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	j, ok := st.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	if j.Status == jobStatusRunning {
+		j.Status = jobStatusCancelled
+		j.cancel()
+	}
+	return *j, true
+}
+
+// mu を持った状態で呼ぶ
+func (st *jobStore) expire() {
+	for id, j := range st.jobs {
+		if j.CompletedAt != nil && time.Since(*j.CompletedAt) > st.ttl {
+			delete(st.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ジョブのレスポンスを溜めておくResponseWriter
+type jobRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newJobRecorder() *jobRecorder {
+	return &jobRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *jobRecorder) Header() http.Header { return rec.header }
+
+func (rec *jobRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+
+func (rec *jobRecorder) WriteHeader(status int) { rec.status = status }
+
+// Prefer: respond-async が指定された場合は 202 とジョブのURLを返し、バックグラウンドで処理する
+// クライアントが切断しても止めず、DELETE /jobs/{id} でだけ止める
+func (s *Server) respondAsync(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Prefer"), "respond-async") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		j := s.jobs.start(cancel)
+		if j == nil {
+			cancel()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many jobs running", http.StatusServiceUnavailable)
+			return
+		}
+
+		go func() {
+			defer cancel()
+			rec := newJobRecorder()
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			s.jobs.finish(j, rec)
+		}()
+
+		w.Header().Set("Location", mountPrefix(r)+"/jobs/"+j.ID)
+		w.Header().Set("Preference-Applied", "respond-async")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, job{ID: j.ID, Status: j.Status, CreatedAt: j.CreatedAt})
+	})
+}
+
+// http.StripPrefix でマウントされている場合に取り除かれた部分
+func mountPrefix(r *http.Request) string {
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	return strings.TrimSuffix(path, r.URL.Path)
+}
+
+// GET /jobs/{id} はジョブの状態を返し、DELETE は実行中のジョブを止める
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var j job
+	var ok bool
+	switch r.Method {
+	case http.MethodGet:
+		j, ok = s.jobs.get(id)
+	case http.MethodDelete:
+		j, ok = s.jobs.cancel(id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, j)
+}
+
+// GET /jobs/{id}/result は終わったジョブのレスポンスをそのまま返す
+// 実行中の場合は 202 とジョブの状態を返す
+func (s *Server) handleJobResult(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	switch j.Status {
+	case jobStatusRunning:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		writeJSON(w, j)
+		return
+	case jobStatusCancelled:
+		http.Error(w, "Job was cancelled", http.StatusGone)
+		return
+	}
+
+	for name, values := range j.result.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(j.result.status)
+	w.Write(j.result.body.Bytes())
+}
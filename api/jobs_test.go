@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 検索を止めておけるPR TIMES
+func newBlockingUpstream(t *testing.T) (*fakeUpstream, chan struct{}) {
+	t.Helper()
+	f := newFakeUpstream(t)
+	f.addRelease("export", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("export", 2, "2024年12月02日 09時00分", 5)
+	unblock := make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/keyword_search.php/search" {
+			<-unblock
+		}
+		return false
+	}
+	return f, unblock
+}
+
+func serveAsync(t *testing.T, s *Server, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Prefer", "respond-async")
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeJob(t *testing.T, rec *httptest.ResponseRecorder) job {
+	t.Helper()
+	var j job
+	if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil {
+		t.Fatalf("decoding job: %v (%s)", err, rec.Body.String())
+	}
+	return j
+}
+
+// 受け付け → 状態の確認 → 結果の取得
+func TestAsyncJobLifecycle(t *testing.T) {
+	f, unblock := newBlockingUpstream(t)
+	s := NewServer(f.config())
+
+	rec := serveAsync(t, s, "/prtimes_posts?keyword=export")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202", rec.Code)
+	}
+	j := decodeJob(t, rec)
+	if j.ID == "" || j.Status != jobStatusRunning {
+		t.Fatalf("unexpected job %+v", j)
+	}
+	if got, want := rec.Header().Get("Location"), "/jobs/"+j.ID; got != want {
+		t.Errorf("Location = %s, want %s", got, want)
+	}
+
+	if rec := serveAPI(t, s, "/jobs/"+j.ID+"/result"); rec.Code != http.StatusAccepted {
+		t.Errorf("result while running: status %d, want 202", rec.Code)
+	}
+	close(unblock)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if status := decodeJob(t, serveAPI(t, s, "/jobs/"+j.ID)); status.Status == jobStatusDone {
+			if status.CompletedAt == nil {
+				t.Error("completedAt is missing")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp := getResponse(t, s, "/jobs/"+j.ID+"/result")
+	if got := likeCounts(resp.Items); len(got) != 2 || got[0] != 5 || got[1] != 3 {
+		t.Errorf("likes = %v, want [5 3]", got)
+	}
+}
+
+func TestAsyncJobLimitAndCancel(t *testing.T) {
+	f, unblock := newBlockingUpstream(t)
+	defer close(unblock)
+	cfg := f.config()
+	cfg.MaxJobs = 1
+	s := NewServer(cfg)
+	captureLog(t)
+
+	j := decodeJob(t, serveAsync(t, s, "/prtimes_posts?keyword=export"))
+	if rec := serveAsync(t, s, "/prtimes_posts?keyword=export"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("second job: status %d, want 503", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/jobs/"+j.ID, nil)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if got := decodeJob(t, rec); got.Status != jobStatusCancelled {
+		t.Errorf("status after DELETE = %s, want cancelled", got.Status)
+	}
+	if rec := serveAPI(t, s, "/jobs/"+j.ID+"/result"); rec.Code != http.StatusGone {
+		t.Errorf("result of cancelled job: status %d, want 410", rec.Code)
+	}
+	if rec := serveAPI(t, s, "/jobs/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", rec.Code)
+	}
+}
+
+// 終わってから ttl が過ぎたジョブは捨てる
+func TestJobStoreExpires(t *testing.T) {
+	st := newJobStore(1, 10*time.Millisecond)
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j := st.start(cancel)
+	st.finish(j, newJobRecorder())
+	if _, ok := st.get(j.ID); !ok {
+		t.Fatal("finished job should still be available")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := st.get(j.ID); ok {
+		t.Error("expired job is still available")
+	}
+	if st.start(cancel) == nil {
+		t.Error("finished jobs should not count against the limit")
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ワーカーの数はリリースの数に比例し、LikeCountWorkersMin〜LikeCountWorkersMax (とリリースの数) に収める
+func TestLikeCountWorkers(t *testing.T) {
+	s := &Server{cfg: Config{LikeCountWorkersMin: 2, LikeCountWorkersMax: 8, LikeCountItemsPerWorker: 10}}
+	tests := []struct {
+		items int
+		want  int
+	}{
+		{0, 0},
+		{1, 1},
+		{5, 2},
+		{35, 4},
+		{80, 8},
+		{10000, 8},
+	}
+	for _, tt := range tests {
+		if got := s.likeCountWorkers(tt.items); got != tt.want {
+			t.Errorf("likeCountWorkers(%d) = %d, want %d", tt.items, got, tt.want)
+		}
+	}
+}
+
+// LikeCountWorkersMax を超えて同時に取得しない
+func TestLikeCountWorkersLimitConcurrency(t *testing.T) {
+	f, peak := newConcurrencyUpstream(t)
+	cfg := f.config()
+	cfg.LikeCountWorkersMax = 3
+	cfg.LikeCountItemsPerWorker = 1
+	s := NewServer(cfg)
+
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=backfill").Items); got != 20 {
+		t.Fatalf("got %d items", got)
+	}
+	if got := peak(); got > 3 || got < 2 {
+		t.Errorf("peak in-flight like count requests = %d, want 2 to 3", got)
+	}
+}
+
+// LikeCountWaveSize 件ずつ同時に取得し、前の分が全て終わってから次を始める
+func TestLikeCountWaves(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 10; n++ {
+		f.addRelease("waves", n, "2024年12月01日 09時00分", n)
+	}
+	type span struct{ start, end time.Time }
+	var mu sync.Mutex
+	var spans []span
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/like_count") {
+			return false
+		}
+		start := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		spans = append(spans, span{start, time.Now()})
+		mu.Unlock()
+		return false
+	}
+	cfg := f.config()
+	cfg.LikeCountWaveSize = 4
+	s := NewServer(cfg)
+
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=waves").Items); got != 10 {
+		t.Fatalf("got %d items", got)
+	}
+	if len(spans) != 10 {
+		t.Fatalf("got %d like count requests, want 10", len(spans))
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+	// 4件, 4件, 2件の順
+	waves := [][]span{spans[:4], spans[4:8], spans[8:]}
+	for i := 1; i < len(waves); i++ {
+		var prevEnd time.Time
+		for _, sp := range waves[i-1] {
+			if sp.end.After(prevEnd) {
+				prevEnd = sp.end
+			}
+		}
+		if first := waves[i][0].start; first.Before(prevEnd) {
+			t.Errorf("wave %d started %v before the previous wave finished", i+1, prevEnd.Sub(first))
+		}
+	}
+	// 同じ波の中では並行して取得する
+	for i, wave := range waves {
+		if last, first := wave[len(wave)-1].start, wave[0].end; !last.Before(first) {
+			t.Errorf("wave %d was not fetched concurrently", i+1)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ページ送りのURLを Link ヘッダー (RFC 8288) で返す
+// total は offset と limit で切る前の全件数。limit も offset も指定しない場合は全件を返しているので何もしない
+// 最後のページでは next を、最初のページでは prev を含めない
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, offset, limit, total int) {
+	if limit <= 0 && offset <= 0 {
+		return
+	}
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(r, 0))}
+	if offset > 0 {
+		// limit を指定しない場合は先頭から offset までを前のページとする
+		prev := 0
+		if limit > 0 {
+			prev = max(offset-limit, 0)
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, prev)))
+	}
+	if limit > 0 && offset+limit < total {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, offset+limit)))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
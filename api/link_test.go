@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+// 今のクエリパラメータを残して offset だけを変えた URL を返し、最後のページでは next を含めない
+func TestPaginationLinks(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 5; n++ {
+		f.addRelease("link", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		query, want string
+	}{
+		{
+			"keyword=link&limit=2",
+			`</prtimes_posts?keyword=link&limit=2&offset=0>; rel="first", ` +
+				`</prtimes_posts?keyword=link&limit=2&offset=2>; rel="next"`,
+		},
+		{
+			"keyword=link&limit=2&offset=2",
+			`</prtimes_posts?keyword=link&limit=2&offset=0>; rel="first", ` +
+				`</prtimes_posts?keyword=link&limit=2&offset=0>; rel="prev", ` +
+				`</prtimes_posts?keyword=link&limit=2&offset=4>; rel="next"`,
+		},
+		{
+			"keyword=link&limit=2&offset=4",
+			`</prtimes_posts?keyword=link&limit=2&offset=0>; rel="first", ` +
+				`</prtimes_posts?keyword=link&limit=2&offset=2>; rel="prev"`,
+		},
+		{"keyword=link", ""},
+	} {
+		rec := serveAPI(t, s, "/prtimes_posts?"+tt.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.query, rec.Code)
+		}
+		if got := rec.Header().Get("Link"); got != tt.want {
+			t.Errorf("%s: Link = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
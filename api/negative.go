@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// 検索結果が0件だったキーワードを NegativeCacheTTL の間覚えておき、PR TIMESへ問い合わせずに0件として返す
+func negativeCacheKey(keyword string) string {
+	return "negative:" + keywordCacheKey(keyword)
+}
+
+func (s *Server) isNegativeCached(ctx context.Context, keyword string) bool {
+	if s.cfg.NegativeCacheTTL <= 0 || noCache(ctx) {
+		return false
+	}
+	_, ok, err := s.cache.Get(ctx, negativeCacheKey(keyword))
+	if err != nil {
+		log.Printf("Error reading negative cache for %q: %v", keyword, err)
+		return false
+	}
+	return ok
+}
+
+// 全ページを確かめて0件だった場合だけ覚え、結果があった場合は前に覚えたものを捨てる
+func (s *Server) updateNegativeCache(ctx context.Context, keyword string, result *crawlResult, opts crawlOptions) {
+	if s.cfg.NegativeCacheTTL <= 0 || ctx.Err() != nil {
+		return
+	}
+	key := negativeCacheKey(keyword)
+	if len(result.items) > 0 {
+		if _, err := s.cache.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting negative cache for %q: %v", keyword, err)
+		}
+		return
+	}
+	// newerThan やサンプリングの場合は0件でもキーワード自体に結果が無いとは限らない
+	if !opts.newerThan.IsZero() || result.sample != nil || result.completeness() < 1 {
+		return
+	}
+	if err := s.cache.Set(ctx, key, []byte(time.Now().Format(time.RFC3339)), s.cfg.NegativeCacheTTL); err != nil {
+		log.Printf("Error caching negative result for %q: %v", keyword, err)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 0件だったキーワードは NegativeCacheTTL の間PR TIMESへ問い合わせずに0件を返す
+func TestNegativeCache(t *testing.T) {
+	f := newFakeUpstream(t)
+	cfg := f.config()
+	cfg.NegativeCacheTTL = time.Minute
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=empty"); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") == "NEGATIVE" {
+		t.Fatalf("first request: status %d, X-Cache %q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	searchCalls := f.searchCalls.Load()
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=empty")
+	if rec.Header().Get("X-Cache") != "NEGATIVE" {
+		t.Errorf("X-Cache = %q, want NEGATIVE", rec.Header().Get("X-Cache"))
+	}
+	if got := getResponse(t, s, "/prtimes_posts?keyword=empty"); len(got.Items) != 0 {
+		t.Errorf("got %d items from the negative cache", len(got.Items))
+	}
+	if got := f.searchCalls.Load(); got != searchCalls {
+		t.Errorf("searched %d more times for a negative cached keyword", got-searchCalls)
+	}
+
+	// 結果が出てから nocache で取得し直すと、覚えていた0件を捨てる
+	f.addRelease("empty", 1, "2024年12月01日 09時00分", 5)
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=empty&nocache=1").Items); got != 1 {
+		t.Fatalf("nocache: got %d items, want 1", got)
+	}
+	rec = serveAPI(t, s, "/prtimes_posts?keyword=empty")
+	if rec.Header().Get("X-Cache") == "NEGATIVE" {
+		t.Error("the negative cache was not invalidated by a populated result")
+	}
+}
+
+// 空白の入れ方が違うだけのキーワードは、検索結果と同じく同じものとして覚える
+func TestNegativeCacheNormalizesKeyword(t *testing.T) {
+	f := newFakeUpstream(t)
+	cfg := f.config()
+	cfg.NegativeCacheTTL = time.Minute
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	serveAPI(t, s, "/prtimes_posts?keyword=no+results")
+	searchCalls := f.searchCalls.Load()
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=+no++results+")
+	if rec.Header().Get("X-Cache") != "NEGATIVE" {
+		t.Errorf("X-Cache = %q, want NEGATIVE", rec.Header().Get("X-Cache"))
+	}
+	if got := f.searchCalls.Load(); got != searchCalls {
+		t.Errorf("searched %d more times for another spelling of the keyword", got-searchCalls)
+	}
+	if negativeCacheKey(" no  results ") != negativeCacheKey("no results") || resultCacheKey(" no  results ") != resultCacheKey("no results") {
+		t.Error("cache keys differ by whitespace")
+	}
+}
+
+// NegativeCacheTTL が過ぎたら問い合わせ直す
+func TestNegativeCacheExpires(t *testing.T) {
+	f := newFakeUpstream(t)
+	cfg := f.config()
+	cfg.NegativeCacheTTL = 20 * time.Millisecond
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	serveAPI(t, s, "/prtimes_posts?keyword=empty")
+	time.Sleep(30 * time.Millisecond)
+	f.addRelease("empty", 1, "2024年12月01日 09時00分", 5)
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=empty").Items); got != 1 {
+		t.Errorf("got %d items after the negative cache expired, want 1", got)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ページを1つずつ取得し、newerThan より後に公開されたリリースだけを集める
+// PR TIMESの検索結果は新しい順なので、newerThan 以前のリリースが出てきたページで取得をやめる
+// 日時を処理できないリリースは newerThan と比べられないので含めない
+func (s *Server) crawlNewerThan(ctx context.Context, keyword string, opts crawlOptions) (*crawlResult, error) {
+	result := &crawlResult{}
+	filter := newPageFilter(keyword)
+	for page := 1; ; page++ {
+		prTimesData, err := s.fetchPRTimesData(ctx, keyword, page)
+		if err != nil {
+			// 最初のページが取れない場合だけエラーにする
+			if page == 1 {
+				return nil, err
+			}
+			result.pages = append(result.pages, newPageDebug(page, nil, err))
+			s.logFetchError(ctx, "Error fetching page", page, ":", err)
+			break
+		}
+		result.pages = append(result.pages, newPageDebug(page, prTimesData, nil))
+		result.pagesAvailable = max(prTimesData.Data.LastPage, 1)
+
+		releases, ok := filter.add(page, prTimesData.Data.ReleaseList)
+		if !ok {
+			// 重複したページ以降は無いものとする
+			result.pagesAvailable = page - 1
+			break
+		}
+		result.pagesScanned++
+		reachedOlder := false
+		var items []ResponseItem
+		for _, release := range releases {
+			publishedAt, ok := tryParseReleaseDate(release.ReleasedAt, s.cfg.DateLayouts)
+			if !ok {
+				log.Println("Unable to parse date, excluding from newerThan results:", release.ReleasedAt)
+				continue
+			}
+			if !publishedAt.After(opts.newerThan) {
+				reachedOlder = true
+				continue
+			}
+			items = append(items, s.newResponseItem(release, opts.loc))
+		}
+		// ソフトタイムアウトの後はいいね数を取得せずにリリースだけを集める
+		if !opts.skipLikes && !result.likesTruncated {
+			result.likesTruncated = !fetchLikeCountsWithin(ctx, opts, func(ctx context.Context) {
+				s.fetchLikeCounts(ctx, chunkItems(items, earlyStopGroupSize))
+			})
+		}
+		result.items = append(result.items, items...)
+		if maxItems := s.cfg.MaxCrawlItems; maxItems > 0 && len(result.items) >= maxItems {
+			if len(result.items) > maxItems || (!reachedOlder && page < prTimesData.Data.LastPage) {
+				log.Printf("Crawl for keyword %q exceeded %d items, truncating at page %d", keyword, maxItems, page)
+				result.items = result.items[:maxItems]
+				result.truncated = true
+			}
+			break
+		}
+
+		if reachedOlder {
+			// これより後のページは全て newerThan 以前なので、全て取得したことになる
+			result.pagesAvailable = result.pagesScanned
+			break
+		}
+		if page >= prTimesData.Data.LastPage || ctx.Err() != nil {
+			break
+		}
+	}
+
+	result.items = sortByDate(result.items)
+	result.fetchedAt = time.Now()
+	result.dedupe = filter.report
+	if !opts.debug {
+		clearLikeCountStatus(result.items)
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newerThan より後 (同じ時刻は含めない) のリリースだけを新しい順に返し、それ以前のリリースが出てきたページで取得をやめる
+func TestNewerThan(t *testing.T) {
+	base := time.Date(2024, 12, 10, 12, 0, 0, 0, jst)
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3*searchPageSize; n++ {
+		date := base.Add(-time.Duration(n) * time.Hour).Format("2006年01月02日 15時04分")
+		if n == 10 {
+			date = "不明"
+		}
+		f.addRelease("incremental", n, date, n)
+	}
+	s := NewServer(f.config())
+	captureLog(t)
+
+	newerThan := base.Add(-50 * time.Hour).Format(time.RFC3339)
+	resp := getResponse(t, s, "/prtimes_posts?keyword=incremental&newerThan="+url.QueryEscape(newerThan))
+	// 1〜49件目のうち日時を処理できない10件目を除く
+	if len(resp.Items) != 48 {
+		t.Fatalf("got %d items, want 48", len(resp.Items))
+	}
+	cutoff, _ := time.Parse(time.RFC3339, newerThan)
+	for i, item := range resp.Items {
+		if !item.PublishedAt.After(cutoff) {
+			t.Errorf("item %d (%s) is not after %s", i, item.PublishedAt, newerThan)
+		}
+		if i > 0 && item.PublishedAt.After(resp.Items[i-1].PublishedAt) {
+			t.Errorf("item %d is newer than item %d", i, i-1)
+		}
+		if item.Title == "リリース10" {
+			t.Error("the release with an unparseable date was included")
+		}
+	}
+	if got := f.searchCalls.Load(); got != 2 {
+		t.Errorf("search calls = %d, want 2", got)
+	}
+	if resp.Completeness != 1 {
+		t.Errorf("completeness = %v, want 1", resp.Completeness)
+	}
+}
+
+func TestNewerThanInvalid(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	for _, q := range []string{"newerThan=yesterday", "newerThan=2024-12-01T00:00:00Z&samplePages=2"} {
+		if rec := serveAPI(t, s, "/prtimes_posts?keyword=x&"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ConditionalRequests が有効な場合に、検索結果のページを If-Modified-Since 付きで取得し直すためにCacheに残しておく
+// PR TIMESで変わらないまま残っていても、ttl が過ぎたら取得し直す
+type pageCache struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+// Cacheに残す値
+type pageCacheEntry struct {
+	Data *PRTimesResponse `json:"data"`
+	// 次の If-Modified-Since に使う値 (PR TIMESの Last-Modified、無い場合は取得した時刻)
+	LastModified string `json:"lastModified"`
+}
+
+// キーワードごとに捨てられるように、キーワードの後にページを付ける
+// (キーワードに : が含まれていても他のキーワードと混ざらないようにエスケープする)
+func pageCacheKeyPrefix(keyword string) string {
+	return "page:" + url.QueryEscape(keyword) + ":"
+}
+
+func pageCacheKey(keyword string, page int) string {
+	return pageCacheKeyPrefix(keyword) + strconv.Itoa(page)
+}
+
+// Cacheから読めない場合は残していないものとする
+func (c *pageCache) get(ctx context.Context, keyword string, page int) (*PRTimesResponse, string, bool) {
+	value, ok, err := c.cache.Get(ctx, pageCacheKey(keyword, page))
+	if err != nil {
+		log.Printf("Error reading cached page %d for %q: %v", page, keyword, err)
+		return nil, "", false
+	}
+	if !ok {
+		return nil, "", false
+	}
+	var entry pageCacheEntry
+	if err := json.Unmarshal(value, &entry); err != nil || entry.Data == nil {
+		log.Printf("Ignoring broken cached page %d for %q: %v", page, keyword, err)
+		return nil, "", false
+	}
+	return entry.Data, entry.LastModified, true
+}
+
+func (c *pageCache) put(ctx context.Context, keyword string, page int, data *PRTimesResponse, lastModified string) {
+	value, err := json.Marshal(pageCacheEntry{Data: data, LastModified: lastModified})
+	if err == nil {
+		err = c.cache.Set(ctx, pageCacheKey(keyword, page), value, c.ttl)
+	}
+	if err != nil {
+		log.Printf("Error caching page %d for %q: %v", page, keyword, err)
+	}
+}
+
+// keyword が空の場合は全て捨てる
+// 捨てたページの数を返す
+func (c *pageCache) flush(ctx context.Context, keyword string) (int, error) {
+	prefix := "page:"
+	if keyword != "" {
+		prefix = pageCacheKeyPrefix(keyword)
+	}
+	return c.cache.DeletePrefix(ctx, prefix)
+}
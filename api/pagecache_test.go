@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fakeLastModified = "Sun, 01 Dec 2024 00:00:00 GMT"
+
+// Last-Modified を付けて返し、If-Modified-Since が一致する場合は 304 を返すPR TIMES
+// 受け取った If-Modified-Since は ifModifiedSince に入れる
+func newConditionalUpstream(t *testing.T, notModified *atomic.Int64, ifModifiedSince *atomic.Value) *fakeUpstream {
+	t.Helper()
+	f := newFakeUpstream(t)
+	f.addRelease("cond", 1, "2024年12月01日 09時00分", 5)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/keyword_search.php/search" {
+			return false
+		}
+		if v := r.Header.Get("If-Modified-Since"); v != "" {
+			ifModifiedSince.Store(v)
+		}
+		if r.Header.Get("If-Modified-Since") == fakeLastModified {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		w.Header().Set("Last-Modified", fakeLastModified)
+		f.serveSearch(w, r)
+		return true
+	}
+	return f
+}
+
+// 304 が返った場合は前回のページを使う (TolerantDecode の有無に関わらず)
+func TestConditionalRequestReusesCachedPage(t *testing.T) {
+	for _, tolerant := range []bool{true, false} {
+		var notModified atomic.Int64
+		var ifModifiedSince atomic.Value
+		f := newConditionalUpstream(t, &notModified, &ifModifiedSince)
+		cfg := f.config()
+		cfg.ConditionalRequests = true
+		cfg.TolerantDecode = tolerant
+		cfg.ResultCacheTTL = 0
+		s := NewServer(cfg)
+
+		if got := len(getResponse(t, s, "/prtimes_posts?keyword=cond").Items); got != 1 {
+			t.Fatalf("tolerant=%v: got %d items", tolerant, got)
+		}
+		// 304 を返すので、増えたリリースは返らない
+		f.addRelease("cond", 2, "2024年12月02日 09時00分", 3)
+		resp := getResponse(t, s, "/prtimes_posts?keyword=cond")
+		if len(resp.Items) != 1 || resp.Items[0].Title != "リリース1" {
+			t.Errorf("tolerant=%v: items = %+v, want the cached page", tolerant, resp.Items)
+		}
+		if notModified.Load() != 1 {
+			t.Errorf("tolerant=%v: got %d 304 responses, want 1", tolerant, notModified.Load())
+		}
+		if got, _ := ifModifiedSince.Load().(string); got != fakeLastModified {
+			t.Errorf("tolerant=%v: If-Modified-Since = %q, want %q", tolerant, got, fakeLastModified)
+		}
+	}
+}
+
+// PR TIMESが If-Modified-Since に対応していない場合は、毎回取得したページを使う
+func TestConditionalRequestIgnoredByUpstream(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("cond", 1, "2024年12月01日 09時00分", 5)
+	cfg := f.config()
+	cfg.ConditionalRequests = true
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=cond")
+	f.addRelease("cond", 2, "2024年12月02日 09時00分", 3)
+	if got := len(getResponse(t, s, "/prtimes_posts?keyword=cond").Items); got != 2 {
+		t.Errorf("got %d items, want 2", got)
+	}
+}
+
+// PageCacheTTL が0以下の場合はページを残さないので If-Modified-Since を付けない
+func TestConditionalRequestWithoutPageCacheTTL(t *testing.T) {
+	var notModified atomic.Int64
+	var ifModifiedSince atomic.Value
+	f := newConditionalUpstream(t, &notModified, &ifModifiedSince)
+	cfg := f.config()
+	cfg.ConditionalRequests = true
+	cfg.PageCacheTTL = 0
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=cond")
+	getResponse(t, s, "/prtimes_posts?keyword=cond")
+	if v := ifModifiedSince.Load(); v != nil {
+		t.Errorf("If-Modified-Since = %q, want none", v)
+	}
+}
+
+// ttl が過ぎたページは残していないものとする
+func TestPageCacheExpires(t *testing.T) {
+	ctx := context.Background()
+	c := &pageCache{cache: NewMemoryCache(10), ttl: 20 * time.Millisecond}
+	c.put(ctx, "cond", 1, &PRTimesResponse{}, fakeLastModified)
+	if _, lastModified, ok := c.get(ctx, "cond", 1); !ok || lastModified != fakeLastModified {
+		t.Fatalf("get = %q, %v right after put", lastModified, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := c.get(ctx, "cond", 1); ok {
+		t.Error("an expired page was returned")
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 各エンドポイントで使うクエリパラメータ
+// strictParams=true の場合はここに無いものを含むリクエストを 400 にするので、パラメータを増やした場合はここにも足す
+var (
+	postsParams = knownParams(
+		"keyword", "limit", "offset", "mode", "format", "envelope", "stream", "debug", "tz", "bigIntAsString",
+		"sort", "thumbnailBoost", "tiers", "topPerTier", "aboveMedian", "minPercentile", "archiveOlderThanDays",
+		"thumbnailHost", "tag", "companyIds", "minResults", "fallbackKeyword", "expandScript",
+		"order", "nocache", "samplePages", "seed", "newerThan", "earlyStopLikes", "concurrency",
+		"groupBy", "series", "weekdayBreakdown", "summary", "snapshotId", "compareSnapshot",
+		"enrichThumbnails", "engagementRate", "sparkline", "normalizeCompany", "includeHost", "includeFreshness",
+		"includeTitleLength", "includeLikes", "minTitleLength", "maxTitleLength", "from", "to",
+	)
+	diffParams    = knownParams("keyword", "excludeKeyword", "limit", "debug", "bigIntAsString")
+	releaseParams = knownParams("url", "debug")
+)
+
+// strictParams 自体はどのエンドポイントでも使える
+func knownParams(names ...string) map[string]bool {
+	known := map[string]bool{"strictParams": true}
+	for _, name := range names {
+		known[name] = true
+	}
+	return known
+}
+
+// strictParams=true (StrictParams が有効な場合は strictParams=false 以外) の場合に、
+// known に無いクエリパラメータ (limt=10 などの打ち間違い) を含むリクエストを 400 にする
+func (s *Server) rejectUnknownParams(known map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		strict := s.cfg.StrictParams
+		switch query.Get("strictParams") {
+		case "true":
+			strict = true
+		case "false":
+			strict = false
+		}
+		if strict {
+			var unknown []string
+			for name := range query {
+				if !known[name] {
+					unknown = append(unknown, name)
+				}
+			}
+			if len(unknown) > 0 {
+				slices.Sort(unknown)
+				http.Error(w, "Unknown query parameters: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
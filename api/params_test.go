@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// strictParams=true の場合は知らないクエリパラメータを 400 にして名前を返し、それ以外は無視する
+func TestStrictParams(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("strict", 1, "2024年12月01日 09時00分", 5)
+	s := NewServer(f.config())
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=strict&limt=10&sortt=date&strictParams=true")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "Unknown query parameters: limt, sortt" {
+		t.Errorf("body = %q", body)
+	}
+
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=strict&limt=10"); rec.Code != http.StatusOK {
+		t.Errorf("without strictParams: status %d", rec.Code)
+	}
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=strict&limit=10&strictParams=true"); rec.Code != http.StatusOK {
+		t.Errorf("known params with strictParams: status %d", rec.Code)
+	}
+	// エンドポイントごとに使えるパラメータが違う
+	if rec := serveAPI(t, s, "/release?url=x&keyword=strict&strictParams=true"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "keyword") {
+		t.Errorf("/release with keyword: status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+// StrictParams を有効にした場合は strictParams=false を指定しない限り 400 にする
+func TestStrictParamsConfig(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("strict", 1, "2024年12月01日 09時00分", 5)
+	cfg := f.config()
+	cfg.StrictParams = true
+	s := NewServer(cfg)
+
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=strict&limt=10"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=strict&limt=10&strictParams=false"); rec.Code != http.StatusOK {
+		t.Errorf("strictParams=false: status %d", rec.Code)
+	}
+
+	t.Setenv("PRTIMES_STRICT_PARAMS", "true")
+	if !ConfigFromEnv().StrictParams {
+		t.Error("PRTIMES_STRICT_PARAMS=true was not read")
+	}
+}
+
+// handler.go で読むクエリパラメータは全て postsParams にある
+func TestPostsParamsCoverHandler(t *testing.T) {
+	src, err := os.ReadFile("handler.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range regexp.MustCompile(`Query\(\)\.Get\("([^"]+)"\)`).FindAllStringSubmatch(string(src), -1) {
+		if !postsParams[m[1]] {
+			t.Errorf("%q is read by handler.go but missing from postsParams", m[1])
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PostProcessor は取得した結果をレスポンスにする前に加工する
+// 絞り込みや並び替え、項目の追加などに使う
+type PostProcessor func([]ResponseItem) []ResponseItem
+
+// RegisterPostProcessor は全てのリクエストに適用するPostProcessorを追加する
+// リクエストを受け付ける前に呼ぶこと
+func (s *Server) RegisterPostProcessor(p PostProcessor) {
+	s.postProcessors = append(s.postProcessors, p)
+}
+
+// 先頭から順に適用する
+func runPipeline(items []ResponseItem, pipeline []PostProcessor) []ResponseItem {
+	for _, p := range pipeline {
+		items = p(items)
+	}
+	return items
+}
+
+// サムネイルURLのホストで絞り込む
+func thumbnailHostFilter(host string) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		return filterByThumbnailHost(items, host)
+	}
+}
+
+// 指定したタグ (リリースの種類) が付いているものだけを残す
+// タグが無いものは除く
+func tagFilter(tag string) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		var filtered []ResponseItem
+		for _, item := range items {
+			if slices.Contains(item.Tags, tag) {
+				filtered = append(filtered, item)
+			}
+		}
+		return filtered
+	}
+}
+
+// リリースIDから取れる企業IDが ids に含まれるものだけを残す
+// 企業IDが取れないものは除く
+func companyIDFilter(ids map[uint64]bool) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		var filtered []ResponseItem
+		for _, item := range items {
+			id, err := strconv.ParseUint(companyID(item.ReleaseID), 10, 64)
+			if err == nil && ids[id] {
+				filtered = append(filtered, item)
+			}
+		}
+		return filtered
+	}
+}
+
+// タイトルの文字数 (rune数) が minLength 以上 maxLength 以下のものだけを残す (0の場合はその側を制限しない)
+func titleLengthFilter(minLength, maxLength int) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		var filtered []ResponseItem
+		for _, item := range items {
+			n := utf8.RuneCountInString(item.Title)
+			if n >= minLength && (maxLength == 0 || n <= maxLength) {
+				filtered = append(filtered, item)
+			}
+		}
+		return filtered
+	}
+}
+
+// 公開日時が from 以降 to より前のものだけを残す (ゼロ値の場合はその側を制限しない)
+// 公開日時が分からないものは除く
+func dateRangeFilter(from, to time.Time) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		var filtered []ResponseItem
+		for _, item := range items {
+			t := item.PublishedAt
+			if t.IsZero() || (!from.IsZero() && t.Before(from)) || (!to.IsZero() && !t.Before(to)) {
+				continue
+			}
+			filtered = append(filtered, item)
+		}
+		return filtered
+	}
+}
+
+// companyIds クエリパラメータ (カンマ区切りの数字) を読む
+// 先頭の0は無視する (000012345 と 12345 は同じ)
+func parseCompanyIDs(v string) (map[uint64]bool, bool) {
+	ids := make(map[uint64]bool)
+	for _, part := range strings.Split(v, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		ids[id] = true
+	}
+	return ids, true
+}
+
+// いいね数が中央値以上のものだけを残す
+func filterAboveMedian(items []ResponseItem) []ResponseItem {
+	if len(items) == 0 {
+		return items
+	}
+	median := medianLikes(items)
+	var filtered []ResponseItem
+	for _, item := range items {
+		if float64(item.LikeCount) >= median {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// いいね数がp分位以上のものだけを残す
+func filterMinPercentile(p float64) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		if len(items) == 0 {
+			return items
+		}
+		cutoff := percentileLikes(items, p)
+		var filtered []ResponseItem
+		for _, item := range items {
+			if float64(item.LikeCount) >= cutoff {
+				filtered = append(filtered, item)
+			}
+		}
+		return filtered
+	}
+}
+
+// LikeCountで降順ソート
+func sortByLikes(items []ResponseItem) []ResponseItem {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].LikeCount > items[j].LikeCount
+	})
+	return items
+}
+
+// 並び順
+const (
+	sortLikes = "likes"
+	sortDate  = "date"
+)
+
+func isValidSort(v string) bool {
+	return v == sortLikes || v == sortDate
+}
+
+// 項目名での指定 (likeCount, publishedDate) を likes, date にする。それ以外はそのまま返す
+func canonicalSort(v string) string {
+	switch v {
+	case "likeCount":
+		return sortLikes
+	case "publishedDate":
+		return sortDate
+	}
+	return v
+}
+
+// 公開日時の新しい順
+func sortByDate(items []ResponseItem) []ResponseItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedAt.After(items[j].PublishedAt)
+	})
+	return items
+}
+
+// 1件以上あり、全てのいいね数が0か
+func allZeroLikes(items []ResponseItem) bool {
+	for _, item := range items {
+		if item.LikeCount != 0 {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+// 並べる向き
+const (
+	orderDesc = "desc"
+	orderAsc  = "asc"
+)
+
+// LikeCountで昇順ソート
+func sortByLikesAscending(items []ResponseItem) []ResponseItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].LikeCount < items[j].LikeCount
+	})
+	return items
+}
+
+// 公開日時の古い順 (公開日時が分からないものは最後にする)
+func sortByDateAscending(items []ResponseItem) []ResponseItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].PublishedAt.IsZero() || items[j].PublishedAt.IsZero() {
+			return !items[i].PublishedAt.IsZero() && items[j].PublishedAt.IsZero()
+		}
+		return items[i].PublishedAt.Before(items[j].PublishedAt)
+	})
+	return items
+}
+
+// サムネイルのあるものを優先していいね数の降順に並べる
+// サムネイルのあるものはいいね数に band を足して比べ、同じ場合はサムネイルのある方を上にする
+// (band が0の場合はいいね数が同じ場合だけサムネイルのある方を上にする)
+func sortByLikesThumbnailBoost(band int) PostProcessor {
+	score := func(item ResponseItem) int {
+		if item.ThumbnailURL == "" {
+			return item.LikeCount
+		}
+		return item.LikeCount + band
+	}
+	return func(items []ResponseItem) []ResponseItem {
+		sort.SliceStable(items, func(i, j int) bool {
+			si, sj := score(items[i]), score(items[j])
+			if si != sj {
+				return si > sj
+			}
+			hasI, hasJ := items[i].ThumbnailURL != "", items[j].ThumbnailURL != ""
+			if hasI != hasJ {
+				return hasI
+			}
+			return items[i].LikeCount > items[j].LikeCount
+		})
+		return items
+	}
+}
+
+// いいね数の段階
+const (
+	tierViral  = "viral"
+	tierHigh   = "high"
+	tierMedium = "medium"
+	tierLow    = "low"
+)
+
+// いいね数がしきい値以上かで段階を付ける
+func assignTiers(t TierThresholds) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		for i := range items {
+			items[i].Tier = t.tier(items[i].LikeCount)
+		}
+		return items
+	}
+}
+
+// 段階ごとに先頭から n 件までを残す (並び順は変えない)
+func capPerTier(n int) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		counts := make(map[string]int)
+		var capped []ResponseItem
+		for _, item := range items {
+			if counts[item.Tier] < n {
+				counts[item.Tier]++
+				capped = append(capped, item)
+			}
+		}
+		return capped
+	}
+}
+
+func (t TierThresholds) tier(likeCount int) string {
+	switch {
+	case likeCount >= t.Viral:
+		return tierViral
+	case likeCount >= t.High:
+		return tierHigh
+	case likeCount >= t.Medium:
+		return tierMedium
+	default:
+		return tierLow
+	}
+}
+
+// 先頭から offset 件を飛ばす
+func offsetItems(offset int) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		if offset >= len(items) {
+			return nil
+		}
+		return items[offset:]
+	}
+}
+
+// Limitに応じてデータをカット
+func limitItems(limit int) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		if len(items) > limit {
+			return items[:limit]
+		}
+		return items
+	}
+}
@@ -0,0 +1,572 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func appendTitleSuffix(suffix string) PostProcessor {
+	return func(items []ResponseItem) []ResponseItem {
+		for i := range items {
+			items[i].Title += suffix
+		}
+		return items
+	}
+}
+
+// 登録した順に適用する
+func TestRunPipelineOrder(t *testing.T) {
+	items := []ResponseItem{{Title: "x", LikeCount: 1}, {Title: "y", LikeCount: 3}, {Title: "z", LikeCount: 2}}
+	dropFirst := func(items []ResponseItem) []ResponseItem { return items[1:] }
+	got := runPipeline(items, []PostProcessor{appendTitleSuffix("1"), sortByLikes, dropFirst, appendTitleSuffix("2")})
+
+	var titles []string
+	for _, item := range got {
+		titles = append(titles, item.Title)
+	}
+	if want := []string{"z12", "x12"}; !slices.Equal(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+// RegisterPostProcessor で登録したものは絞り込みの後、並び替えと limit の前に順に適用する
+func TestRegisterPostProcessor(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 5; n++ {
+		f.addRelease("hooks", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+	var seen []int
+	s.RegisterPostProcessor(func(items []ResponseItem) []ResponseItem {
+		seen = append(seen, len(items))
+		// いいね数が奇数のものだけを残す
+		var odd []ResponseItem
+		for _, item := range items {
+			if item.LikeCount%2 == 1 {
+				odd = append(odd, item)
+			}
+		}
+		return odd
+	})
+	s.RegisterPostProcessor(func(items []ResponseItem) []ResponseItem {
+		seen = append(seen, len(items))
+		return appendTitleSuffix("!")(items)
+	})
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=hooks&limit=2")
+	if !slices.Equal(seen, []int{5, 3}) {
+		t.Errorf("post processors saw %v items, want [5 3]", seen)
+	}
+	if len(resp.Items) != 2 || resp.Items[0].LikeCount != 5 || resp.Items[1].LikeCount != 3 {
+		t.Fatalf("items = %+v", resp.Items)
+	}
+	for _, item := range resp.Items {
+		if !strings.HasSuffix(item.Title, "!") {
+			t.Errorf("second post processor was not applied to %q", item.Title)
+		}
+	}
+	if resp.TotalLikes != 9 {
+		t.Errorf("totalLikes = %d, want 9", resp.TotalLikes)
+	}
+}
+
+// Config.PostProcessors は RegisterPostProcessor と同じく全てのリクエストに適用する
+func TestConfigPostProcessors(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("hooks", 1, "2024年12月01日 09時00分", 1)
+	cfg := f.config()
+	cfg.PostProcessors = []PostProcessor{appendTitleSuffix("?")}
+	s := NewServer(cfg)
+	if got := getResponse(t, s, "/prtimes_posts?keyword=hooks").Items[0].Title; got != "リリース1?" {
+		t.Errorf("title = %q", got)
+	}
+}
+
+func likeCounts(items []ResponseItem) []int {
+	var counts []int
+	for _, item := range items {
+		counts = append(counts, item.LikeCount)
+	}
+	return counts
+}
+
+func itemsWithLikes(counts ...int) []ResponseItem {
+	items := make([]ResponseItem, len(counts))
+	for i, n := range counts {
+		items[i].LikeCount = n
+	}
+	return items
+}
+
+func TestFilterAboveMedian(t *testing.T) {
+	for _, tt := range []struct {
+		likes  []int
+		median float64
+		want   []int
+	}{
+		// 奇数件は中央の値
+		{[]int{5, 1, 9, 3, 7}, 5, []int{5, 9, 7}},
+		// 偶数件は中央の2つの平均
+		{[]int{4, 1, 10, 2}, 3, []int{4, 10}},
+		{[]int{2, 2, 2, 2}, 2, []int{2, 2, 2, 2}},
+		{[]int{0}, 0, []int{0}},
+	} {
+		items := itemsWithLikes(tt.likes...)
+		if got := medianLikes(items); got != tt.median {
+			t.Errorf("medianLikes(%v) = %v, want %v", tt.likes, got, tt.median)
+		}
+		if got := likeCounts(filterAboveMedian(items)); !slices.Equal(got, tt.want) {
+			t.Errorf("filterAboveMedian(%v) = %v, want %v", tt.likes, got, tt.want)
+		}
+	}
+	if got := filterAboveMedian(nil); len(got) != 0 {
+		t.Errorf("filterAboveMedian(nil) = %v", got)
+	}
+}
+
+// 中央値は他の絞り込みの後、limit の前の全件から計算する
+func TestAboveMedianParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 6; n++ {
+		f.addRelease("median", n, "2024年12月01日 09時00分", n*10)
+	}
+	f.setThumbnail("median", 6, "https://other.example.com/a.jpg")
+	for n := 1; n <= 5; n++ {
+		f.setThumbnail("median", n, "https://prtimes.jp/a.jpg")
+	}
+	s := NewServer(f.config())
+
+	// 10〜50 の中央値は 30
+	resp := getResponse(t, s, "/prtimes_posts?keyword=median&aboveMedian=true&thumbnailHost=prtimes.jp&limit=2")
+	if got := likeCounts(resp.Items); !slices.Equal(got, []int{50, 40}) {
+		t.Errorf("likes = %v, want [50 40]", got)
+	}
+	if resp.TotalLikes != 120 {
+		t.Errorf("totalLikes = %d, want 120", resp.TotalLikes)
+	}
+}
+
+func TestTierThresholds(t *testing.T) {
+	thresholds := TierThresholds{Viral: 100, High: 20, Medium: 5}
+	for likes, want := range map[int]string{
+		0: tierLow, 4: tierLow, 5: tierMedium, 19: tierMedium, 20: tierHigh, 99: tierHigh, 100: tierViral, 5000: tierViral,
+	} {
+		if got := thresholds.tier(likes); got != want {
+			t.Errorf("tier(%d) = %s, want %s", likes, got, want)
+		}
+	}
+}
+
+func TestParseTierThresholds(t *testing.T) {
+	got, err := parseTierThresholds("500, 50, 5")
+	if err != nil || got != (TierThresholds{Viral: 500, High: 50, Medium: 5}) {
+		t.Errorf("parseTierThresholds = %+v, %v", got, err)
+	}
+	for _, v := range []string{"1,2,3", "100,10", "a,b,c"} {
+		if _, err := parseTierThresholds(v); err == nil {
+			t.Errorf("parseTierThresholds(%q) should fail", v)
+		}
+	}
+}
+
+// tiers=true の場合は設定したしきい値で tier を付ける
+func TestTiersParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n, likes := range []int{0, 5, 20, 100} {
+		f.addRelease("tiers", n+1, "2024年12月01日 09時00分", likes)
+	}
+	cfg := f.config()
+	cfg.Tiers = TierThresholds{Viral: 100, High: 20, Medium: 5}
+	s := NewServer(cfg)
+
+	want := map[int]string{0: tierLow, 5: tierMedium, 20: tierHigh, 100: tierViral}
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=tiers&tiers=true").Items {
+		if item.Tier != want[item.LikeCount] {
+			t.Errorf("%d likes: tier = %q, want %q", item.LikeCount, item.Tier, want[item.LikeCount])
+		}
+	}
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=tiers").Items {
+		if item.Tier != "" {
+			t.Errorf("tier without tiers=true: %q", item.Tier)
+		}
+	}
+}
+
+// topPerTier=N の場合は、いいね数順に並べた後で段階ごとに上位 N 件までを返す
+func TestTopPerTier(t *testing.T) {
+	f := newFakeUpstream(t)
+	// viral 4件, high 3件, medium 1件, low 5件
+	likes := []int{500, 400, 300, 200, 50, 40, 30, 7, 4, 3, 2, 1, 0}
+	for n, count := range likes {
+		f.addRelease("tiers", n+1, "2024年12月01日 09時00分", count)
+	}
+	cfg := f.config()
+	cfg.Tiers = TierThresholds{Viral: 100, High: 20, Medium: 5}
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=tiers&tiers=true&topPerTier=2")
+	var got []int
+	counts := make(map[string]int)
+	for _, item := range resp.Items {
+		got = append(got, item.LikeCount)
+		counts[item.Tier]++
+	}
+	if want := []int{500, 400, 50, 40, 7, 4, 3}; !slices.Equal(got, want) {
+		t.Errorf("likes = %v, want %v", got, want)
+	}
+	if want := map[string]int{tierViral: 2, tierHigh: 2, tierMedium: 1, tierLow: 2}; !maps.Equal(counts, want) {
+		t.Errorf("items per tier = %v, want %v", counts, want)
+	}
+
+	for _, target := range []string{
+		"/prtimes_posts?keyword=tiers&topPerTier=2",
+		"/prtimes_posts?keyword=tiers&tiers=true&topPerTier=0",
+		"/prtimes_posts?keyword=tiers&tiers=true&topPerTier=x",
+		"/prtimes_posts?keyword=tiers&tiers=true&topPerTier=2&mode=ids",
+	} {
+		if rec := serveAPI(t, s, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// いいね数の差が band 以内なら、サムネイルのあるものを上にする
+func TestSortByLikesThumbnailBoost(t *testing.T) {
+	items := []ResponseItem{
+		{Title: "a", LikeCount: 10},
+		{Title: "b", LikeCount: 8, ThumbnailURL: "https://example.com/b.png"},
+		{Title: "c", LikeCount: 5, ThumbnailURL: "https://example.com/c.png"},
+		{Title: "d", LikeCount: 20},
+	}
+	var titles []string
+	for _, item := range sortByLikesThumbnailBoost(3)(items) {
+		titles = append(titles, item.Title)
+	}
+	if got := strings.Join(titles, ","); got != "d,b,a,c" {
+		t.Errorf("order = %s, want d,b,a,c", got)
+	}
+}
+
+// band が0の場合は、いいね数が同じ時だけサムネイルのあるものを上にする
+func TestThumbnailBoostParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("boost", 1, "2024年12月01日 09時00分", 10)
+	f.addRelease("boost", 2, "2024年12月02日 09時00分", 10)
+	f.addRelease("boost", 3, "2024年12月03日 09時00分", 9)
+	f.setThumbnail("boost", 2, "https://prtimes.jp/i/2.png")
+	f.setThumbnail("boost", 3, "https://prtimes.jp/i/3.png")
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=boost&thumbnailBoost=true")
+	var titles []string
+	for _, item := range resp.Items {
+		titles = append(titles, item.Title)
+	}
+	if got := strings.Join(titles, ","); got != "リリース2,リリース1,リリース3" {
+		t.Errorf("order = %s, want リリース2,リリース1,リリース3", got)
+	}
+}
+
+// 隣り合う値の間は線形補間する (p=0.5 は中央値と同じ)
+func TestPercentileLikes(t *testing.T) {
+	items := itemsWithLikes(100, 10, 90, 20, 80, 30, 70, 40, 60, 50)
+	for _, tt := range []struct {
+		p    float64
+		want float64
+	}{
+		{0, 10},
+		{0.5, 55},
+		{0.9, 91},
+		{1, 100},
+	} {
+		if got := percentileLikes(items, tt.p); got != tt.want {
+			t.Errorf("percentileLikes(p=%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentileLikes(itemsWithLikes(7), 0.9); got != 7 {
+		t.Errorf("single item: percentileLikes = %v, want 7", got)
+	}
+}
+
+func TestFilterMinPercentile(t *testing.T) {
+	for _, tt := range []struct {
+		p     float64
+		likes []int
+		want  []int
+	}{
+		{0.9, []int{100, 10, 90, 20, 80, 30, 70, 40, 60, 50}, []int{100}},
+		{0.5, []int{100, 10, 90, 20, 80, 30, 70, 40, 60, 50}, []int{100, 90, 80, 70, 60}},
+		{0, []int{3, 1, 2}, []int{3, 1, 2}},
+		// 少ない場合もしきい値ちょうどの項目は残す
+		{0.9, []int{5}, []int{5}},
+		{0.5, []int{4, 4}, []int{4, 4}},
+		{0.9, nil, nil},
+	} {
+		if got := likeCounts(filterMinPercentile(tt.p)(itemsWithLikes(tt.likes...))); !slices.Equal(got, tt.want) {
+			t.Errorf("p=%v %v: got %v, want %v", tt.p, tt.likes, got, tt.want)
+		}
+	}
+}
+
+func TestMinPercentileParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 5; n++ {
+		f.addRelease("pct", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	// 1〜5 の80パーセンタイルは4.2
+	resp := getResponse(t, s, "/prtimes_posts?keyword=pct&minPercentile=0.8")
+	if got := likeCounts(resp.Items); !slices.Equal(got, []int{5}) {
+		t.Errorf("likes = %v, want [5]", got)
+	}
+	for _, v := range []string{"-0.1", "1.5", "high"} {
+		if rec := serveAPI(t, s, "/prtimes_posts?keyword=pct&minPercentile="+v); rec.Code != http.StatusBadRequest {
+			t.Errorf("minPercentile=%s: status %d, want 400", v, rec.Code)
+		}
+	}
+}
+
+// PR TIMESのリリースの種類を tags に入れ、返ってこない場合は含めない
+func TestTagsMapping(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("tags", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("tags", 2, "2024年12月02日 09時00分", 2)
+	f.addRelease("tags", 3, "2024年12月03日 09時00分", 1)
+	f.setTags("tags", 1, []string{"商品サービス", "イベント"})
+	f.setTags("tags", 3, nil)
+	s := NewServer(f.config())
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=tags")
+	var raw struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.Items) != 3 {
+		t.Fatalf("got %d items, want 3", len(raw.Items))
+	}
+	if got := fmt.Sprint(raw.Items[0]["tags"]); got != "[商品サービス イベント]" {
+		t.Errorf("tags = %s, want [商品サービス イベント]", got)
+	}
+	for _, item := range raw.Items[1:] {
+		if tags, ok := item["tags"]; ok {
+			t.Errorf("%s: tags = %v, want omitted", item["title"], tags)
+		}
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("tags", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("tags", 2, "2024年12月02日 09時00分", 2)
+	f.addRelease("tags", 3, "2024年12月03日 09時00分", 1)
+	f.setTags("tags", 1, []string{"商品サービス", "イベント"})
+	f.setTags("tags", 2, []string{"調査レポート"})
+	f.setTags("tags", 3, nil)
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		tag  string
+		want string
+	}{
+		{"イベント", "リリース1"},
+		{"調査レポート", "リリース2"},
+		{"人事", ""},
+	} {
+		resp := getResponse(t, s, "/prtimes_posts?keyword=tags&tag="+url.QueryEscape(tt.tag))
+		var titles []string
+		for _, item := range resp.Items {
+			titles = append(titles, item.Title)
+		}
+		if got := strings.Join(titles, ","); got != tt.want {
+			t.Errorf("tag=%s: items = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+// companyIds を指定した場合は、リリースIDの企業IDが含まれるものだけを返す (企業IDが取れないものは除く)
+func TestCompanyIDsFilter(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 4; n++ {
+		f.addRelease("company", n, fmt.Sprintf("2024年12月%02d日 09時00分", n), 5-n)
+	}
+	// PR TIMESのリリースURLではないのでリリースIDが取れない
+	f.mu.Lock()
+	f.releases["company"][2].ReleaseURL = "https://example.com/news/3"
+	f.mu.Unlock()
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		companyIDs string
+		want       string
+	}{
+		{"1,3", "リリース1"},
+		{"000000002, 4", "リリース2,リリース4"},
+		{"99", ""},
+	} {
+		resp := getResponse(t, s, "/prtimes_posts?keyword=company&companyIds="+url.QueryEscape(tt.companyIDs))
+		var titles []string
+		for _, item := range resp.Items {
+			titles = append(titles, item.Title)
+		}
+		if got := strings.Join(titles, ","); got != tt.want {
+			t.Errorf("companyIds=%s: items = %q, want %q", tt.companyIDs, got, tt.want)
+		}
+	}
+
+	for _, v := range []string{"abc", "1,,2", "-1", "1.5"} {
+		if rec := serveAPI(t, s, "/prtimes_posts?keyword=company&companyIds="+url.QueryEscape(v)); rec.Code != http.StatusBadRequest {
+			t.Errorf("companyIds=%s: status %d, want %d", v, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// includeTitleLength=true の場合は、マルチバイトの文字も1文字として数えたタイトルの文字数を返す
+// minTitleLength と maxTitleLength はその文字数で絞り込む (両端を含む)
+func TestTitleLength(t *testing.T) {
+	f := newFakeUpstream(t)
+	titles := []string{"新商品発表", "AI活用のお知らせ🎉", "News"}
+	for n := range titles {
+		f.addRelease("title", n+1, "2024年12月01日 09時00分", 10-n)
+	}
+	f.mu.Lock()
+	for i, title := range titles {
+		f.releases["title"][i].Title = title
+	}
+	f.mu.Unlock()
+	s := NewServer(f.config())
+
+	want := map[string]int{"新商品発表": 5, "AI活用のお知らせ🎉": 10, "News": 4}
+	for _, item := range getResponse(t, s, "/prtimes_posts?keyword=title&includeTitleLength=true").Items {
+		if item.TitleLength != want[item.Title] {
+			t.Errorf("%s: titleLength = %d, want %d", item.Title, item.TitleLength, want[item.Title])
+		}
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"&minTitleLength=5", "新商品発表,AI活用のお知らせ🎉"},
+		{"&maxTitleLength=5", "新商品発表,News"},
+		{"&minTitleLength=5&maxTitleLength=5", "新商品発表"},
+		{"&minTitleLength=11", ""},
+	} {
+		resp := getResponse(t, s, "/prtimes_posts?keyword=title"+tt.query)
+		var got []string
+		for _, item := range resp.Items {
+			got = append(got, item.Title)
+			if item.TitleLength != 0 {
+				t.Errorf("%s: titleLength without includeTitleLength", tt.query)
+			}
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%s: titles = %q, want %q", tt.query, strings.Join(got, ","), tt.want)
+		}
+	}
+
+	for _, query := range []string{"&minTitleLength=0", "&maxTitleLength=x", "&minTitleLength=5&maxTitleLength=4"} {
+		if rec := serveAPI(t, s, "/prtimes_posts?keyword=title"+query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// sort と order で並べる (日付は文字列ではなく公開日時で比べる)
+func TestSortAndOrder(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("sort", 1, "2024年12月01日 09時00分", 30)
+	f.addRelease("sort", 2, "2時間前", 10)
+	f.addRelease("sort", 3, "2024年12月02日 09時00分", 20)
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"", "リリース1,リリース3,リリース2"},
+		{"&order=asc", "リリース2,リリース3,リリース1"},
+		{"&sort=date", "リリース2,リリース3,リリース1"},
+		{"&sort=date&order=asc", "リリース1,リリース3,リリース2"},
+		{"&sort=publishedDate", "リリース2,リリース3,リリース1"},
+		{"&sort=likeCount&order=desc", "リリース1,リリース3,リリース2"},
+	} {
+		var titles []string
+		for _, item := range getResponse(t, s, "/prtimes_posts?keyword=sort"+tt.query).Items {
+			titles = append(titles, item.Title)
+		}
+		if got := strings.Join(titles, ","); got != tt.want {
+			t.Errorf("%q: items = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ query, message string }{
+		{"&sort=title", "sort query parameter must be likes (likeCount) or date (publishedDate)"},
+		{"&order=up", "order query parameter must be asc or desc"},
+	} {
+		rec := serveAPI(t, s, "/prtimes_posts?keyword=sort"+tt.query)
+		if rec.Code != http.StatusBadRequest || strings.TrimSpace(rec.Body.String()) != tt.message {
+			t.Errorf("%q: status %d, body %q", tt.query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// いいね数が全て0の場合は、sort を指定していなければ日付順にして warnings で知らせる
+func TestAllZeroLikesFallsBackToDate(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("zero", 1, "2024年12月01日 09時00分", 0)
+	f.addRelease("zero", 2, "2024年12月03日 09時00分", 0)
+	f.addRelease("zero", 3, "2024年12月02日 09時00分", 0)
+	s := NewServer(f.config())
+
+	titles := func(resp Response) string {
+		var got []string
+		for _, item := range resp.Items {
+			got = append(got, item.Title)
+		}
+		return strings.Join(got, ",")
+	}
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=zero")
+	if got := titles(resp); got != "リリース2,リリース3,リリース1" {
+		t.Errorf("items = %s, want sorted by date", got)
+	}
+	if !slices.Contains(resp.Warnings, "all like counts are 0, results are sorted by date") {
+		t.Errorf("warnings = %v", resp.Warnings)
+	}
+
+	// sort=likes を指定した場合は日付順にしない
+	resp = getResponse(t, s, "/prtimes_posts?keyword=zero&sort=likes")
+	if len(resp.Items) != 3 || len(resp.Warnings) != 0 {
+		t.Errorf("sort=likes: %d items, warnings = %v", len(resp.Items), resp.Warnings)
+	}
+
+	// 1件でもいいねがあれば日付順にしない
+	f.mu.Lock()
+	f.likes[fakeReleaseID(1)] = 1
+	f.mu.Unlock()
+	resp = getResponse(t, s, "/prtimes_posts?keyword=zero&nocache=1")
+	if got := titles(resp); !strings.HasPrefix(got, "リリース1,") || len(resp.Warnings) != 0 {
+		t.Errorf("with likes: items = %s, warnings = %v", got, resp.Warnings)
+	}
+}
+
+func TestAllZeroLikes(t *testing.T) {
+	if allZeroLikes(nil) {
+		t.Error("no items should not count as all zero")
+	}
+	if !allZeroLikes([]ResponseItem{{}, {}}) {
+		t.Error("all zero likes were not detected")
+	}
+	if allZeroLikes([]ResponseItem{{}, {LikeCount: 1}}) {
+		t.Error("items with likes were detected as all zero")
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// PR TIMESの応答が遅い場合、serverProcessingMs にその分の時間が含まれる
+func TestServerProcessingMs(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	f := newFakeUpstream(t)
+	f.addRelease("AI", 1, "2024年12月01日 10時00分", 5)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(delay)
+		return false
+	}
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=AI")
+	if resp.ServerProcessingMs < delay.Milliseconds() {
+		t.Errorf("serverProcessingMs = %d, want at least %d", resp.ServerProcessingMs, delay.Milliseconds())
+	}
+
+	// キャッシュから返す場合も含める
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(serveAPI(t, s, "/prtimes_posts?keyword=AI").Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["serverProcessingMs"]; !ok {
+		t.Errorf("serverProcessingMs is missing: %v", raw)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+// protobufのwire type
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// response_item.proto の ResponseItem としてエンコードする
+func (item ResponseItem) MarshalProtobuf() []byte {
+	var b []byte
+	b = appendProtoString(b, 1, item.CorporationName)
+	b = appendProtoString(b, 2, item.PublishedDate)
+	if !item.PublishedAt.IsZero() {
+		b = appendProtoString(b, 3, item.PublishedAt.Format(time.RFC3339))
+	}
+	b = appendProtoString(b, 4, item.ThumbnailURL)
+	b = appendProtoString(b, 5, item.PostURL)
+	b = appendProtoString(b, 6, item.Title)
+	b = appendProtoVarint(b, 7, uint64(item.LikeCount))
+	b = appendProtoString(b, 8, item.LikeCountStatus)
+	b = appendProtoVarint(b, 9, uint64(item.ThumbnailWidth))
+	b = appendProtoVarint(b, 10, uint64(item.ThumbnailHeight))
+	b = appendProtoString(b, 11, item.Tier)
+	// optional なので0でも書き出す
+	if item.EngagementRate != nil {
+		b = appendProtoDouble(b, 12, *item.EngagementRate)
+	}
+	for _, sample := range item.Sparkline {
+		var msg []byte
+		msg = appendProtoString(msg, 1, sample.At.Format(time.RFC3339))
+		msg = appendProtoVarint(msg, 2, uint64(sample.LikeCount))
+		b = appendProtoMessage(b, 13, msg)
+	}
+	for _, tag := range item.Tags {
+		b = appendProtoString(b, 14, tag)
+	}
+	b = appendProtoString(b, 15, item.Host)
+	if item.Freshness != nil {
+		b = appendProtoDouble(b, 16, *item.Freshness)
+	}
+	b = appendProtoVarint(b, 17, uint64(item.TitleLength))
+	if item.RankChange != nil {
+		var msg []byte
+		msg = appendProtoString(msg, 1, item.RankChange.Status)
+		msg = appendProtoVarint(msg, 2, uint64(item.RankChange.PreviousRank))
+		msg = appendProtoVarint(msg, 3, uint64(item.RankChange.Change))
+		b = appendProtoMessage(b, 18, msg)
+	}
+	return b
+}
+
+// response_item.proto の Response としてエンコードする
+func (resp Response) MarshalProtobuf() []byte {
+	var b []byte
+	b = appendProtoString(b, 1, resp.Keyword)
+	for _, item := range resp.Items {
+		b = appendProtoMessage(b, 2, item.MarshalProtobuf())
+	}
+	b = appendProtoVarint(b, 3, uint64(resp.TotalLikes))
+	b = appendProtoVarint(b, 4, uint64(resp.MatchedBeforeFilter))
+	if resp.Partial {
+		b = appendProtoVarint(b, 5, 1)
+	}
+	b = appendProtoVarint(b, 6, uint64(resp.NextRefreshAfter))
+	for _, keyword := range resp.BroadenedKeywords {
+		b = appendProtoString(b, 7, keyword)
+	}
+	b = appendProtoString(b, 8, resp.APIVersion)
+	b = appendProtoVarint(b, 9, uint64(resp.ServerProcessingMs))
+	if resp.Completeness != 0 {
+		b = appendProtoDouble(b, 10, resp.Completeness)
+	}
+	for _, warning := range resp.Warnings {
+		b = appendProtoString(b, 11, warning)
+	}
+	if resp.Truncated {
+		b = appendProtoVarint(b, 12, 1)
+	}
+	for _, day := range resp.Days {
+		var msg []byte
+		msg = appendProtoString(msg, 1, day.Date)
+		msg = appendProtoVarint(msg, 2, uint64(day.Count))
+		msg = appendProtoVarint(msg, 3, uint64(day.TotalLikes))
+		for _, item := range day.Items {
+			msg = appendProtoMessage(msg, 4, item.MarshalProtobuf())
+		}
+		b = appendProtoMessage(b, 13, msg)
+	}
+	if resp.Archived != nil {
+		var msg []byte
+		msg = appendProtoVarint(msg, 1, uint64(resp.Archived.Count))
+		msg = appendProtoVarint(msg, 2, uint64(resp.Archived.TotalLikes))
+		b = appendProtoMessage(b, 14, msg)
+	}
+	if resp.Summary != nil {
+		b = appendProtoMessage(b, 15, resp.Summary.marshalProtobuf())
+	}
+	for _, point := range resp.Series {
+		var msg []byte
+		msg = appendProtoString(msg, 1, point.Date)
+		msg = appendProtoVarint(msg, 2, uint64(point.ReleaseCount))
+		msg = appendProtoVarint(msg, 3, uint64(point.TotalLikes))
+		b = appendProtoMessage(b, 16, msg)
+	}
+	for _, stats := range resp.WeekdayBreakdown {
+		var msg []byte
+		msg = appendProtoString(msg, 1, stats.Weekday)
+		msg = appendProtoVarint(msg, 2, uint64(stats.ReleaseCount))
+		msg = appendProtoVarint(msg, 3, uint64(stats.TotalLikes))
+		if stats.AverageLikes != 0 {
+			msg = appendProtoDouble(msg, 4, stats.AverageLikes)
+		}
+		b = appendProtoMessage(b, 17, msg)
+	}
+	b = appendProtoString(b, 18, resp.SnapshotID)
+	for _, dropped := range resp.DroppedItems {
+		var msg []byte
+		msg = appendProtoString(msg, 1, dropped.PostURL)
+		msg = appendProtoString(msg, 2, dropped.Title)
+		msg = appendProtoVarint(msg, 3, uint64(dropped.PreviousRank))
+		b = appendProtoMessage(b, 19, msg)
+	}
+	if resp.Sample != nil {
+		var msg []byte
+		msg = appendProtoPackedVarints(msg, 1, resp.Sample.Pages)
+		msg = appendProtoVarint(msg, 2, uint64(resp.Sample.TotalPages))
+		if resp.Sample.Fraction != 0 {
+			msg = appendProtoDouble(msg, 3, resp.Sample.Fraction)
+		}
+		msg = appendProtoVarint(msg, 4, uint64(resp.Sample.Seed))
+		b = appendProtoMessage(b, 20, msg)
+	}
+	for _, keyword := range resp.ExpandedKeywords {
+		b = appendProtoString(b, 21, keyword)
+	}
+	return b
+}
+
+// JSONで null になる項目は書き出さない (optional)
+func (summary Summary) marshalProtobuf() []byte {
+	var b []byte
+	b = appendProtoVarint(b, 1, uint64(summary.TotalMatches))
+	b = appendProtoVarint(b, 2, uint64(summary.TotalLikes))
+	if summary.TopCompany != nil {
+		b = appendProtoOptionalString(b, 3, *summary.TopCompany)
+	}
+	if summary.AverageLikes != nil {
+		b = appendProtoDouble(b, 4, *summary.AverageLikes)
+	}
+	if summary.Newest != nil {
+		b = appendProtoOptionalString(b, 5, summary.Newest.Format(time.RFC3339))
+	}
+	if summary.Oldest != nil {
+		b = appendProtoOptionalString(b, 6, summary.Oldest.Format(time.RFC3339))
+	}
+	return b
+}
+
+// 各項目の前にバイト長を付けて連結する
+func marshalProtobufItems(items []ResponseItem) []byte {
+	var b []byte
+	for _, item := range items {
+		msg := item.MarshalProtobuf()
+		b = binary.AppendUvarint(b, uint64(len(msg)))
+		b = append(b, msg...)
+	}
+	return b
+}
+
+// proto3ではデフォルト値 (空文字) のフィールドは書き出さない
+func appendProtoString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// optional な文字列は空でも書き出す
+func appendProtoOptionalString(b []byte, field int, v string) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// 埋め込みメッセージは空でも書き出す (repeated の要素数を保つため)
+func appendProtoMessage(b []byte, field int, msg []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// 0でも書き出すので、デフォルト値を省く場合は呼び出し側で確かめる
+func appendProtoDouble(b []byte, field int, v float64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// proto3の repeated な数値は packed で書き出す
+func appendProtoPackedVarints(b []byte, field int, values []int) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	return appendProtoMessage(b, field, packed)
+}
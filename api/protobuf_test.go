@@ -0,0 +1,425 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// テストで読み戻すための最小限のprotobufのデコーダー
+type protoValue struct {
+	varint uint64
+	bytes  []byte
+}
+
+func (v protoValue) float64() float64 {
+	return math.Float64frombits(v.varint)
+}
+
+// フィールド番号ごとに値を出てきた順に並べる
+func decodeProtoFields(b []byte) (map[int][]protoValue, error) {
+	fields := make(map[int][]protoValue)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("broken key")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("broken varint")
+			}
+			b = b[n:]
+			fields[field] = append(fields[field], protoValue{varint: v})
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("broken fixed64")
+			}
+			fields[field] = append(fields[field], protoValue{varint: binary.LittleEndian.Uint64(b)})
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("broken length")
+			}
+			fields[field] = append(fields[field], protoValue{bytes: b[n : n+int(l)]})
+			b = b[n+int(l):]
+		default:
+			return nil, errors.New("unknown wire type")
+		}
+	}
+	return fields, nil
+}
+
+func protoString(fields map[int][]protoValue, field int) string {
+	values := fields[field]
+	if len(values) == 0 {
+		return ""
+	}
+	return string(values[len(values)-1].bytes)
+}
+
+func protoVarint(fields map[int][]protoValue, field int) uint64 {
+	values := fields[field]
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1].varint
+}
+
+func protoFloat(fields map[int][]protoValue, field int) *float64 {
+	values := fields[field]
+	if len(values) == 0 {
+		return nil
+	}
+	f := values[len(values)-1].float64()
+	return &f
+}
+
+func decodeProtoItem(t *testing.T, b []byte) ResponseItem {
+	t.Helper()
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := ResponseItem{
+		CorporationName: protoString(fields, 1),
+		PublishedDate:   protoString(fields, 2),
+		ThumbnailURL:    protoString(fields, 4),
+		PostURL:         protoString(fields, 5),
+		Title:           protoString(fields, 6),
+		LikeCount:       int(protoVarint(fields, 7)),
+		LikeCountStatus: protoString(fields, 8),
+		ThumbnailWidth:  int(protoVarint(fields, 9)),
+		ThumbnailHeight: int(protoVarint(fields, 10)),
+		Tier:            protoString(fields, 11),
+		EngagementRate:  protoFloat(fields, 12),
+		Host:            protoString(fields, 15),
+		Freshness:       protoFloat(fields, 16),
+		TitleLength:     int(protoVarint(fields, 17)),
+	}
+	if v := protoString(fields, 3); v != "" {
+		if item.PublishedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range fields[13] {
+		sample, err := decodeProtoFields(v.bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at, _ := time.Parse(time.RFC3339, protoString(sample, 1))
+		item.Sparkline = append(item.Sparkline, LikeSample{At: at, LikeCount: int(protoVarint(sample, 2))})
+	}
+	for _, v := range fields[14] {
+		item.Tags = append(item.Tags, string(v.bytes))
+	}
+	if values := fields[18]; len(values) > 0 {
+		rank := decodeProtoMessage(t, values[0].bytes)
+		item.RankChange = &RankChange{
+			Status:       protoString(rank, 1),
+			PreviousRank: int(int64(protoVarint(rank, 2))),
+			Change:       int(int64(protoVarint(rank, 3))),
+		}
+	}
+	return item
+}
+
+func decodeProtoMessage(t *testing.T, b []byte) map[int][]protoValue {
+	t.Helper()
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+// RFC3339の文字列で書き出した optional な日時
+func protoTime(t *testing.T, fields map[int][]protoValue, field int) *time.Time {
+	t.Helper()
+	if len(fields[field]) == 0 {
+		return nil
+	}
+	at, err := time.Parse(time.RFC3339, protoString(fields, field))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &at
+}
+
+func protoStrings(fields map[int][]protoValue, field int) []string {
+	var values []string
+	for _, v := range fields[field] {
+		values = append(values, string(v.bytes))
+	}
+	return values
+}
+
+// response_item.proto の Response を読み戻す
+func decodeProtoResponse(t *testing.T, b []byte) Response {
+	t.Helper()
+	fields := decodeProtoMessage(t, b)
+	resp := Response{
+		Keyword:             protoString(fields, 1),
+		Items:               []ResponseItem{},
+		TotalLikes:          int(protoVarint(fields, 3)),
+		MatchedBeforeFilter: int(protoVarint(fields, 4)),
+		Partial:             protoVarint(fields, 5) != 0,
+		NextRefreshAfter:    int(protoVarint(fields, 6)),
+		BroadenedKeywords:   protoStrings(fields, 7),
+		APIVersion:          protoString(fields, 8),
+		ServerProcessingMs:  int64(protoVarint(fields, 9)),
+		Warnings:            protoStrings(fields, 11),
+		Truncated:           protoVarint(fields, 12) != 0,
+		SnapshotID:          protoString(fields, 18),
+		ExpandedKeywords:    protoStrings(fields, 21),
+	}
+	for _, v := range fields[2] {
+		resp.Items = append(resp.Items, decodeProtoItem(t, v.bytes))
+	}
+	if completeness := protoFloat(fields, 10); completeness != nil {
+		resp.Completeness = *completeness
+	}
+	for _, v := range fields[13] {
+		day := decodeProtoMessage(t, v.bytes)
+		bucket := DayBucket{Date: protoString(day, 1), Count: int(protoVarint(day, 2)), TotalLikes: int(protoVarint(day, 3)), Items: []ResponseItem{}}
+		for _, item := range day[4] {
+			bucket.Items = append(bucket.Items, decodeProtoItem(t, item.bytes))
+		}
+		resp.Days = append(resp.Days, bucket)
+	}
+	if values := fields[14]; len(values) > 0 {
+		archived := decodeProtoMessage(t, values[0].bytes)
+		resp.Archived = &ArchiveSummary{Count: int(protoVarint(archived, 1)), TotalLikes: int(protoVarint(archived, 2))}
+	}
+	if values := fields[15]; len(values) > 0 {
+		summary := decodeProtoMessage(t, values[0].bytes)
+		resp.Summary = &Summary{
+			TotalMatches: int(protoVarint(summary, 1)),
+			TotalLikes:   int(protoVarint(summary, 2)),
+			AverageLikes: protoFloat(summary, 4),
+			Newest:       protoTime(t, summary, 5),
+			Oldest:       protoTime(t, summary, 6),
+		}
+		if len(summary[3]) > 0 {
+			company := protoString(summary, 3)
+			resp.Summary.TopCompany = &company
+		}
+	}
+	for _, v := range fields[16] {
+		point := decodeProtoMessage(t, v.bytes)
+		resp.Series = append(resp.Series, SeriesPoint{Date: protoString(point, 1), ReleaseCount: int(protoVarint(point, 2)), TotalLikes: int(protoVarint(point, 3))})
+	}
+	for _, v := range fields[17] {
+		stats := decodeProtoMessage(t, v.bytes)
+		weekday := WeekdayStats{Weekday: protoString(stats, 1), ReleaseCount: int(protoVarint(stats, 2)), TotalLikes: int(protoVarint(stats, 3))}
+		if average := protoFloat(stats, 4); average != nil {
+			weekday.AverageLikes = *average
+		}
+		resp.WeekdayBreakdown = append(resp.WeekdayBreakdown, weekday)
+	}
+	for _, v := range fields[19] {
+		dropped := decodeProtoMessage(t, v.bytes)
+		resp.DroppedItems = append(resp.DroppedItems, DroppedItem{PostURL: protoString(dropped, 1), Title: protoString(dropped, 2), PreviousRank: int(protoVarint(dropped, 3))})
+	}
+	if values := fields[20]; len(values) > 0 {
+		sample := decodeProtoMessage(t, values[0].bytes)
+		resp.Sample = &SampleInfo{Pages: []int{}, TotalPages: int(protoVarint(sample, 2)), Seed: int64(protoVarint(sample, 4))}
+		// packed な repeated
+		for _, v := range sample[1] {
+			for b := v.bytes; len(b) > 0; {
+				page, n := binary.Uvarint(b)
+				if n <= 0 {
+					t.Fatal("broken packed varint")
+				}
+				resp.Sample.Pages = append(resp.Sample.Pages, int(page))
+				b = b[n:]
+			}
+		}
+		if fraction := protoFloat(sample, 3); fraction != nil {
+			resp.Sample.Fraction = *fraction
+		}
+	}
+	return resp
+}
+
+// JSONにした場合に同じになるか
+func assertSameJSON(t *testing.T, got, want any) {
+	t.Helper()
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got  %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+// 各項目の前にバイト長が付いたものを読み戻す
+func decodeProtoItems(t *testing.T, b []byte) []ResponseItem {
+	t.Helper()
+	var items []ResponseItem
+	for len(b) > 0 {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			t.Fatal("broken length prefix")
+		}
+		items = append(items, decodeProtoItem(t, b[n:n+int(l)]))
+		b = b[n+int(l):]
+	}
+	return items
+}
+
+func TestResponseItemProtobufRoundTrip(t *testing.T) {
+	rate, fresh := 0.25, 0.0
+	at := time.Date(2024, 12, 1, 9, 0, 0, 0, jst)
+	item := ResponseItem{
+		CorporationName: "会社",
+		PublishedDate:   "2024年12月01日 09:00",
+		PublishedAt:     at,
+		ThumbnailURL:    "https://prtimes.jp/a.jpg",
+		PostURL:         "https://prtimes.jp" + fakeReleaseURL(1),
+		Title:           "タイトル",
+		LikeCount:       42,
+		LikeCountStatus: likeCountStatusOK,
+		ThumbnailWidth:  640,
+		ThumbnailHeight: 480,
+		Tier:            "medium",
+		EngagementRate:  &rate,
+		Sparkline:       []LikeSample{{At: at, LikeCount: 40}, {At: at.Add(time.Hour), LikeCount: 42}},
+		Tags:            []string{"イベント", "調査レポート"},
+		Host:            "prtimes.jp",
+		Freshness:       &fresh,
+		TitleLength:     4,
+	}
+	got := decodeProtoItem(t, item.MarshalProtobuf())
+	if got.CorporationName != item.CorporationName || got.PublishedDate != item.PublishedDate || !got.PublishedAt.Equal(item.PublishedAt) ||
+		got.ThumbnailURL != item.ThumbnailURL || got.PostURL != item.PostURL || got.Title != item.Title ||
+		got.LikeCount != item.LikeCount || got.LikeCountStatus != item.LikeCountStatus ||
+		got.ThumbnailWidth != item.ThumbnailWidth || got.ThumbnailHeight != item.ThumbnailHeight || got.Tier != item.Tier ||
+		got.Host != item.Host || got.TitleLength != item.TitleLength {
+		t.Errorf("got %+v, want %+v", got, item)
+	}
+	if got.EngagementRate == nil || *got.EngagementRate != rate {
+		t.Errorf("engagementRate = %v, want %v", got.EngagementRate, rate)
+	}
+	// optional なので0でも読み戻せる
+	if got.Freshness == nil || *got.Freshness != 0 {
+		t.Errorf("freshness = %v, want 0", got.Freshness)
+	}
+	if len(got.Sparkline) != 2 || got.Sparkline[1].LikeCount != 42 || !got.Sparkline[1].At.Equal(at.Add(time.Hour)) {
+		t.Errorf("sparkline = %+v", got.Sparkline)
+	}
+	if len(got.Tags) != 2 || got.Tags[1] != "調査レポート" {
+		t.Errorf("tags = %v", got.Tags)
+	}
+}
+
+// format=protobuf と Accept: application/x-protobuf は JSON と同じ項目を返す
+func TestProtobufFormat(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("pb", n, "2024年12月01日 09時00分", n*10)
+	}
+	s := NewServer(f.config())
+	want := getResponse(t, s, "/prtimes_posts?keyword=pb").Items
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=pb&format=protobuf", nil),
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=pb", nil)
+			r.Header.Set("Accept", protobufContentType)
+			return r
+		}(),
+	} {
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != protobufContentType {
+			t.Errorf("Content-Type = %q, want %q", got, protobufContentType)
+		}
+		got := decodeProtoItems(t, rec.Body.Bytes())
+		if len(got) != len(want) {
+			t.Fatalf("got %d items, want %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i].PostURL != want[i].PostURL || got[i].Title != want[i].Title || got[i].LikeCount != want[i].LikeCount ||
+				got[i].PublishedDate != want[i].PublishedDate || !got[i].PublishedAt.Equal(want[i].PublishedAt) {
+				t.Errorf("item %d: got %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// JSONの封筒の項目は全てprotobufの Response でも読み戻せる
+func TestResponseProtobufRoundTrip(t *testing.T) {
+	at := time.Date(2024, 12, 1, 9, 0, 0, 0, jst)
+	company, average := "会社", 12.5
+	item := ResponseItem{
+		Title:      "タイトル",
+		PostURL:    "https://prtimes.jp" + fakeReleaseURL(1),
+		LikeCount:  25,
+		RankChange: &RankChange{Status: "down", PreviousRank: 1, Change: -2},
+	}
+	want := Response{
+		APIVersion:          apiVersionV2,
+		Keyword:             "封筒",
+		Items:               []ResponseItem{item, {Title: "新着", RankChange: &RankChange{Status: "new"}}},
+		TotalLikes:          25,
+		ServerProcessingMs:  12,
+		SnapshotID:          "snap",
+		DroppedItems:        []DroppedItem{{PostURL: "https://prtimes.jp/dropped", Title: "消えた", PreviousRank: 3}},
+		Sample:              &SampleInfo{Pages: []int{1, 3, 200}, TotalPages: 300, Fraction: 0.01, Seed: -7},
+		Warnings:            []string{"partial"},
+		MatchedBeforeFilter: 4,
+		Partial:             true,
+		Truncated:           true,
+		Completeness:        0.5,
+		NextRefreshAfter:    300,
+		BroadenedKeywords:   []string{"封"},
+		ExpandedKeywords:    []string{"ふうとう"},
+		Days:                []DayBucket{{Date: "2024-12-01", Count: 1, TotalLikes: 25, Items: []ResponseItem{item}}},
+		Archived:            &ArchiveSummary{Count: 2, TotalLikes: 3},
+		Summary:             &Summary{TotalMatches: 2, TotalLikes: 25, TopCompany: &company, AverageLikes: &average, Newest: &at, Oldest: &at},
+		Series:              []SeriesPoint{{Date: "2024-12-01", ReleaseCount: 1, TotalLikes: 25}, {Date: "2024-12-02"}},
+		WeekdayBreakdown:    []WeekdayStats{{Weekday: "Sunday", ReleaseCount: 1, TotalLikes: 25, AverageLikes: 25}},
+	}
+	assertSameJSON(t, decodeProtoResponse(t, want.MarshalProtobuf()), want)
+
+	// null の項目は null のまま
+	empty := Response{APIVersion: apiVersionV2, Items: []ResponseItem{}, Summary: &Summary{}}
+	assertSameJSON(t, decodeProtoResponse(t, empty.MarshalProtobuf()), empty)
+}
+
+// format=protobuf&envelope=true はJSONと同じ封筒を返す
+func TestProtobufEnvelopeMatchesJSON(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("pb", 1, "2024年12月01日 09時00分", 10)
+	f.addRelease("pb", 2, "2024年12月03日 09時00分", 30)
+	f.addRelease("pb", 3, "2024年12月03日 18時00分", 20)
+	s := NewServer(f.config())
+	query := "/prtimes_posts?keyword=pb&limit=2&summary=true&series=daily&weekdayBreakdown=true&groupBy=day"
+	want := getResponse(t, s, query)
+
+	rec := serveAPI(t, s, query+"&format=protobuf&envelope=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	got := decodeProtoResponse(t, rec.Body.Bytes())
+	got.ServerProcessingMs, want.ServerProcessingMs = 0, 0
+	assertSameJSON(t, got, want)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PR TIMESがレート制限のヘッダーを返す場合に、残り回数を使い切ったら
+// リセットされるまで次のリクエストを待たせる
+// ヘッダーが返ってこない間は何もしない
+type rateLimiter struct {
+	mu sync.Mutex
+	// ヘッダーを受け取ったことがあるか
+	known     bool
+	remaining int
+	reset     time.Time
+}
+
+// X-RateLimit-Reset が Unix時刻ではなく残り秒数とみなす上限
+const rateLimitResetDeltaMax = 1_000_000_000
+
+// リクエストを送る前に呼ぶ
+// 残り回数が無い場合はリセットまで待ち、送る分だけ残り回数を減らしておく
+// (並行して送るリクエストが揃って上限を超えないように、レスポンスを待たずに減らす)
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if !l.known {
+			l.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		if !now.Before(l.reset) {
+			// リセットされた後は次のレスポンスで分かるまで制限しない
+			l.known = false
+			l.mu.Unlock()
+			return nil
+		}
+		if l.remaining > 0 {
+			l.remaining--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := l.reset.Sub(now)
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// レスポンスのヘッダーから残り回数とリセット時刻を読む
+func (l *rateLimiter) update(header http.Header) {
+	remainingStr := header.Get("X-RateLimit-Remaining")
+	resetStr := header.Get("X-RateLimit-Reset")
+	if remainingStr == "" || resetStr == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(remainingStr)
+	if err != nil {
+		return
+	}
+	resetValue, err := strconv.ParseInt(resetStr, 10, 64)
+	if err != nil {
+		return
+	}
+	var reset time.Time
+	if resetValue < rateLimitResetDeltaMax {
+		reset = time.Now().Add(time.Duration(resetValue) * time.Second)
+	} else {
+		reset = time.Unix(resetValue, 0)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 並行したレスポンスが前後して届くことがあるので、同じ期間内では少ない方を信じる
+	if l.known && reset.Equal(l.reset) && l.remaining < remaining {
+		return
+	}
+	l.known = true
+	l.remaining = remaining
+	l.reset = reset
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ヘッダーが無い間は待たない
+func TestRateLimiterWithoutHeaders(t *testing.T) {
+	var l rateLimiter
+	l.update(http.Header{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 100; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 残り回数が0の間はリセットまで待つ (ctx が先に終わった場合はそのエラー)
+func TestRateLimiterWaitsForReset(t *testing.T) {
+	var l rateLimiter
+	l.update(http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"60"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait = %v, want DeadlineExceeded", err)
+	}
+}
+
+// PR TIMESが減らしていく X-RateLimit-Remaining が0になったら、X-RateLimit-Reset まで次を送らない
+func TestRateLimitPausesUpstreamCalls(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("limited", 1, "2024年12月01日 09時00分", 1)
+	reset := time.Now().Truncate(time.Second).Add(2 * time.Second)
+	var mu sync.Mutex
+	var arrivals []time.Time
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		arrivals = append(arrivals, time.Now())
+		remaining := max(2-len(arrivals), 0)
+		if time.Now().After(reset) {
+			remaining = 100
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		return false
+	}
+	s := NewServer(f.config())
+
+	for i := 0; i < 4; i++ {
+		if _, err := s.fetchPRTimesData(context.Background(), "limited", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(arrivals) != 4 {
+		t.Fatalf("got %d requests, want 4", len(arrivals))
+	}
+	// 2回目で残りが0になるので、3回目はリセットまで待つ
+	if arrivals[1].After(reset) {
+		t.Errorf("second request waited until the reset")
+	}
+	if arrivals[2].Before(reset) {
+		t.Errorf("third request was sent %v before the reset", reset.Sub(arrivals[2]))
+	}
+}
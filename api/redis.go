@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redisのキーに付ける接頭辞 (同じRedisを他の用途と共有できるようにする)
+const redisKeyPrefix = "prtimes:"
+
+// 使い終わった接続を残しておく数
+const redisMaxIdleConns = 8
+
+// Redisに持つCache
+// GET, SET, SCAN, DEL だけを使う
+type redisCache struct {
+	addr     string
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+// NewRedisCache は redis://[[user]:password@]host[:port][/db] のRedisに持つCacheを返す
+// 接続は最初に使う時に張る
+// timeout は接続と、ctxに期限が無い場合の1回のコマンドの時間の上限 (0以下の場合は無制限)
+func NewRedisCache(rawURL string, timeout time.Duration) (Cache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("redis URL must be redis://host[:port][/db]: %s", rawURL)
+	}
+	c := &redisCache{addr: u.Host, timeout: timeout, idle: make(chan *redisConn, redisMaxIdleConns)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected redis reply for GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", redisKeyPrefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+func (c *redisCache) Delete(ctx context.Context, keys ...string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, redisKeyPrefix+key)
+	}
+	reply, err := c.do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return int(n), nil
+}
+
+func (c *redisCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	pattern := redisGlobEscape(redisKeyPrefix+prefix) + "*"
+	deleted := 0
+	cursor := "0"
+	for {
+		reply, err := c.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return deleted, err
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return deleted, fmt.Errorf("unexpected redis reply for SCAN: %v", reply)
+		}
+		next, _ := parts[0].([]byte)
+		keys, _ := parts[1].([]any)
+		var names []string
+		for _, key := range keys {
+			if b, ok := key.([]byte); ok {
+				names = append(names, strings.TrimPrefix(string(b), redisKeyPrefix))
+			}
+		}
+		n, err := c.Delete(ctx, names...)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return deleted, nil
+		}
+	}
+}
+
+// SCAN の MATCH で特別な意味を持つ文字をエスケープする
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// コマンドを1つ送って応答を返す
+// 応答がエラーの場合以外で失敗した接続は使い回さない
+func (c *redisCache) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (c *redisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: max(c.timeout, 0)}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), timeout: c.timeout}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.do(ctx, args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Redisが返したエラー (接続は使い続けられる)
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// 応答は文字列が []byte、整数が int64、配列が []any、nil の場合は nil
+// ctxに期限が無い場合は timeout を期限にし、途中でctxが終わった場合は接続を閉じて止める (その接続は使い回せない)
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok && c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	var reply any
+	_, err := io.WriteString(c, b.String())
+	if err == nil {
+		reply, err = c.readReply()
+	}
+	if !stop() {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected redis reply: %q", line)
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// テスト用のRedis (redisCache が使うコマンドだけ)
+type fakeRedis struct {
+	addr     string
+	password string
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	// 接続ごとに SELECT したデータベース
+	selected []int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	r := &fakeRedis{addr: ln.Addr().String(), password: password, values: make(map[string]string), expires: make(map[string]time.Time)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	authed := r.password == ""
+	for {
+		args, err := readRedisCommand(br)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		r.mu.Lock()
+		var reply string
+		switch cmd {
+		case "AUTH":
+			if args[len(args)-1] == r.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT":
+			db, _ := strconv.Atoi(args[1])
+			r.selected = append(r.selected, db)
+			reply = "+OK\r\n"
+		case "GET":
+			if v, ok := r.get(args[1]); ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			r.values[args[1]] = args[2]
+			delete(r.expires, args[1])
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				r.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			reply = "+OK\r\n"
+		case "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := r.get(key); ok {
+					delete(r.values, key)
+					n++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", n)
+		case "SCAN":
+			// 一度に全て返す
+			var keys []string
+			for key := range r.values {
+				if ok, _ := path.Match(args[3], key); ok {
+					keys = append(keys, key)
+				}
+			}
+			reply = fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+			for _, key := range keys {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+// mu を持った状態で呼ぶ
+func (r *fakeRedis) get(key string) (string, bool) {
+	if expires, ok := r.expires[key]; ok && time.Now().After(expires) {
+		delete(r.values, key)
+		delete(r.expires, key)
+	}
+	v, ok := r.values[key]
+	return v, ok
+}
+
+// RESPの配列で送られたコマンドを読む
+func readRedisCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	r := newFakeRedis(t, "secret")
+	cache, err := NewRedisCache("redis://:secret@"+r.addr+"/2", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Set(ctx, "like:1", []byte("12"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := cache.Get(ctx, "like:1"); err != nil || !ok || string(value) != "12" {
+		t.Errorf("Get = %q, %v, %v", value, ok, err)
+	}
+	// キーには接頭辞を付ける
+	r.mu.Lock()
+	_, prefixed := r.values[redisKeyPrefix+"like:1"]
+	selected := append([]int(nil), r.selected...)
+	r.mu.Unlock()
+	if !prefixed {
+		t.Errorf("key was not stored with the %q prefix", redisKeyPrefix)
+	}
+	if len(selected) == 0 || selected[0] != 2 {
+		t.Errorf("selected databases = %v, want 2", selected)
+	}
+
+	if err := cache.Set(ctx, "like:2", []byte("1"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "like:2"); ok {
+		t.Error("an expired value was returned")
+	}
+
+	// 接頭辞に含まれる * は文字として扱う
+	for _, key := range []string{"page:a*:1", "page:a*:2", "page:ab:1"} {
+		cache.Set(ctx, key, []byte("{}"), 0)
+	}
+	if n, err := cache.DeletePrefix(ctx, "page:a*:"); err != nil || n != 2 {
+		t.Errorf("DeletePrefix = %d, %v, want 2", n, err)
+	}
+	if _, ok, _ := cache.Get(ctx, "page:ab:1"); !ok {
+		t.Error("DeletePrefix deleted a key without the prefix")
+	}
+	if n, err := cache.Delete(ctx, "like:1", "missing"); err != nil || n != 1 {
+		t.Errorf("Delete = %d, %v, want 1", n, err)
+	}
+
+	wrong, _ := NewRedisCache("redis://:wrong@"+r.addr, time.Second)
+	if _, _, err := wrong.Get(ctx, "like:1"); err == nil {
+		t.Error("Get with a wrong password succeeded")
+	}
+}
+
+func TestNewRedisCacheInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost:6379", "redis://", "redis://localhost/db", "::"} {
+		if _, err := NewRedisCache(rawURL, time.Second); err == nil {
+			t.Errorf("NewRedisCache(%q) succeeded", rawURL)
+		}
+	}
+}
+
+// 同じRedisを使う別のサーバーが取得した検索結果といいね数を使う
+func TestRedisCacheSharedAcrossServers(t *testing.T) {
+	r := newFakeRedis(t, "")
+	f := newFakeUpstream(t)
+	f.addRelease("shared", 1, "2024年12月01日 09時00分", 5)
+	f.addRelease("shared", 2, "2024年12月02日 09時00分", 3)
+
+	newServer := func() *Server {
+		cache, err := NewRedisCache("redis://"+r.addr, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := f.config()
+		cfg.Cache = cache
+		return NewServer(cfg)
+	}
+	first, second := newServer(), newServer()
+
+	if rec := serveAPI(t, first, "/prtimes_posts?keyword=shared"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("first server: X-Cache = %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+	searchCalls, likeCalls := f.searchCalls.Load(), f.likeCalls.Load()
+
+	rec := serveAPI(t, second, "/prtimes_posts?keyword=shared")
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("second server: X-Cache = %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if f.searchCalls.Load() != searchCalls || f.likeCalls.Load() != likeCalls {
+		t.Errorf("second server called PR TIMES: %d searches, %d like counts", f.searchCalls.Load()-searchCalls, f.likeCalls.Load()-likeCalls)
+	}
+
+	// 別のキーワードで見つかった同じリリースは、最初のサーバーが取得したいいね数を使う
+	f.addRelease("other", 1, "2024年12月01日 09時00分", 5)
+	if resp := getResponse(t, second, "/prtimes_posts?keyword=other"); len(resp.Items) != 1 || resp.Items[0].LikeCount != 5 {
+		t.Errorf("items = %+v", resp.Items)
+	}
+	if f.likeCalls.Load() != likeCalls {
+		t.Errorf("second server fetched %d like counts", f.likeCalls.Load()-likeCalls)
+	}
+}
+
+// 接続を受け付けるが何も返さないRedis
+func newStalledRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// ctxに期限が無い場合は timeout で諦め、途中でctxが終わった場合はすぐに止める
+func TestRedisCacheStalled(t *testing.T) {
+	addr := newStalledRedis(t)
+
+	cache, err := NewRedisCache("redis://"+addr, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, _, err := cache.Get(context.Background(), "like:1"); err == nil {
+		t.Error("Get from a stalled Redis succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get took %v without a deadline, want about the timeout", elapsed)
+	}
+
+	cache, err = NewRedisCache("redis://"+addr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	if _, err := cache.DeletePrefix(ctx, "like:"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("DeletePrefix took %v after the context was cancelled", elapsed)
+	}
+}
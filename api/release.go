@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// リリースページのうち、metaタグを探すために読む範囲
+const releasePageHeadBytes = 256 * 1024
+
+var (
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)(property|name|content)\s*=\s*"([^"]*)"`)
+)
+
+// URLで指定した1件のリリースを、検索結果と同じ形で返す
+// タイトル等はリリースページのmetaタグから取れたものだけを入れる
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	releaseURL := r.URL.Query().Get("url")
+	if releaseURL == "" {
+		http.Error(w, "url query parameter is required", http.StatusBadRequest)
+		return
+	}
+	// 検索結果と同じく BaseURL と AlternateDomains のURLだけを受け付ける
+	resolved, known := s.resolveReleaseURL(releaseURL)
+	releaseID := ""
+	if known {
+		releaseID = extractReleaseID(resolved)
+	}
+	if releaseID == "" {
+		http.Error(w, "url query parameter must be a PR TIMES release URL", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	item := ResponseItem{
+		ReleaseID: releaseID,
+		PostURL:   s.releasePostURL(resolved, releaseID),
+	}
+
+	meta, err := s.fetchReleaseMeta(ctx, item.PostURL)
+	if err != nil {
+		s.logFetchError(ctx, "Error fetching release page", item.PostURL, ":", err)
+	}
+	item.Title = meta["og:title"]
+	item.ThumbnailURL = meta["og:image"]
+	if t, err := time.Parse(time.RFC3339, meta["article:published_time"]); err == nil {
+		item.PublishedAt = t.In(jst)
+		item.PublishedDate = formatPublishedDate(t, jst)
+	}
+
+	s.fillLikeCount(ctx, &item)
+	if item.LikeCountStatus == likeCountStatusOK {
+		s.likeHistory.recordRelease(releaseID)
+	}
+	if ctx.Err() == context.Canceled {
+		s.logDebug("Request cancelled by client:", r.URL)
+		return
+	}
+	if r.URL.Query().Get("debug") != "true" {
+		item.LikeCountStatus = ""
+	}
+	writeJSON(w, item)
+}
+
+// クエリなどを除いたリリースページのURL
+// BaseURL のURLは BaseURL に、AlternateDomains のURLはそのドメインのままにする
+func (s *Server) releasePostURL(resolved, releaseID string) string {
+	u, err := url.Parse(resolved)
+	if err != nil || strings.EqualFold(u.Hostname(), urlHost(s.cfg.BaseURL)) {
+		return fmt.Sprintf("%s/main/html/rd/p/%s.html", s.cfg.BaseURL, releaseID)
+	}
+	return fmt.Sprintf("%s://%s/main/html/rd/p/%s.html", u.Scheme, u.Host, releaseID)
+}
+
+// リリースページのmetaタグ (property または name → content)
+func (s *Server) fetchReleaseMeta(ctx context.Context, pageURL string) (map[string]string, error) {
+	meta := make(map[string]string)
+	resp, err := s.httpGet(ctx, pageURL)
+	if err != nil {
+		return meta, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return meta, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, releasePageHeadBytes))
+	if err != nil {
+		return meta, err
+	}
+	for _, tag := range metaTagPattern.FindAll(body, -1) {
+		var key, content string
+		for _, attr := range metaAttrPattern.FindAllSubmatch(tag, -1) {
+			switch string(attr[1]) {
+			case "property", "name":
+				key = string(attr[2])
+			case "content":
+				content = html.UnescapeString(string(attr[2]))
+			}
+		}
+		if key != "" {
+			if _, ok := meta[key]; !ok {
+				meta[key] = content
+			}
+		}
+	}
+	if len(meta) == 0 {
+		log.Println("No meta tags found in release page:", pageURL)
+	}
+	return meta, nil
+}
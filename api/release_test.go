@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const releasePageHTML = `<!DOCTYPE html><html><head>
+<meta property="og:title" content="新商品&amp;サービスのお知らせ">
+<meta property="og:image" content="https://prtimes.jp/i/1/2/ogp/a.jpg">
+<meta property="article:published_time" content="2024-12-01T00:00:00Z">
+<meta property="og:title" content="後のタイトルは使わない">
+</head><body></body></html>`
+
+func TestReleaseEndpoint(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("release", 2, "", 12)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == fakeReleaseURL(2) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(releasePageHTML))
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+
+	// クエリ付きでも、リリースIDが取れればクエリを除いたURLにする
+	target := "/release?url=" + url.QueryEscape(f.URL+fakeReleaseURL(2)+"?utm_source=x")
+	rec := serveAPI(t, s, target)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var item ResponseItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.PostURL != f.URL+fakeReleaseURL(2) {
+		t.Errorf("postUrl = %s", item.PostURL)
+	}
+	if item.Title != "新商品&サービスのお知らせ" || item.ThumbnailURL != "https://prtimes.jp/i/1/2/ogp/a.jpg" {
+		t.Errorf("title = %q, thumbnailUrl = %q", item.Title, item.ThumbnailURL)
+	}
+	if !item.PublishedAt.Equal(time.Date(2024, 12, 1, 9, 0, 0, 0, jst)) || item.PublishedDate != "2024年12月01日 09:00" {
+		t.Errorf("publishedAt = %v, publishdDatetime = %q", item.PublishedAt, item.PublishedDate)
+	}
+	if item.LikeCount != 12 {
+		t.Errorf("likeCount = %d, want 12", item.LikeCount)
+	}
+}
+
+// リリースページが取れなくても、いいね数は返す
+func TestReleaseEndpointWithoutPage(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("release", 3, "", 7)
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == fakeReleaseURL(3) {
+			http.NotFound(w, r)
+			return true
+		}
+		return false
+	}
+	s := NewServer(f.config())
+	captureLog(t)
+
+	rec := serveAPI(t, s, "/release?debug=true&url="+url.QueryEscape(f.URL+fakeReleaseURL(3)))
+	var item ResponseItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "" || item.LikeCount != 7 || item.LikeCountStatus != likeCountStatusOK {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+// AlternateDomains のリリースはそのドメインのページを読み、いいね数は BaseURL から取得する
+func TestReleaseEndpointAlternateDomain(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("release", 4, "", 9)
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fakeReleaseURL(4) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(releasePageHTML))
+	}))
+	t.Cleanup(partner.Close)
+	// BaseURL (127.0.0.1) と別のホストにするため localhost で指定する
+	partnerURL := strings.Replace(partner.URL, "127.0.0.1", "localhost", 1)
+	cfg := f.config()
+	cfg.AlternateDomains = []string{"localhost"}
+	s := NewServer(cfg)
+
+	rec := serveAPI(t, s, "/release?url="+url.QueryEscape(partnerURL+fakeReleaseURL(4)+"?utm_source=x"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var item ResponseItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.PostURL != partnerURL+fakeReleaseURL(4) {
+		t.Errorf("postUrl = %s, want %s", item.PostURL, partnerURL+fakeReleaseURL(4))
+	}
+	if item.Title != "新商品&サービスのお知らせ" || item.LikeCount != 9 {
+		t.Errorf("title = %q, likeCount = %d", item.Title, item.LikeCount)
+	}
+}
+
+func TestReleaseEndpointRejectsInvalidURL(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	for _, target := range []string{
+		"/release",
+		"/release?url=" + url.QueryEscape("https://prtimes.jp/topics/keywords/abc"),
+		"/release?url=" + url.QueryEscape("https://example.com"+fakeReleaseURL(1)),
+		"/release?url=not%20a%20url",
+	} {
+		if rec := serveAPI(t, s, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, rec.Code)
+		}
+	}
+}
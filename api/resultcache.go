@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// いいね数まで揃えた検索結果の全件を ResultCacheTTL の間キーワードごとに残し、PR TIMESへ問い合わせずに使う
+// 並び替えや絞り込み、limit は取り出した後に適用するので、キーはキーワードだけにする
+func resultCacheKey(keyword string) string {
+	return "result:" + keywordCacheKey(keyword)
+}
+
+type resultCacheEntry struct {
+	Items []ResponseItem `json:"items"`
+	// ResponseItem の ReleaseID はJSONに含めないので別に持つ
+	ReleaseIDs     []string  `json:"releaseIds"`
+	FetchedAt      time.Time `json:"fetchedAt"`
+	Truncated      bool      `json:"truncated"`
+	PagesAvailable int       `json:"pagesAvailable"`
+}
+
+// 全ページのいいね数を取得する検索だけを残す
+// 新着だけ・一部のページだけ・上位N件での打ち切りなど、キーワードだけでは結果が決まらないものは残さない
+func (s *Server) resultCacheable(opts crawlOptions) bool {
+	return s.cfg.ResultCacheTTL > 0 && !opts.skipLikes && opts.newerThan.IsZero() && opts.earlyStopLikes == 0 &&
+		opts.samplePages == 0 && opts.topN == 0 && opts.onPage == nil
+}
+
+// 残しておいた結果を、このリクエストのタイムゾーンで作り直して返す
+// debug=true の場合のいいね数の取得結果は cached にする
+func (s *Server) cachedResult(ctx context.Context, keyword string, opts crawlOptions) (*crawlResult, bool) {
+	data, ok, err := s.cache.Get(ctx, resultCacheKey(keyword))
+	if err != nil {
+		log.Printf("Error reading cached result for %q: %v", keyword, err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	var entry resultCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.ReleaseIDs) != len(entry.Items) {
+		log.Printf("Error decoding cached result for %q: %v", keyword, err)
+		return nil, false
+	}
+	for i := range entry.Items {
+		item := &entry.Items[i]
+		item.ReleaseID = entry.ReleaseIDs[i]
+		if !item.PublishedAt.IsZero() {
+			item.PublishedAt = item.PublishedAt.In(opts.loc)
+			item.PublishedDate = formatPublishedDate(item.PublishedAt, opts.loc)
+		}
+		if opts.debug {
+			item.LikeCountStatus = likeCountStatusCached
+			if item.ReleaseID == "" {
+				item.LikeCountStatus = likeCountStatusUnavailable
+			}
+		}
+	}
+	return &crawlResult{
+		items:          entry.Items,
+		fetchedAt:      entry.FetchedAt,
+		truncated:      entry.Truncated,
+		pagesScanned:   entry.PagesAvailable,
+		pagesAvailable: entry.PagesAvailable,
+		resultCached:   true,
+	}, true
+}
+
+// タイムアウトやページの取得の失敗で欠けている結果は残さない (MaxCrawlItems で打ち切った場合は毎回同じなので残す)
+func (s *Server) cacheResult(ctx context.Context, keyword string, result *crawlResult, opts crawlOptions) {
+	if !s.resultCacheable(opts) || ctx.Err() != nil || result.likesTruncated || (result.completeness() < 1 && !result.truncated) {
+		return
+	}
+	entry := resultCacheEntry{
+		Items:          make([]ResponseItem, len(result.items)),
+		ReleaseIDs:     make([]string, len(result.items)),
+		FetchedAt:      result.fetchedAt,
+		Truncated:      result.truncated,
+		PagesAvailable: result.pagesAvailable,
+	}
+	for i, item := range result.items {
+		item.LikeCountStatus = ""
+		entry.Items[i] = item
+		entry.ReleaseIDs[i] = item.ReleaseID
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = s.cache.Set(ctx, resultCacheKey(keyword), data, s.cfg.ResultCacheTTL)
+	}
+	if err != nil {
+		log.Printf("Error caching result for %q: %v", keyword, err)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+// 同じキーワードの2回目は残しておいた検索結果を使い、PR TIMESへ問い合わせない
+// limit と並び替えは取り出した後に適用する
+func TestResultCache(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("cached", n, "2024年12月01日 09時00分", n)
+	}
+	s := NewServer(f.config())
+
+	if rec := serveAPI(t, s, "/prtimes_posts?keyword=cached"); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: status %d, X-Cache %q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	searchCalls, likeCalls := f.searchCalls.Load(), f.likeCalls.Load()
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=%20cached%20&limit=2&order=asc")
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if got := f.searchCalls.Load(); got != searchCalls {
+		t.Errorf("searched %d more times", got-searchCalls)
+	}
+	if got := f.likeCalls.Load(); got != likeCalls {
+		t.Errorf("fetched %d more like counts", got-likeCalls)
+	}
+	resp := getResponse(t, s, "/prtimes_posts?keyword=cached&limit=2&order=asc")
+	if len(resp.Items) != 2 || resp.Items[0].LikeCount != 1 || resp.Items[1].LikeCount != 2 {
+		t.Errorf("items = %+v, want the 2 least liked in ascending order", resp.Items)
+	}
+}
+
+// nocache の場合は残しておいた検索結果もいいね数も使わずに取得し直す
+func TestResultCacheNoCache(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("cached", 1, "2024年12月01日 09時00分", 1)
+	s := NewServer(f.config())
+
+	serveAPI(t, s, "/prtimes_posts?keyword=cached")
+	searchCalls, likeCalls := f.searchCalls.Load(), f.likeCalls.Load()
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=cached&nocache=1")
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("X-Cache = %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+	if f.searchCalls.Load() == searchCalls || f.likeCalls.Load() == likeCalls {
+		t.Errorf("nocache did not refetch: searches %d -> %d, likes %d -> %d", searchCalls, f.searchCalls.Load(), likeCalls, f.likeCalls.Load())
+	}
+}
+
+// 検索結果を残さない場合も、いいね数は LikeCountCacheTTL の間リリースごとに残して使う
+func TestLikeCountCache(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("likes", 1, "2024年12月01日 09時00分", 5)
+	cfg := f.config()
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=likes")
+	resp := getResponse(t, s, "/prtimes_posts?keyword=likes")
+	if got := f.likeCalls.Load(); got != 1 {
+		t.Errorf("fetched like counts %d times, want 1", got)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].LikeCount != 5 {
+		t.Errorf("items = %+v, want a like count of 5", resp.Items)
+	}
+	if got := f.searchCalls.Load(); got != 2 {
+		t.Errorf("searched %d times, want 2", got)
+	}
+}
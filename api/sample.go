@@ -0,0 +1,51 @@
+package api
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// samplePages を指定した場合に、結果が一部のページだけのものであることを示す
+type SampleInfo struct {
+	// 取得したページ (昇順)
+	Pages      []int `json:"pages"`
+	TotalPages int   `json:"totalPages"`
+	// 取得したページの割合
+	Fraction float64 `json:"fraction"`
+	// 同じ値を seed に指定すると同じページを選ぶ
+	Seed int64 `json:"seed"`
+}
+
+// 1〜totalPages からk個のページを選ぶ
+func samplePages(totalPages, k int, seed int64) (*SampleInfo, map[int]bool) {
+	rnd := rand.New(rand.NewSource(seed))
+	perm := rnd.Perm(totalPages)[:k]
+	pages := make([]int, k)
+	selected := make(map[int]bool, k)
+	for i, p := range perm {
+		pages[i] = p + 1
+		selected[p+1] = true
+	}
+	sort.Ints(pages)
+	return &SampleInfo{
+		Pages:      pages,
+		TotalPages: totalPages,
+		Fraction:   float64(k) / float64(totalPages),
+		Seed:       seed,
+	}, selected
+}
+
+// samplePages が全ページ数以上の場合に、取得する 1〜fetched ページを返す
+// fetched は MaxCrawlItems で打ち切った後のページ数
+func allPagesSample(fetched, totalPages int, seed int64) *SampleInfo {
+	pages := make([]int, fetched)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	return &SampleInfo{
+		Pages:      pages,
+		TotalPages: totalPages,
+		Fraction:   float64(fetched) / float64(totalPages),
+		Seed:       seed,
+	}
+}
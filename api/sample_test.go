@@ -0,0 +1,68 @@
+package api
+
+import (
+	"slices"
+	"testing"
+)
+
+// 同じ seed なら同じページを選ぶ
+func TestSamplePagesDeterministic(t *testing.T) {
+	first, selected := samplePages(100, 5, 42)
+	second, _ := samplePages(100, 5, 42)
+	if !slices.Equal(first.Pages, second.Pages) {
+		t.Errorf("pages differ for the same seed: %v, %v", first.Pages, second.Pages)
+	}
+	if len(first.Pages) != 5 || !slices.IsSorted(first.Pages) || first.Pages[0] < 1 || first.Pages[4] > 100 {
+		t.Errorf("pages = %v, want 5 sorted pages in 1..100", first.Pages)
+	}
+	for _, page := range first.Pages {
+		if !selected[page] {
+			t.Errorf("page %d is not in the selected set", page)
+		}
+	}
+	if first.Fraction != 0.05 || first.TotalPages != 100 || first.Seed != 42 {
+		t.Errorf("sample = %+v", first)
+	}
+	if other, _ := samplePages(100, 5, 43); slices.Equal(first.Pages, other.Pages) {
+		t.Errorf("a different seed chose the same pages %v", other.Pages)
+	}
+}
+
+func TestSamplePagesParam(t *testing.T) {
+	f := newHugeUpstream(t, 50)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=huge&samplePages=3&seed=7")
+	want, _ := samplePages(50, 3, 7)
+	if resp.Sample == nil || !slices.Equal(resp.Sample.Pages, want.Pages) {
+		t.Fatalf("sample = %+v, want pages %v", resp.Sample, want.Pages)
+	}
+	if resp.Sample.Fraction != 0.06 || resp.Sample.TotalPages != 50 || resp.Sample.Seed != 7 {
+		t.Errorf("sample = %+v", resp.Sample)
+	}
+	// 1ページ目はページ数を知るために必ず取得する
+	wantCalls := int64(3)
+	if !slices.Contains(want.Pages, 1) {
+		wantCalls++
+	}
+	if got := f.searchCalls.Load(); got != wantCalls {
+		t.Errorf("search calls = %d, want %d", got, wantCalls)
+	}
+}
+
+// 全ページ数以上を指定した場合も sample を返す
+func TestSamplePagesCoversAllPages(t *testing.T) {
+	f := newHugeUpstream(t, 2)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=huge&samplePages=5&seed=1")
+	if resp.Sample == nil {
+		t.Fatal("sample is missing")
+	}
+	if !slices.Equal(resp.Sample.Pages, []int{1, 2}) || resp.Sample.TotalPages != 2 || resp.Sample.Fraction != 1 || resp.Sample.Seed != 1 {
+		t.Errorf("sample = %+v", resp.Sample)
+	}
+	if len(resp.Items) != 2*searchPageSize {
+		t.Errorf("got %d items, want %d", len(resp.Items), 2*searchPageSize)
+	}
+}
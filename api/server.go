@@ -0,0 +1,230 @@
+package api
+
+import (
+	"compress/flate"
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Server はAPIの状態を持つ
+type Server struct {
+	cfg Config
+	// PR TIMESへのリクエストで共有するクライアント
+	client *http.Client
+
+	preflightOnce sync.Once
+
+	retryRandMu sync.Mutex
+	retryRand   *rand.Rand
+
+	// 処理中のリクエスト数を制限するセマフォ (nilの場合は無制限)
+	inFlight chan struct{}
+	// 全てのリクエストを合わせてPR TIMESへ同時に送るリクエスト (検索・いいね数) の数を制限するセマフォ (nilの場合は無制限)
+	upstream chan struct{}
+
+	// 結果を返す前に適用するPostProcessor (登録順)
+	postProcessors []PostProcessor
+
+	// いいね数の推移
+	likeHistory *likeHistory
+
+	// 同じリリースのいいね数の同時取得をまとめる
+	likeCountGroup singleflight.Group
+	// 同じURLへの続けての取得をまとめる (DebounceWindow が無効な場合はnil)
+	debounce *debouncer
+
+	// PR TIMESのレート制限
+	rateLimit rateLimiter
+
+	// Prefer: respond-async で受け付けたジョブ
+	jobs *jobStore
+	// snapshotId ごとに並べた結果
+	snapshots *snapshotStore
+	// 検索結果のページやいいね数を残しておく先
+	cache Cache
+	// If-Modified-Since で取得するために残しておく検索結果のページ (ConditionalRequests が無効な場合や PageCacheTTL が0以下の場合はnil)
+	pageCache *pageCache
+
+	// 検索結果の書き込み先 (nilの場合は書き込まない)
+	sink *sinkQueue
+
+	// トレースが無効な場合は何もしないTracer
+	tracer trace.Tracer
+}
+
+// NewServer は設定からServerを作る
+func NewServer(cfg Config) *Server {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	if cfg.PreflightURL == "" {
+		cfg.PreflightURL = cfg.BaseURL + "/"
+	}
+	if len(cfg.DateLayouts) == 0 {
+		cfg.DateLayouts = defaultDateLayouts
+	}
+	if cfg.Compression != "" && !isValidCompression(cfg.Compression) {
+		log.Println("Unknown Compression, responses will not be compressed:", cfg.Compression)
+		cfg.Compression = compressionNone
+	}
+	if !isValidCompressionLevel(cfg.CompressionLevel) {
+		log.Println("Invalid CompressionLevel, using default:", cfg.CompressionLevel)
+		cfg.CompressionLevel = flate.DefaultCompression
+	}
+	if cfg.LikeCountWorkersMax > 0 && cfg.LikeCountWorkersMin > cfg.LikeCountWorkersMax {
+		log.Println("LikeCountWorkersMin is larger than LikeCountWorkersMax, using LikeCountWorkersMax:", cfg.LikeCountWorkersMin)
+		cfg.LikeCountWorkersMin = cfg.LikeCountWorkersMax
+	}
+	if cfg.FreshnessHalfLife <= 0 {
+		log.Println("FreshnessHalfLife must be positive, using default:", cfg.FreshnessHalfLife)
+		cfg.FreshnessHalfLife = DefaultConfig().FreshnessHalfLife
+	}
+	if cfg.DefaultSort == "" {
+		cfg.DefaultSort = sortLikes
+	} else if !isValidSort(cfg.DefaultSort) {
+		log.Println("Unknown DefaultSort, falling back to likes:", cfg.DefaultSort)
+		cfg.DefaultSort = sortLikes
+	}
+
+	s := &Server{
+		cfg:            cfg,
+		client:         newHTTPClient(cfg),
+		retryRand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		postProcessors: cfg.PostProcessors,
+		likeHistory:    newLikeHistory(cfg.SparklinePoints, cfg.MaxCachedKeywords),
+		jobs:           newJobStore(cfg.MaxJobs, cfg.JobTTL),
+		snapshots:      newSnapshotStore(cfg.MaxSnapshots, cfg.SnapshotTTL),
+		tracer:         newTracerProvider(cfg).Tracer(tracerName),
+	}
+	if cfg.ResultSink != nil {
+		s.sink = newSinkQueue(cfg.ResultSink, cfg.ResultSinkBuffer)
+	}
+	s.cache = cfg.Cache
+	if s.cache == nil {
+		s.cache = NewMemoryCache(cfg.MaxCacheEntries)
+	}
+	if cfg.ConditionalRequests && cfg.PageCacheTTL > 0 {
+		s.pageCache = &pageCache{cache: s.cache, ttl: cfg.PageCacheTTL}
+	}
+	if cfg.MaxInFlight > 0 {
+		s.inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.MaxConcurrency > 0 {
+		s.upstream = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	if cfg.DebounceWindow > 0 {
+		s.debounce = newDebouncer(cfg.DebounceWindow)
+	}
+	if cfg.WarmConnections > 0 {
+		go s.warmUp(cfg.WarmConnections)
+	}
+	return s
+}
+
+// 最初のリクエストでTLSハンドシェイクを待たないように、
+// PR TIMESへn本の接続を同時に張ってアイドル状態で残しておく
+func (s *Server) warmUp(n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.client.Head(s.cfg.BaseURL + "/")
+			if err != nil {
+				log.Println("Error warming up connection:", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+// Preflightが有効な場合はCookieJarを持たせ、最初のリクエスト前に
+// トップページへアクセスしてセッションCookie等を取得しておく
+func newHTTPClient(cfg Config) *http.Client {
+	client := &http.Client{}
+	if cfg.HTTPTimeout > 0 {
+		client.Timeout = cfg.HTTPTimeout
+	}
+	// 温めた接続がアイドル上限で捨てられないようにする
+	if cfg.WarmConnections > http.DefaultMaxIdleConnsPerHost {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = cfg.WarmConnections
+		client.Transport = transport
+	}
+	if !cfg.Preflight {
+		return client
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		log.Println("Error creating cookie jar:", err)
+		return client
+	}
+	client.Jar = jar
+	return client
+}
+
+func (s *Server) logDebug(v ...any) {
+	if s.cfg.DebugLog {
+		log.Println(v...)
+	}
+}
+
+// クライアントの切断やタイムアウトで失敗したものはデバッグログにする
+func (s *Server) logFetchError(ctx context.Context, v ...any) {
+	if ctx.Err() != nil {
+		s.logDebug(v...)
+		return
+	}
+	log.Println(v...)
+}
+
+// Router はAPIのルーティングを設定したServeMuxを返す
+func (s *Server) Router() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/prtimes_posts", s.traced("GET /prtimes_posts", s.compress(s.rejectUnknownParams(postsParams, s.limitInFlight(s.respondAsync(http.HandlerFunc(s.handlePRTimesPosts)))))))
+	mux.Handle("/prtimes_posts/diff", s.traced("GET /prtimes_posts/diff", s.compress(s.rejectUnknownParams(diffParams, s.limitInFlight(s.respondAsync(http.HandlerFunc(s.handlePRTimesPostsDiff)))))))
+	mux.Handle("/release", s.traced("GET /release", s.compress(s.rejectUnknownParams(releaseParams, s.limitInFlight(http.HandlerFunc(s.handleRelease))))))
+	mux.HandleFunc("/jobs/{id}", s.handleJob)
+	mux.Handle("/jobs/{id}/result", s.compress(http.HandlerFunc(s.handleJobResult)))
+	mux.HandleFunc("/admin/cache/flush", s.handleCacheFlush)
+	return mux
+}
+
+// 処理中のリクエストが上限に達している場合は503を返す
+// ヘルスチェック等の軽いエンドポイントには使わない
+func (s *Server) limitInFlight(next http.Handler) http.Handler {
+	if s.inFlight == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case s.inFlight <- struct{}{}:
+			defer func() { <-s.inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests in flight", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// NewRouter は設定からAPIのルーティングを設定したServeMuxを返す
+func NewRouter(cfg Config) *http.ServeMux {
+	return NewServer(cfg).Router()
+}
+
+// NewHandler は設定からAPIのhttp.Handlerを返す
+// 他のサーバーに組み込む場合は http.StripPrefix と組み合わせてマウントする
+func NewHandler(cfg Config) http.Handler {
+	return NewRouter(cfg)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 他のサーバーのServeMuxにサブパスでマウントして使える
+func TestNewHandlerMountedUnderSubPath(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("embed", 1, "2024年12月01日 09時00分", 7)
+
+	mux := http.NewServeMux()
+	mux.Handle("/prtimes/", http.StripPrefix("/prtimes", NewHandler(f.config())))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/prtimes/prtimes_posts?keyword=embed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", res.StatusCode)
+	}
+	var resp Response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].LikeCount != 7 {
+		t.Errorf("unexpected items %+v", resp.Items)
+	}
+
+	res, err = http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("healthz status %d, want 204", res.StatusCode)
+	}
+}
+
+// 別々に作ったハンドラーは状態を共有しない
+func TestNewHandlersAreIndependent(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("embed", 1, "2024年12月01日 09時00分", 7)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		NewHandler(f.config()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=embed", nil))
+		if got := rec.Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("handler %d: X-Cache = %q, want MISS", i, got)
+		}
+	}
+}
+
+// 処理中のリクエストが MaxInFlight に達している場合は503と Retry-After を返す
+func TestMaxInFlight(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("busy", 1, "2024年12月01日 09時00分", 1)
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/keyword_search.php/search" {
+			entered <- struct{}{}
+			<-unblock
+		}
+		return false
+	}
+	cfg := f.config()
+	cfg.MaxInFlight = 1
+	s := NewServer(cfg)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveAPI(t, s, "/prtimes_posts?keyword=busy")
+	}()
+	<-entered
+
+	rec := serveAPI(t, s, "/prtimes_posts?keyword=busy")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is missing")
+	}
+
+	close(unblock)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("first request: status %d, want 200", rec.Code)
+	}
+}
+
+// WarmConnections の数だけPR TIMESへ同時に接続を張る
+func TestWarmConnections(t *testing.T) {
+	const n = 3
+	var mu sync.Mutex
+	conns := 0
+	arrived := make(chan struct{}, n)
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			arrived <- struct{}{}
+			// 全ての接続が揃うまで返さない (返すと接続が使い回される)
+			<-release
+		}
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.WarmConnections = n
+	NewServer(cfg)
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d warm-up requests arrived, want %d", i, n)
+		}
+	}
+	close(release)
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != n {
+		t.Errorf("opened %d connections, want %d", conns, n)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CrawlRecord は1回の検索で取得した結果
+type CrawlRecord struct {
+	Keyword   string         `json:"keyword"`
+	FetchedAt time.Time      `json:"fetchedAt"`
+	Items     []ResponseItem `json:"items"`
+}
+
+// ResultSink は検索結果の書き込み先
+// レスポンスとは別のgoroutineから1件ずつ順に呼ばれる
+type ResultSink interface {
+	Write(record CrawlRecord) error
+}
+
+// 1行に1件のJSONで書き込む
+type jsonLinesSink struct {
+	w io.Writer
+}
+
+// NewJSONLinesSink はwへ1行に1件のJSONで書き込むResultSinkを返す
+func NewJSONLinesSink(w io.Writer) ResultSink {
+	return &jsonLinesSink{w: w}
+}
+
+func (s *jsonLinesSink) Write(record CrawlRecord) error {
+	return json.NewEncoder(s.w).Encode(record)
+}
+
+// ディレクトリに日付ごとのファイル (results-2024-12-14.jsonl) を作って書き込む
+type dailyFileSink struct {
+	dir  string
+	date string
+	file *os.File
+}
+
+// NewDailyFileSink はdirに日付 (JST) ごとのJSONLファイルを作って書き込むResultSinkを返す
+func NewDailyFileSink(dir string) ResultSink {
+	return &dailyFileSink{dir: dir}
+}
+
+func (s *dailyFileSink) Write(record CrawlRecord) error {
+	date := record.FetchedAt.In(jst).Format("2006-01-02")
+	if s.file == nil || date != s.date {
+		if s.file != nil {
+			s.file.Close()
+			s.file = nil
+		}
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(s.dir, "results-"+date+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = f
+		s.date = date
+	}
+	return json.NewEncoder(s.file).Encode(record)
+}
+
+// PRTIMES_RESULT_SINK の値からResultSinkを作る
+// stdout または file:<ディレクトリ>
+func parseResultSink(v string) (ResultSink, bool) {
+	if v == "stdout" {
+		return NewJSONLinesSink(os.Stdout), true
+	}
+	if dir, ok := strings.CutPrefix(v, "file:"); ok && dir != "" {
+		return NewDailyFileSink(dir), true
+	}
+	return nil, false
+}
+
+// 書き込み待ちの結果を溜めておき、1つのgoroutineで順に書き込む
+// 書き込みが追いつかずに溜まりきった場合はレスポンスを待たせずに捨てる
+type sinkQueue struct {
+	sink    ResultSink
+	records chan CrawlRecord
+	// 書き込み用のgoroutineは最初の結果が来た時に起動する
+	startOnce sync.Once
+}
+
+func newSinkQueue(sink ResultSink, size int) *sinkQueue {
+	return &sinkQueue{sink: sink, records: make(chan CrawlRecord, max(size, 1))}
+}
+
+func (q *sinkQueue) send(record CrawlRecord) {
+	q.startOnce.Do(func() { go q.run() })
+	select {
+	case q.records <- record:
+	default:
+		log.Println("Result sink is full, dropping results for keyword:", record.Keyword)
+	}
+}
+
+func (q *sinkQueue) run() {
+	for record := range q.records {
+		if err := q.sink.Write(record); err != nil {
+			log.Println("Error writing results to sink:", err)
+		}
+	}
+}
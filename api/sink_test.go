@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 書き込まれた結果を取っておくResultSink
+type memorySink struct {
+	records chan CrawlRecord
+}
+
+func (s *memorySink) Write(record CrawlRecord) error {
+	s.records <- record
+	return nil
+}
+
+// 検索が終わった後で結果がResultSinkへ書き込まれる
+func TestResultSinkReceivesCrawl(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("dataset", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("dataset", 2, "2024年12月02日 09時00分", 5)
+	sink := &memorySink{records: make(chan CrawlRecord, 10)}
+	cfg := f.config()
+	cfg.ResultSink = sink
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=dataset")
+	select {
+	case record := <-sink.records:
+		if record.Keyword != "dataset" || len(record.Items) != 2 || record.FetchedAt.IsZero() {
+			t.Errorf("unexpected record %+v", record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the result was not written to the sink")
+	}
+}
+
+// 書き込みが詰まっていてもレスポンスを待たせず、溢れた分は捨てる
+func TestSinkQueueDropsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	sink := &memorySink{records: make(chan CrawlRecord)}
+	q := newSinkQueue(sink, 1)
+	captureLog(t)
+	go func() {
+		<-block
+		for range sink.records {
+		}
+	}()
+	defer close(block)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			q.send(CrawlRecord{Keyword: "full"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked on a full sink")
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	for _, keyword := range []string{"a", "b"} {
+		if err := sink.Write(CrawlRecord{Keyword: keyword}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var record CrawlRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record.Keyword != "b" {
+		t.Errorf("second line = %q (%v)", lines[1], err)
+	}
+}
+
+// JSTの日付が変わったら別のファイルに書き込む
+func TestDailyFileSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewDailyFileSink(dir)
+	writes := []CrawlRecord{
+		{Keyword: "a", FetchedAt: time.Date(2024, 12, 14, 14, 59, 0, 0, time.UTC)}, // 2024-12-14 23:59 JST
+		{Keyword: "b", FetchedAt: time.Date(2024, 12, 14, 15, 0, 0, 0, time.UTC)},  // 2024-12-15 00:00 JST
+		{Keyword: "c", FetchedAt: time.Date(2024, 12, 15, 9, 0, 0, 0, jst)},
+	}
+	for _, record := range writes {
+		if err := sink.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]int{"results-2024-12-14.jsonl": 1, "results-2024-12-15.jsonl": 2} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("%s has %d lines, want %d", file, got, want)
+		}
+	}
+}
+
+func TestParseResultSink(t *testing.T) {
+	for v, ok := range map[string]bool{"stdout": true, "file:/tmp/results": true, "file:": false, "s3://bucket": false} {
+		if _, got := parseResultSink(v); got != ok {
+			t.Errorf("parseResultSink(%q) ok = %v, want %v", v, got, ok)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// snapshotId の長さの上限
+const maxSnapshotIDLength = 128
+
+// snapshotId を指定した最初のリクエストで並べた結果 (offset と limit で切る前の全件)
+type snapshot struct {
+	keyword             string
+	items               []ResponseItem
+	totalLikes          int
+	matchedBeforeFilter int
+	completeness        float64
+	createdAt           time.Time
+}
+
+// 数を制限し、作ってから ttl が過ぎたものを捨てる
+type snapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	max       int
+	ttl       time.Duration
+}
+
+func newSnapshotStore(max int, ttl time.Duration) *snapshotStore {
+	return &snapshotStore{snapshots: make(map[string]*snapshot), max: max, ttl: ttl}
+}
+
+func (st *snapshotStore) get(id string) (*snapshot, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire()
+	snap, ok := st.snapshots[id]
+	return snap, ok
+}
+
+// 上限に達している場合は最も古いものを捨てる
+func (st *snapshotStore) put(id string, snap *snapshot) {
+	if st.max <= 0 {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire()
+	if _, ok := st.snapshots[id]; !ok && len(st.snapshots) >= st.max {
+		oldestID := ""
+		for id, s := range st.snapshots {
+			if oldestID == "" || s.createdAt.Before(st.snapshots[oldestID].createdAt) {
+				oldestID = id
+			}
+		}
+		delete(st.snapshots, oldestID)
+	}
+	st.snapshots[id] = snap
+}
+
+// mu を持った状態で呼ぶ
+func (st *snapshotStore) expire() {
+	for id, snap := range st.snapshots {
+		if time.Since(snap.createdAt) > st.ttl {
+			delete(st.snapshots, id)
+		}
+	}
+}
+
+// 保存しておいた順番のまま offset と limit で切り出して返す
+func writeSnapshotPage(w http.ResponseWriter, r *http.Request, id string, snap *snapshot, offset, limit int, apiVersion string, start time.Time) {
+	items := offsetItems(offset)(snap.items)
+	if limit > 0 {
+		items = limitItems(limit)(items)
+	}
+	// 保存してある分を書き換えないようにコピーする
+	items = append([]ResponseItem{}, items...)
+	setPaginationLinks(w, r, offset, limit, len(snap.items))
+
+	if apiVersion == apiVersionV1 {
+		writeJSON(w, items)
+		return
+	}
+	resp := Response{
+		APIVersion:          apiVersion,
+		Keyword:             snap.keyword,
+		Items:               items,
+		TotalLikes:          snap.totalLikes,
+		MatchedBeforeFilter: snap.matchedBeforeFilter,
+		Completeness:        snap.completeness,
+		SnapshotID:          id,
+		ServerProcessingMs:  time.Since(start).Milliseconds(),
+	}
+	if r.URL.Query().Get("bigIntAsString") == "true" {
+		writeJSONBigIntAsString(w, resp)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// 前回からの順位の変化
+const (
+	rankUp   = "up"
+	rankDown = "down"
+	rankSame = "same"
+	rankNew  = "new"
+)
+
+// RankChange は compareSnapshot で指定した前回の結果からの順位の変化
+type RankChange struct {
+	// up, down, same, new
+	Status string `json:"status"`
+	// 前回の順位 (1始まり。new の場合は含めない)
+	PreviousRank int `json:"previousRank,omitempty"`
+	// 上がった順位の数 (下がった場合は負)
+	Change int `json:"change"`
+}
+
+// DroppedItem は前回の結果にあって今回の結果に無いリリース
+type DroppedItem struct {
+	PostURL      string `json:"postUrl"`
+	Title        string `json:"title"`
+	PreviousRank int    `json:"previousRank"`
+}
+
+// items の順位を前回の結果 previous と比べて RankChange を付ける (どちらも offset と limit で切る前の全件)
+// リリースは PostURL で同じものとみなす
+// 前回あって今回無いものを前回の順に返す
+func compareRanks(items, previous []ResponseItem) []DroppedItem {
+	previousRanks := make(map[string]int, len(previous))
+	for i, item := range previous {
+		if _, ok := previousRanks[item.PostURL]; !ok {
+			previousRanks[item.PostURL] = i + 1
+		}
+	}
+	current := make(map[string]bool, len(items))
+	for i := range items {
+		rank := i + 1
+		current[items[i].PostURL] = true
+		prev, ok := previousRanks[items[i].PostURL]
+		change := &RankChange{Status: rankNew}
+		if ok {
+			change = &RankChange{Status: rankSame, PreviousRank: prev, Change: prev - rank}
+			if rank < prev {
+				change.Status = rankUp
+			} else if rank > prev {
+				change.Status = rankDown
+			}
+		}
+		items[i].RankChange = change
+	}
+
+	var dropped []DroppedItem
+	for i, item := range previous {
+		if !current[item.PostURL] && previousRanks[item.PostURL] == i+1 {
+			dropped = append(dropped, DroppedItem{PostURL: item.PostURL, Title: item.Title, PreviousRank: i + 1})
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotId を指定したページングでは、いいね数が変わっても最初に並べた順番のまま返す
+func TestSnapshotPagingKeepsOrder(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 6; n++ {
+		f.addRelease("AI", n, "2024年12月01日 10時00分", n*10)
+	}
+	cfg := f.config()
+	// 取得し直した場合に順番が変わるように、キャッシュは使わない
+	cfg.LikeCountCacheTTL = 0
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+
+	titles := func(resp Response) []string {
+		var got []string
+		for _, item := range resp.Items {
+			got = append(got, item.Title)
+		}
+		return got
+	}
+
+	first := getResponse(t, s, "/prtimes_posts?keyword=AI&snapshotId=s1&limit=2")
+	if first.SnapshotID != "s1" {
+		t.Errorf("snapshotId = %q", first.SnapshotID)
+	}
+	searchCalls := f.searchCalls.Load()
+
+	// 並びが逆になるようにいいね数を変える
+	f.mu.Lock()
+	for n := 1; n <= 6; n++ {
+		f.likes[fakeReleaseID(n)] = 100 - n*10
+	}
+	f.mu.Unlock()
+
+	got := titles(first)
+	for _, offset := range []string{"2", "4"} {
+		got = append(got, titles(getResponse(t, s, "/prtimes_posts?keyword=AI&snapshotId=s1&limit=2&offset="+offset))...)
+	}
+	want := []string{"リリース6", "リリース5", "リリース4", "リリース3", "リリース2", "リリース1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged titles = %v, want %v", got, want)
+	}
+	if calls := f.searchCalls.Load(); calls != searchCalls {
+		t.Errorf("searched %d more times while paging a snapshot", calls-searchCalls)
+	}
+
+	// snapshotId が無ければ取得し直して並べ直す
+	if got := titles(getResponse(t, s, "/prtimes_posts?keyword=AI&limit=2")); !slices.Equal(got, []string{"リリース1", "リリース2"}) {
+		t.Errorf("titles without snapshotId = %v", got)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("AI", 1, "2024年12月01日 10時00分", 5)
+	s := NewServer(f.config())
+	getResponse(t, s, "/prtimes_posts?keyword=AI&snapshotId=s1")
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/prtimes_posts?keyword=IoT&snapshotId=s1", http.StatusConflict},
+		{"/prtimes_posts?keyword=AI&snapshotId=s1&format=csv", http.StatusBadRequest},
+		{"/prtimes_posts?keyword=AI&snapshotId=" + strings.Repeat("x", maxSnapshotIDLength+1), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serveAPI(t, s, tt.target); rec.Code != tt.want {
+			t.Errorf("GET %s: status %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+}
+
+// 上限を超えた場合は最も古いものを、ttl を過ぎたものは取り出す時に捨てる
+func TestSnapshotStoreBounds(t *testing.T) {
+	st := newSnapshotStore(2, time.Hour)
+	now := time.Now()
+	st.put("a", &snapshot{createdAt: now.Add(-2 * time.Minute)})
+	st.put("b", &snapshot{createdAt: now.Add(-time.Minute)})
+	st.put("c", &snapshot{createdAt: now})
+	if _, ok := st.get("a"); ok {
+		t.Error("the oldest snapshot was not evicted")
+	}
+	for _, id := range []string{"b", "c"} {
+		if _, ok := st.get(id); !ok {
+			t.Errorf("snapshot %q was evicted", id)
+		}
+	}
+
+	st = newSnapshotStore(2, time.Minute)
+	st.put("old", &snapshot{createdAt: now.Add(-2 * time.Minute)})
+	if _, ok := st.get("old"); ok {
+		t.Error("an expired snapshot was returned")
+	}
+}
+
+func TestCompareRanks(t *testing.T) {
+	previous := []ResponseItem{{PostURL: "a", Title: "A"}, {PostURL: "b", Title: "B"}, {PostURL: "c", Title: "C"}, {PostURL: "d", Title: "D"}}
+	items := []ResponseItem{{PostURL: "c"}, {PostURL: "a"}, {PostURL: "e"}, {PostURL: "d"}}
+
+	dropped := compareRanks(items, previous)
+	want := []RankChange{
+		{Status: rankUp, PreviousRank: 3, Change: 2},
+		{Status: rankDown, PreviousRank: 1, Change: -1},
+		{Status: rankNew},
+		{Status: rankSame, PreviousRank: 4},
+	}
+	for i := range items {
+		if items[i].RankChange == nil || *items[i].RankChange != want[i] {
+			t.Errorf("%s: rankChange = %+v, want %+v", items[i].PostURL, items[i].RankChange, want[i])
+		}
+	}
+	if !slices.Equal(dropped, []DroppedItem{{PostURL: "b", Title: "B", PreviousRank: 2}}) {
+		t.Errorf("dropped = %+v", dropped)
+	}
+}
+
+// compareSnapshot を指定した場合は、保存しておいた結果からの順位の変化を返す
+func TestCompareSnapshotParam(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("movers", n, "2024年12月01日 10時00分", 40-n*10)
+	}
+	cfg := f.config()
+	cfg.LikeCountCacheTTL = 0
+	cfg.ResultCacheTTL = 0
+	s := NewServer(cfg)
+	// リリース1, 2, 3 の順
+	getResponse(t, s, "/prtimes_posts?keyword=movers&snapshotId=before")
+
+	// リリース3が上がり、リリース2が無くなり、リリース4が増える
+	f.mu.Lock()
+	f.releases["movers"] = slices.DeleteFunc(f.releases["movers"], func(r Release) bool { return r.ReleaseURL == fakeReleaseURL(2) })
+	f.likes[fakeReleaseID(3)] = 100
+	f.mu.Unlock()
+	f.addRelease("movers", 4, "2024年12月01日 10時00分", 5)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=movers&compareSnapshot=before")
+	want := map[string]RankChange{
+		"リリース3": {Status: rankUp, PreviousRank: 3, Change: 2},
+		"リリース1": {Status: rankDown, PreviousRank: 1, Change: -1},
+		"リリース4": {Status: rankNew},
+	}
+	if len(resp.Items) != len(want) {
+		t.Fatalf("got %d items", len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		if item.RankChange == nil || *item.RankChange != want[item.Title] {
+			t.Errorf("%s: rankChange = %+v, want %+v", item.Title, item.RankChange, want[item.Title])
+		}
+	}
+	if len(resp.DroppedItems) != 1 || resp.DroppedItems[0].Title != "リリース2" || resp.DroppedItems[0].PreviousRank != 2 {
+		t.Errorf("droppedItems = %+v", resp.DroppedItems)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/prtimes_posts?keyword=movers&compareSnapshot=missing", http.StatusNotFound},
+		{"/prtimes_posts?keyword=other&compareSnapshot=before", http.StatusConflict},
+		{"/prtimes_posts?keyword=movers&compareSnapshot=before&mode=ids", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serveAPI(t, s, tt.target); rec.Code != tt.want {
+			t.Errorf("GET %s: status %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// RequestTimeout のうち SoftTimeoutFraction が過ぎた時刻 (設定されていない場合はゼロ)
+// これを過ぎたらいいね数の取得をやめ、取得できた分だけで日付順にして返す
+func (s *Server) likeDeadline(start time.Time) time.Time {
+	fraction := s.cfg.SoftTimeoutFraction
+	if s.cfg.RequestTimeout <= 0 || fraction <= 0 || fraction >= 1 {
+		return time.Time{}
+	}
+	return start.Add(time.Duration(float64(s.cfg.RequestTimeout) * fraction))
+}
+
+// opts.likeDeadline までに fetch でいいね数を取得する
+// ソフトタイムアウトで取得を打ち切った場合は false を返す (リクエスト全体のタイムアウトや切断の場合は true)
+func fetchLikeCountsWithin(ctx context.Context, opts crawlOptions, fetch func(ctx context.Context)) bool {
+	if opts.likeDeadline.IsZero() {
+		fetch(ctx)
+		return true
+	}
+	likeCtx, cancel := context.WithDeadline(ctx, opts.likeDeadline)
+	defer cancel()
+	fetch(likeCtx)
+	return likeCtx.Err() != context.DeadlineExceeded || ctx.Err() != nil
+}
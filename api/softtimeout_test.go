@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SoftTimeoutFraction が過ぎたらいいね数の取得をやめ、全件を日付順にして warnings で知らせる
+func TestSoftTimeoutSortsByDate(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("soft", 1, "2024年12月01日 09時00分", 100)
+	f.addRelease("soft", 2, "2024年12月02日 09時00分", 50)
+	f.addRelease("soft", 3, "2024年12月03日 09時00分", 1)
+	// 1件目以外のいいね数は、リクエストが終わるまで返さない
+	f.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/like_count") || strings.Contains(r.URL.Path, fakeReleaseID(1)) {
+			return false
+		}
+		<-r.Context().Done()
+		return true
+	}
+	cfg := f.config()
+	cfg.RequestTimeout = time.Second
+	cfg.SoftTimeoutFraction = 0.1
+	s := NewServer(cfg)
+	logs := captureLog(t)
+
+	start := time.Now()
+	resp := getResponse(t, s, "/prtimes_posts?keyword=soft")
+	if elapsed := time.Since(start); elapsed >= cfg.RequestTimeout {
+		t.Errorf("took %v, want less than the request timeout", elapsed)
+	}
+	var titles []string
+	for _, item := range resp.Items {
+		titles = append(titles, item.Title)
+	}
+	if want := []string{"リリース3", "リリース2", "リリース1"}; !slices.Equal(titles, want) {
+		t.Errorf("titles = %v, want %v sorted by date", titles, want)
+	}
+	if !slices.ContainsFunc(resp.Warnings, func(w string) bool { return strings.Contains(w, "soft timeout") }) {
+		t.Errorf("warnings = %v", resp.Warnings)
+	}
+	if !strings.Contains(logs.String(), "Soft timeout reached") {
+		t.Errorf("the soft timeout was not logged: %q", logs.String())
+	}
+}
+
+// いいね数が間に合った場合はいつも通りいいね数で並べる
+func TestSoftTimeoutNotReached(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("soft", 1, "2024年12月01日 09時00分", 100)
+	f.addRelease("soft", 2, "2024年12月02日 09時00分", 1)
+	cfg := f.config()
+	cfg.RequestTimeout = 10 * time.Second
+	cfg.SoftTimeoutFraction = 0.5
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=soft")
+	if len(resp.Items) != 2 || resp.Items[0].Title != "リリース1" || len(resp.Warnings) != 0 {
+		t.Errorf("items = %+v, warnings = %v", resp.Items, resp.Warnings)
+	}
+}
+
+func TestLikeDeadline(t *testing.T) {
+	start := time.Date(2024, 12, 1, 9, 0, 0, 0, jst)
+	tests := []struct {
+		timeout  time.Duration
+		fraction float64
+		want     time.Time
+	}{
+		{10 * time.Second, 0.8, start.Add(8 * time.Second)},
+		{10 * time.Second, 0, time.Time{}},
+		{10 * time.Second, 1, time.Time{}},
+		{0, 0.8, time.Time{}},
+	}
+	for _, tt := range tests {
+		s := &Server{cfg: Config{RequestTimeout: tt.timeout, SoftTimeoutFraction: tt.fraction}}
+		if got := s.likeDeadline(start); !got.Equal(tt.want) {
+			t.Errorf("likeDeadline with %v * %v = %v, want %v", tt.timeout, tt.fraction, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// mode=ids の結果をページの取得が終わるたびにJSON配列の要素として書き出す
+// 書き出す内容はまとめて返す場合と同じバイト列になる
+type idStreamer struct {
+	w             http.ResponseWriter
+	thumbnailHost string
+	limit         int
+
+	written int
+	started bool
+}
+
+func newIDStreamer(w http.ResponseWriter, thumbnailHost string, limit int) *idStreamer {
+	return &idStreamer{w: w, thumbnailHost: thumbnailHost, limit: limit}
+}
+
+func (st *idStreamer) writePage(items []ResponseItem) {
+	if st.thumbnailHost != "" {
+		items = filterByThumbnailHost(items, st.thumbnailHost)
+	}
+	for _, item := range items {
+		if st.limit > 0 && st.written >= st.limit {
+			break
+		}
+		b, err := json.Marshal(ReleaseIDItem{ID: item.ReleaseID, PostURL: item.PostURL})
+		if err != nil {
+			log.Println("Error encoding response:", err)
+			continue
+		}
+		if st.started {
+			st.write([]byte(","))
+		} else {
+			st.start()
+		}
+		st.write(b)
+		st.written++
+	}
+	if f, ok := st.w.(http.Flusher); ok && st.started {
+		f.Flush()
+	}
+}
+
+func (st *idStreamer) start() {
+	st.w.Header().Set("Content-Type", "application/json")
+	st.write([]byte("["))
+	st.started = true
+}
+
+// json.Encoder と同じく末尾に改行を付けて閉じる
+func (st *idStreamer) close() {
+	if !st.started {
+		st.start()
+	}
+	st.write([]byte("]\n"))
+}
+
+func (st *idStreamer) write(b []byte) {
+	if _, err := st.w.Write(b); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 画像のヘッダーを読むのに十分なバイト数
+const thumbnailHeaderBytes = 64 * 1024
+
+// サムネイルの先頭だけを取得して幅と高さを入れる
+// 取得できなかった項目は0のまま (出力されない)
+func (s *Server) fillThumbnailSizes(ctx context.Context, items []ResponseItem) {
+	sem := make(chan struct{}, max(s.cfg.ThumbnailConcurrency, 1))
+	var wg sync.WaitGroup
+	for i := range items {
+		if items[i].ThumbnailURL == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(item *ResponseItem) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			width, height, err := s.fetchImageSize(ctx, item.ThumbnailURL)
+			if err != nil {
+				s.logFetchError(ctx, "Error fetching thumbnail size for", item.ThumbnailURL, ":", err)
+				return
+			}
+			item.ThumbnailWidth = width
+			item.ThumbnailHeight = height
+		}(&items[i])
+	}
+	wg.Wait()
+}
+
+func (s *Server) fetchImageSize(ctx context.Context, imageURL string) (int, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Rangeに対応していないサーバーでも先頭だけ読んで切る
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", thumbnailHeaderBytes-1))
+	// PR TIMESへのリクエストと同じく、同時に送る数とレート制限の内側で送る
+	resp, err := s.do(ctx, req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	cfg, _, err := image.DecodeConfig(io.LimitReader(resp.Body, thumbnailHeaderBytes))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// enrichThumbnails=true の場合はサムネイルの先頭を取得して幅と高さを入れる
+func TestEnrichThumbnails(t *testing.T) {
+	img := pngBytes(t, 640, 360)
+	var ranged atomic.Int64
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	}))
+	defer images.Close()
+
+	f := newFakeUpstream(t)
+	for n := 1; n <= 3; n++ {
+		f.addRelease("thumb", n, "2024年12月01日 09時00分", n)
+	}
+	f.setThumbnail("thumb", 1, images.URL+"/a.png")
+	f.setThumbnail("thumb", 2, images.URL+"/missing.png")
+	s := NewServer(f.config())
+	captureLog(t)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=thumb&enrichThumbnails=true")
+	for _, item := range resp.Items {
+		wantWidth, wantHeight := 0, 0
+		if item.Title == "リリース1" {
+			wantWidth, wantHeight = 640, 360
+		}
+		if item.ThumbnailWidth != wantWidth || item.ThumbnailHeight != wantHeight {
+			t.Errorf("%s: %dx%d, want %dx%d", item.Title, item.ThumbnailWidth, item.ThumbnailHeight, wantWidth, wantHeight)
+		}
+	}
+	if got := ranged.Load(); got != 2 {
+		t.Errorf("%d thumbnail requests had a Range header, want 2", got)
+	}
+}
+
+// サムネイルの取得も MaxConcurrency の内側で送る
+func TestThumbnailFetchUsesUpstreamLimit(t *testing.T) {
+	img := pngBytes(t, 10, 10)
+	var inFlight, peak atomic.Int64
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write(img)
+	}))
+	defer images.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxConcurrency = 2
+	cfg.ThumbnailConcurrency = 8
+	s := NewServer(cfg)
+	items := make([]ResponseItem, 8)
+	for i := range items {
+		items[i].ThumbnailURL = images.URL + "/a.png"
+	}
+	s.fillThumbnailSizes(context.Background(), items)
+
+	for _, item := range items {
+		if item.ThumbnailWidth != 10 {
+			t.Fatalf("thumbnail size was not filled: %+v", item)
+		}
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("%d thumbnails were fetched at once, want at most MaxConcurrency (2)", got)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// 上位N件を決めるためのいいね数取得で、一度に取得する数
+const topNWaveSize = 10
+
+// 前回取得したいいね数から、今のいいね数の上限を見積もる
+// いいね数は短い間に前回の1.5倍 (少なくとも+10) を超えて増えることはほぼ無いとみなす
+// 見積もりを超えて伸びたリリースは上位N件から漏れることがあるので、厳密な結果ではない
+func likeCountUpperBound(prior int) int {
+	return prior + max(prior/2, 10)
+}
+
+// limit件の上位が確定した時点で残りのいいね数の取得をやめる
+// 前回のいいね数が分かっているリリースは上限の見積もりが大きい順に、分からないものは最初に取得し、
+// まだ取得していないリリースの上限の見積もりが全て取得済みのN番目のいいね数を下回ったら打ち切る
+// 打ち切ったリリースのいいね数は前回の値 (cached) になる
+func (s *Server) fetchLikeCountsTopN(ctx context.Context, items []ResponseItem, n int) {
+	type candidate struct {
+		item  *ResponseItem
+		prior int
+		known bool
+	}
+
+	var candidates []candidate
+	for i := range items {
+		item := &items[i]
+		if item.ReleaseID == "" {
+			item.LikeCountStatus = likeCountStatusUnavailable
+			continue
+		}
+		c := candidate{item: item}
+		if samples := s.likeHistory.get(item.ReleaseID); len(samples) > 0 {
+			c.prior = samples[len(samples)-1].LikeCount
+			c.known = true
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].known != candidates[j].known {
+			return !candidates[i].known
+		}
+		return candidates[i].prior > candidates[j].prior
+	})
+
+	var fetched []int
+	for start := 0; start < len(candidates); start += topNWaveSize {
+		next := candidates[start]
+		if next.known && len(fetched) >= n {
+			sort.Sort(sort.Reverse(sort.IntSlice(fetched)))
+			if likeCountUpperBound(next.prior) < fetched[n-1] {
+				for _, c := range candidates[start:] {
+					c.item.LikeCount = c.prior
+					c.item.LikeCountStatus = likeCountStatusCached
+				}
+				if d := diagnosticsFrom(ctx); d != nil {
+					d.cacheHits.Add(int64(len(candidates) - start))
+				}
+				return
+			}
+		}
+
+		wave := candidates[start:min(start+topNWaveSize, len(candidates))]
+		var wg sync.WaitGroup
+		for _, c := range wave {
+			wg.Add(1)
+			go func(item *ResponseItem) {
+				defer wg.Done()
+				s.fillLikeCount(ctx, item)
+			}(c.item)
+		}
+		wg.Wait()
+		for _, c := range wave {
+			fetched = append(fetched, c.item.LikeCount)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLikeCountUpperBound(t *testing.T) {
+	for prior, want := range map[int]int{0: 10, 10: 20, 100: 150, 1001: 1501} {
+		if got := likeCountUpperBound(prior); got != want {
+			t.Errorf("likeCountUpperBound(%d) = %d, want %d", prior, got, want)
+		}
+	}
+}
+
+// 前回のいいね数から残りが上位に入らないと分かった時点で、残りのいいね数を取得しない
+func TestTopNShortCircuit(t *testing.T) {
+	f := newFakeUpstream(t)
+	const total = 30
+	for n := 1; n <= total; n++ {
+		likes := 1
+		if n <= 3 {
+			likes = 1000 + n
+		}
+		f.addRelease("topn", n, "2024年12月01日 09時00分", likes)
+	}
+	cfg := f.config()
+	cfg.TopNShortCircuit = true
+	s := NewServer(cfg)
+	// 前回取得したいいね数
+	for n := 1; n <= total; n++ {
+		prior := 1
+		if n <= 3 {
+			prior = 1000
+		}
+		s.likeHistory.record(fakeReleaseID(n), prior, time.Now().Add(-time.Hour))
+	}
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=topn&limit=3&debug=true")
+	if got := f.likeCalls.Load(); got != topNWaveSize {
+		t.Errorf("like count calls = %d, want %d", got, topNWaveSize)
+	}
+	if got := likeCounts(resp.Items); len(got) != 3 || got[0] != 1003 || got[1] != 1002 || got[2] != 1001 {
+		t.Errorf("likes = %v, want [1003 1002 1001]", got)
+	}
+	for _, item := range resp.Items {
+		if item.LikeCountStatus != likeCountStatusOK {
+			t.Errorf("%s: likeCountStatus = %q, want ok", item.Title, item.LikeCountStatus)
+		}
+	}
+}
+
+// 前回のいいね数が分からないリリースは全て取得する
+func TestTopNShortCircuitWithoutHistory(t *testing.T) {
+	f := newFakeUpstream(t)
+	for n := 1; n <= 30; n++ {
+		f.addRelease("topn", n, "2024年12月01日 09時00分", n)
+	}
+	cfg := f.config()
+	cfg.TopNShortCircuit = true
+	s := NewServer(cfg)
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=topn&limit=3")
+	if got := f.likeCalls.Load(); got != 30 {
+		t.Errorf("like count calls = %d, want 30", got)
+	}
+	if got := likeCounts(resp.Items); len(got) != 3 || got[0] != 30 {
+		t.Errorf("likes = %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// リクエストごとのspanと、その子として検索といいね数の取得のspanを作る
+func TestTracingSpans(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("trace", 1, "2024年12月01日 09時00分", 1)
+	f.addRelease("trace", 2, "2024年12月01日 09時00分", 2)
+	recorder := tracetest.NewSpanRecorder()
+	cfg := f.config()
+	cfg.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	s := NewServer(cfg)
+
+	getResponse(t, s, "/prtimes_posts?keyword=trace")
+
+	var root sdktrace.ReadOnlySpan
+	counts := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		counts[span.Name()]++
+		if span.Name() == "GET /prtimes_posts" {
+			root = span
+		}
+	}
+	if root == nil {
+		t.Fatalf("no request span in %v", counts)
+	}
+	if root.SpanKind() != trace.SpanKindServer {
+		t.Errorf("request span kind = %v", root.SpanKind())
+	}
+	if v, ok := spanAttr(root, "http.response.status_code"); !ok || v.AsInt64() != 200 {
+		t.Errorf("request span status code = %v", v.Emit())
+	}
+	if counts["prtimes.search"] != 1 || counts["prtimes.like_count"] != 2 {
+		t.Errorf("span counts = %v, want 1 search and 2 like_count", counts)
+	}
+	for _, span := range recorder.Ended() {
+		if span.Name() != "prtimes.search" && span.Name() != "prtimes.like_count" {
+			continue
+		}
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("%s is not in the request trace", span.Name())
+		}
+		url, ok := spanAttr(span, "url.full")
+		if !ok || !strings.HasPrefix(url.AsString(), f.URL) {
+			t.Errorf("%s: url.full = %q", span.Name(), url.AsString())
+		}
+		if v, ok := spanAttr(span, "http.response.status_code"); !ok || v.AsInt64() != 200 {
+			t.Errorf("%s: status code = %v", span.Name(), v.Emit())
+		}
+	}
+}
+
+// OTLPEndpoint も TracerProvider も設定しない場合は何もしない
+func TestTracingDisabledByDefault(t *testing.T) {
+	if _, ok := newTracerProvider(DefaultConfig()).(*sdktrace.TracerProvider); ok {
+		t.Error("tracing is enabled without an OTLP endpoint")
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// expandScript=true で使うローマ字とカタカナの対応表
+// 訓令式やワープロでの入力 (si, tu, hu など) からもカタカナにできるようにし、カタカナからはヘボン式にする
+var katakanaRomaji = []struct {
+	kana   string
+	romaji []string // 先頭がカタカナから変換する場合の綴り
+}{
+	{"キャ", []string{"kya"}}, {"キュ", []string{"kyu"}}, {"キョ", []string{"kyo"}},
+	{"シャ", []string{"sha", "sya"}}, {"シュ", []string{"shu", "syu"}}, {"ショ", []string{"sho", "syo"}}, {"シェ", []string{"she", "sye"}},
+	{"チャ", []string{"cha", "tya", "cya"}}, {"チュ", []string{"chu", "tyu", "cyu"}}, {"チョ", []string{"cho", "tyo", "cyo"}}, {"チェ", []string{"che", "tye", "cye"}},
+	{"ニャ", []string{"nya"}}, {"ニュ", []string{"nyu"}}, {"ニョ", []string{"nyo"}},
+	{"ヒャ", []string{"hya"}}, {"ヒュ", []string{"hyu"}}, {"ヒョ", []string{"hyo"}},
+	{"ミャ", []string{"mya"}}, {"ミュ", []string{"myu"}}, {"ミョ", []string{"myo"}},
+	{"リャ", []string{"rya"}}, {"リュ", []string{"ryu"}}, {"リョ", []string{"ryo"}},
+	{"ギャ", []string{"gya"}}, {"ギュ", []string{"gyu"}}, {"ギョ", []string{"gyo"}},
+	{"ジャ", []string{"ja", "jya", "zya"}}, {"ジュ", []string{"ju", "jyu", "zyu"}}, {"ジョ", []string{"jo", "jyo", "zyo"}}, {"ジェ", []string{"je", "jye", "zye"}},
+	{"ビャ", []string{"bya"}}, {"ビュ", []string{"byu"}}, {"ビョ", []string{"byo"}},
+	{"ピャ", []string{"pya"}}, {"ピュ", []string{"pyu"}}, {"ピョ", []string{"pyo"}},
+	{"ティ", []string{"ti"}}, {"ディ", []string{"di"}}, {"トゥ", []string{"tu"}}, {"ドゥ", []string{"du"}},
+	{"ファ", []string{"fa"}}, {"フィ", []string{"fi"}}, {"フェ", []string{"fe"}}, {"フォ", []string{"fo"}},
+	{"ウィ", []string{"wi"}}, {"ウェ", []string{"we"}}, {"ウォ", []string{"wo"}},
+	{"ヴァ", []string{"va"}}, {"ヴィ", []string{"vi"}}, {"ヴェ", []string{"ve"}}, {"ヴォ", []string{"vo"}}, {"ヴ", []string{"vu"}},
+	{"ア", []string{"a"}}, {"イ", []string{"i"}}, {"ウ", []string{"u"}}, {"エ", []string{"e"}}, {"オ", []string{"o"}},
+	{"カ", []string{"ka"}}, {"キ", []string{"ki"}}, {"ク", []string{"ku"}}, {"ケ", []string{"ke"}}, {"コ", []string{"ko"}},
+	{"サ", []string{"sa"}}, {"シ", []string{"shi", "si"}}, {"ス", []string{"su"}}, {"セ", []string{"se"}}, {"ソ", []string{"so"}},
+	{"タ", []string{"ta"}}, {"チ", []string{"chi"}}, {"ツ", []string{"tsu"}}, {"テ", []string{"te"}}, {"ト", []string{"to"}},
+	{"ナ", []string{"na"}}, {"ニ", []string{"ni"}}, {"ヌ", []string{"nu"}}, {"ネ", []string{"ne"}}, {"ノ", []string{"no"}},
+	{"ハ", []string{"ha"}}, {"ヒ", []string{"hi"}}, {"フ", []string{"fu", "hu"}}, {"ヘ", []string{"he"}}, {"ホ", []string{"ho"}},
+	{"マ", []string{"ma"}}, {"ミ", []string{"mi"}}, {"ム", []string{"mu"}}, {"メ", []string{"me"}}, {"モ", []string{"mo"}},
+	{"ヤ", []string{"ya"}}, {"ユ", []string{"yu"}}, {"ヨ", []string{"yo"}},
+	{"ラ", []string{"ra", "la"}}, {"リ", []string{"ri", "li"}}, {"ル", []string{"ru", "lu"}}, {"レ", []string{"re", "le"}}, {"ロ", []string{"ro", "lo"}},
+	{"ワ", []string{"wa"}}, {"ヲ", []string{"wo"}},
+	{"ガ", []string{"ga"}}, {"ギ", []string{"gi"}}, {"グ", []string{"gu"}}, {"ゲ", []string{"ge"}}, {"ゴ", []string{"go"}},
+	{"ザ", []string{"za"}}, {"ジ", []string{"ji", "zi"}}, {"ズ", []string{"zu"}}, {"ゼ", []string{"ze"}}, {"ゾ", []string{"zo"}},
+	{"ダ", []string{"da"}}, {"ヂ", []string{"dji"}}, {"ヅ", []string{"dzu"}}, {"デ", []string{"de"}}, {"ド", []string{"do"}},
+	{"バ", []string{"ba"}}, {"ビ", []string{"bi"}}, {"ブ", []string{"bu"}}, {"ベ", []string{"be"}}, {"ボ", []string{"bo"}},
+	{"パ", []string{"pa"}}, {"ピ", []string{"pi"}}, {"プ", []string{"pu"}}, {"ペ", []string{"pe"}}, {"ポ", []string{"po"}},
+}
+
+// 表から作る変換用のマップ
+var (
+	kanaToRomaji = map[string]string{}
+	romajiToKana = map[string]string{}
+)
+
+func init() {
+	for _, entry := range katakanaRomaji {
+		kanaToRomaji[entry.kana] = entry.romaji[0]
+		for _, romaji := range entry.romaji {
+			// tu は ツ (訓令式)、ti は チ として入力されることの方が多い
+			if _, ok := romajiToKana[romaji]; !ok {
+				romajiToKana[romaji] = entry.kana
+			}
+		}
+	}
+	romajiToKana["tu"] = "ツ"
+	romajiToKana["ti"] = "チ"
+}
+
+// カタカナだけの語をローマ字にする (それ以外の文字を含む場合は false)
+// 長音 (ー) は書かない (例: コーヒー → kohi)
+func katakanaToRomaji(word string) (string, bool) {
+	runes := []rune(word)
+	var b strings.Builder
+	// 次の音節の子音を重ねる (ッ)
+	double := false
+	for i := 0; i < len(runes); {
+		switch runes[i] {
+		case 'ー':
+			i++
+			continue
+		case 'ッ':
+			double = true
+			i++
+			continue
+		case 'ン':
+			b.WriteString("n")
+			i++
+			continue
+		}
+		// 2文字 (拗音など) を優先する
+		var romaji string
+		if i+1 < len(runes) {
+			romaji = kanaToRomaji[string(runes[i:i+2])]
+		}
+		n := 2
+		if romaji == "" {
+			romaji, n = kanaToRomaji[string(runes[i])], 1
+		}
+		if romaji == "" {
+			return "", false
+		}
+		if double {
+			if strings.HasPrefix(romaji, "ch") {
+				b.WriteString("t")
+			} else if !strings.ContainsRune("aiueo", rune(romaji[0])) {
+				b.WriteByte(romaji[0])
+			}
+			double = false
+		}
+		b.WriteString(romaji)
+		i += n
+	}
+	if b.Len() == 0 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// 英字だけの語をカタカナにする (変換できない綴りを含む場合は false)
+// 大文字と小文字は区別しない。- は長音 (ー) にする
+func romajiToKatakana(word string) (string, bool) {
+	s := strings.ToLower(word)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '-':
+			b.WriteString("ー")
+			i++
+			continue
+		case c == 'n' && !startsSyllable(s, i+1):
+			// 母音と y 以外が続く n は ン (nn の後に母音が続かない場合は nn で ン)
+			b.WriteString("ン")
+			i++
+			if i < len(s) && s[i] == 'n' && !startsSyllable(s, i+1) {
+				i++
+			}
+			continue
+		case i+1 < len(s) && c == s[i+1] && !strings.ContainsRune("aiueon", rune(c)):
+			// 子音が重なる場合は ッ
+			b.WriteString("ッ")
+			i++
+			continue
+		case c == 't' && strings.HasPrefix(s[i+1:], "ch"):
+			b.WriteString("ッ")
+			i++
+			continue
+		}
+		matched := false
+		for n := 3; n >= 1; n-- {
+			if i+n > len(s) {
+				continue
+			}
+			if kana, ok := romajiToKana[s[i:i+n]]; ok {
+				b.WriteString(kana)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+	if b.Len() == 0 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// キーワードの語ごとにローマ字とカタカナを入れ替えたもの
+// 変換できない語はそのまま残し、どの語も変換できない場合は空を返す
+func scriptVariant(keyword string) string {
+	terms := strings.Fields(keyword)
+	changed := false
+	for i, term := range terms {
+		var converted string
+		var ok bool
+		// AI や DX などの略語は読みが変わるので変換しない
+		if len(term) > 1 && term == strings.ToUpper(term) && isASCIILetters(term) {
+			continue
+		}
+		if isASCIILetters(term) {
+			converted, ok = romajiToKatakana(term)
+		} else {
+			converted, ok = katakanaToRomaji(term)
+		}
+		if ok {
+			terms[i] = converted
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(terms, " ")
+}
+
+// s[i] が n の後で音節を作る文字 (母音か y) か
+func startsSyllable(s string, i int) bool {
+	return i < len(s) && strings.ContainsRune("aiueoy", rune(s[i]))
+}
+
+func isASCIILetters(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || r == '-') {
+			return false
+		}
+	}
+	return true
+}
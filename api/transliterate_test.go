@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestRomajiToKatakana(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+		ok   bool
+	}{
+		{"toyota", "トヨタ", true},
+		{"Shinbun", "シンブン", true},
+		{"kitte", "キッテ", true},
+		{"konnichiwa", "コンニチワ", true},
+		// 訓令式でも読める
+		{"tuki", "ツキ", true},
+		{"ko-hi-", "コーヒー", true},
+		{"xyz", "", false},
+		{"rāmen", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := romajiToKatakana(tt.word); got != tt.want || ok != tt.ok {
+			t.Errorf("romajiToKatakana(%q) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestKatakanaToRomaji(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+		ok   bool
+	}{
+		{"トヨタ", "toyota", true},
+		{"シンブン", "shinbun", true},
+		{"キッテ", "kitte", true},
+		// 長音は書かない
+		{"コーヒー", "kohi", true},
+		{"ヴァイオリン", "vaiorin", true},
+		{"新聞", "", false},
+		{"トヨタ自動車", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := katakanaToRomaji(tt.word); got != tt.want || ok != tt.ok {
+			t.Errorf("katakanaToRomaji(%q) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScriptVariant(t *testing.T) {
+	tests := map[string]string{
+		"toyota":      "トヨタ",
+		"トヨタ":         "toyota",
+		"toyota 新車":   "トヨタ 新車",
+		"トヨタ toyota":  "toyota トヨタ",
+		"AI":          "",
+		"新車":          "",
+		"AI  shinbun": "AI シンブン",
+		"":            "",
+	}
+	for keyword, want := range tests {
+		if got := scriptVariant(keyword); got != want {
+			t.Errorf("scriptVariant(%q) = %q, want %q", keyword, got, want)
+		}
+	}
+}
+
+// expandScript=true の場合は、ローマ字とカタカナの両方で検索した結果をまとめる (同じリリースは1件にする)
+func TestExpandScriptMergesVariants(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("toyota", 1, "2024年12月01日 09時00分", 3)
+	f.addRelease("toyota", 2, "2024年12月02日 09時00分", 2)
+	f.addRelease("トヨタ", 2, "2024年12月02日 09時00分", 2)
+	f.addRelease("トヨタ", 3, "2024年12月03日 09時00分", 1)
+	s := NewServer(f.config())
+
+	resp := getResponse(t, s, "/prtimes_posts?keyword=toyota&expandScript=true")
+	var titles []string
+	for _, item := range resp.Items {
+		titles = append(titles, item.Title)
+	}
+	if want := []string{"リリース1", "リリース2", "リリース3"}; !slices.Equal(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+	if !slices.Equal(resp.ExpandedKeywords, []string{"トヨタ"}) {
+		t.Errorf("expandedKeywords = %v", resp.ExpandedKeywords)
+	}
+
+	// カタカナから検索した場合も同じ
+	resp = getResponse(t, s, "/prtimes_posts?keyword="+url.QueryEscape("トヨタ")+"&expandScript=true")
+	if len(resp.Items) != 3 || !slices.Equal(resp.ExpandedKeywords, []string{"toyota"}) {
+		t.Errorf("got %d items, expandedKeywords = %v", len(resp.Items), resp.ExpandedKeywords)
+	}
+
+	// 指定しない場合は入力した表記だけで検索する
+	if resp := getResponse(t, s, "/prtimes_posts?keyword=toyota"); len(resp.Items) != 2 || resp.ExpandedKeywords != nil {
+		t.Errorf("got %d items, expandedKeywords = %v without expandScript", len(resp.Items), resp.ExpandedKeywords)
+	}
+}
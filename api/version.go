@@ -0,0 +1,25 @@
+package api
+
+import "net/http"
+
+// レスポンスの形の版
+// v1 は項目の配列だけ、v2 は keyword や totalLikes などを含む Response で返す
+const (
+	apiVersionV1 = "v1"
+	apiVersionV2 = "v2"
+)
+
+// Accept-Version を指定しない場合の版 (最新)
+const APIVersion = apiVersionV2
+
+// Accept-Version ヘッダーから返す形を決める (対応していない版の場合は false)
+func parseAPIVersion(r *http.Request) (string, bool) {
+	switch v := r.Header.Get("Accept-Version"); v {
+	case "":
+		return APIVersion, true
+	case apiVersionV1, apiVersionV2:
+		return v, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Accept-Version で配列だけ (v1) か封筒 (v2) かを選ぶ
+func TestAcceptVersion(t *testing.T) {
+	f := newFakeUpstream(t)
+	f.addRelease("version", 1, "2024年12月01日 09時00分", 2)
+	s := NewServer(f.config())
+
+	for _, tt := range []struct {
+		header, want string
+	}{
+		{"", apiVersionV2},
+		{"v2", apiVersionV2},
+		{"v1", apiVersionV1},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=version", nil)
+		if tt.header != "" {
+			req.Header.Set("Accept-Version", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept-Version %q: status %d", tt.header, rec.Code)
+		}
+		if got := rec.Header().Get("API-Version"); got != tt.want {
+			t.Errorf("Accept-Version %q: API-Version = %q, want %q", tt.header, got, tt.want)
+		}
+
+		if tt.want == apiVersionV1 {
+			var items []ResponseItem
+			if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil || len(items) != 1 {
+				t.Errorf("v1 body should be a bare array: %s", rec.Body.String())
+			}
+			continue
+		}
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("v2 body should be an envelope: %v", err)
+		}
+		if resp.APIVersion != APIVersion || len(resp.Items) != 1 {
+			t.Errorf("apiVersion = %q with %d items, want %q with 1", resp.APIVersion, len(resp.Items), APIVersion)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/prtimes_posts?keyword=version", nil)
+	req.Header.Set("Accept-Version", "v3")
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Accept-Version v3: status %d, want 400", rec.Code)
+	}
+}